@@ -0,0 +1,164 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+
+	"github.com/BurntSushi/toml"
+	"github.com/urfave/cli/v3"
+)
+
+// Path of the default config file, relative to the config directory of the user, e.g. ~/.config
+const defaultConfigFile = "mediasorter/config.toml"
+
+// applyConfigFile sets the flags from the config file that are not set on the command line,
+// so that command line flags take precedence over the config file and the config file over the defaults.
+// Without a --config flag, it reads the default config file, if it exists.
+func applyConfigFile(cmd *cli.Command) error {
+	path := cmd.String("config")
+	if path == "" {
+		configDir, err := os.UserConfigDir()
+		if err != nil {
+			return nil
+		}
+		path = filepath.Join(configDir, defaultConfigFile)
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+	}
+
+	config, err := loadConfigFile(path)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrConfig, err)
+	}
+	settings := reflect.ValueOf(config).Elem()
+	for i := range settings.NumField() {
+		name := settings.Type().Field(i).Tag.Get("toml")
+		if name == "" || !config.defined[name] || cmd.IsSet(name) {
+			continue
+		}
+		// All bool flags default to false, and setting counting flags like --verbose counts up even for false
+		if enabled, ok := settings.Field(i).Interface().(bool); ok && !enabled {
+			continue
+		}
+		values := []string{fmt.Sprint(settings.Field(i).Interface())}
+		if list, ok := settings.Field(i).Interface().([]string); ok {
+			values = list
+		}
+		for _, value := range values {
+			if err := cmd.Set(name, value); err != nil {
+				return fmt.Errorf("%w: invalid setting '%s' in config file %s: %v", ErrConfig, name, path, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Config holds the settings of a config file. The keys are the names of the command line flags.
+type Config struct {
+	DryRun                         bool     `toml:"dry-run"`
+	Move                           bool     `toml:"move"`
+	OnExists                       string   `toml:"on-exists"`
+	Override                       bool     `toml:"override"`
+	Migrate                        bool     `toml:"migrate"`
+	Confirm                        bool     `toml:"confirm"`
+	Apply                          bool     `toml:"apply"`
+	SkipUpToDate                   bool     `toml:"skip-up-to-date"`
+	Dedupe                         bool     `toml:"dedupe"`
+	VerifyPlan                     string   `toml:"verify-plan"`
+	CheckCollisions                bool     `toml:"check-collisions"`
+	ReportSkipsAsErrors            bool     `toml:"report-skips-as-errors"`
+	SummarizeSkips                 bool     `toml:"summarize-skips"`
+	Ledger                         string   `toml:"ledger"`
+	Template                       string   `toml:"template"`
+	InitTemplate                   string   `toml:"init-template"`
+	Separator                      string   `toml:"separator"`
+	Flatten                        bool     `toml:"flatten"`
+	FlattenIndex                   string   `toml:"flatten-index"`
+	FixExtension                   bool     `toml:"fix-extension"`
+	KeepOriginalName               bool     `toml:"keep-original-name"`
+	StrictTemplate                 bool     `toml:"strict-template"`
+	UnknownArtist                  string   `toml:"unknown-artist"`
+	UnknownAlbum                   string   `toml:"unknown-album"`
+	UnknownTitle                   string   `toml:"unknown-title"`
+	NoDefaults                     bool     `toml:"no-defaults"`
+	PruneEmpty                     bool     `toml:"prune-empty"`
+	TrashDir                       string   `toml:"trash-dir"`
+	Delete                         bool     `toml:"delete"`
+	SkipMarker                     string   `toml:"skip-marker"`
+	WriteMarker                    string   `toml:"write-marker"`
+	Type                           []string `toml:"type"`
+	MinYear                        int      `toml:"min-year"`
+	MaxYear                        int      `toml:"max-year"`
+	MinSize                        string   `toml:"min-size"`
+	MaxSize                        string   `toml:"max-size"`
+	Genre                          string   `toml:"genre"`
+	Include                        []string `toml:"include"`
+	Exclude                        []string `toml:"exclude"`
+	Sample                         int      `toml:"sample"`
+	LogFile                        string   `toml:"log-file"`
+	Progress                       bool     `toml:"progress"`
+	Jobs                           int      `toml:"jobs"`
+	Verify                         bool     `toml:"verify"`
+	AtomicGroup                    bool     `toml:"atomic-group"`
+	KeepGoing                      bool     `toml:"keep-going"`
+	MaxDepth                       int      `toml:"max-depth"`
+	FollowSymlinks                 bool     `toml:"follow-symlinks"`
+	FromStdin                      bool     `toml:"from-stdin"`
+	MaxFiles                       int      `toml:"max-files"`
+	Force                          bool     `toml:"force"`
+	FuzzySidecars                  bool     `toml:"fuzzy-sidecars"`
+	FlattenSidecars                bool     `toml:"flatten-sidecars"`
+	ArtworkTemplate                string   `toml:"artwork-template"`
+	MediaPriority                  []string `toml:"media-priority"`
+	MediaSelection                 string   `toml:"media-selection"`
+	SidecarPolicy                  []string `toml:"sidecar-policy"`
+	SidecarExt                     []string `toml:"sidecar-ext"`
+	CopyNewerSidecarsOnly          bool     `toml:"copy-newer-sidecars-only"`
+	ExtractLyrics                  bool     `toml:"extract-lyrics"`
+	ExtractArt                     bool     `toml:"extract-art"`
+	KeepUnsorted                   bool     `toml:"keep-unsorted"`
+	UnsortedPrefix                 string   `toml:"unsorted-prefix"`
+	OnLocked                       string   `toml:"on-locked"`
+	Sanitize                       string   `toml:"sanitize"`
+	FSProfile                      string   `toml:"fs-profile"`
+	OutputEncoding                 string   `toml:"output-encoding"`
+	NormalizeUnicode               bool     `toml:"normalize-unicode"`
+	KeepBrackets                   bool     `toml:"keep-brackets"`
+	MaxSegmentLength               int      `toml:"max-segment-length"`
+	MaxPathLength                  int      `toml:"max-path-length"`
+	NormalizeAlbumArtistFromTracks bool     `toml:"normalize-album-artist-from-tracks"`
+	DetectSplits                   bool     `toml:"detect-splits"`
+	SplitSeparator                 string   `toml:"split-separator"`
+	NormalizeTrackZero             bool     `toml:"normalize-track-zero"`
+	NormalizePunctuation           bool     `toml:"normalize-punctuation"`
+	Manifest                       string   `toml:"manifest"`
+	ManifestFormat                 string   `toml:"manifest-format"`
+	Quiet                          bool     `toml:"quiet"`
+	Verbose                        bool     `toml:"verbose"`
+
+	// Keys of the settings in the file, to tell settings with zero values from missing settings
+	defined map[string]bool
+}
+
+// loadConfigFile reads a TOML config file that uses the flag names as keys, e.g. `template = "album.tmpl"` or `move = true`
+func loadConfigFile(path string) (*Config, error) {
+	config := &Config{defined: make(map[string]bool)}
+	metadata, err := toml.DecodeFile(path, config)
+	if err != nil {
+		return nil, fmt.Errorf("error in config file %s: %w", path, err)
+	}
+	if metadata.IsDefined("config") {
+		return nil, fmt.Errorf("config file %s can't point to another config file", path)
+	}
+	if undecoded := metadata.Undecoded(); len(undecoded) > 0 {
+		return nil, fmt.Errorf("unknown setting '%s' in config file %s", undecoded[0], path)
+	}
+	for _, key := range metadata.Keys() {
+		config.defined[key.String()] = true
+	}
+	return config, nil
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/urfave/cli/v3"
+)
+
+func writeConfigFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	path := writeConfigFile(t, `# Settings for my library
+template = "album.tmpl"
+move = true
+dry-run = false
+max-files = 500 # more than enough
+unsorted-prefix = 'C:\Unsorted'
+media-priority = [
+  "flac",
+  "mp3",
+]
+sidecar-policy = []
+unknown-artist = "say \"hi\""
+`)
+
+	config, err := loadConfigFile(path)
+	if err != nil {
+		t.Fatalf("loadConfigFile returned error: %v", err)
+	}
+	if config.Template != "album.tmpl" || !config.Move || config.MaxFiles != 500 || config.UnsortedPrefix != `C:\Unsorted` || config.UnknownArtist != `say "hi"` {
+		t.Errorf("Unexpected settings %+v", config)
+	}
+	if !slices.Equal(config.MediaPriority, []string{"flac", "mp3"}) || len(config.SidecarPolicy) != 0 {
+		t.Errorf("Unexpected arrays %q and %q", config.MediaPriority, config.SidecarPolicy)
+	}
+	for _, name := range []string{"template", "move", "dry-run", "max-files", "unsorted-prefix", "media-priority", "sidecar-policy", "unknown-artist"} {
+		if !config.defined[name] {
+			t.Errorf("Expected setting %s to be defined", name)
+		}
+	}
+	if config.defined["quiet"] {
+		t.Error("Expected missing setting quiet to be undefined")
+	}
+}
+
+func TestLoadConfigFileRejectsInvalidSettings(t *testing.T) {
+	tests := []struct {
+		description string
+		content     string
+	}{
+		{"table", "[sorter]\ntemplate = \"album.tmpl\""},
+		{"missing value", "template"},
+		{"unquoted string", "template = album.tmpl"},
+		{"unclosed string", "template = \"album.tmpl"},
+		{"duplicate setting", "move = true\nmove = false"},
+		{"unknown setting", "colour = \"blue\""},
+		{"wrong type", "max-files = \"many\""},
+		{"other config file", "config = \"other.toml\""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			if _, err := loadConfigFile(writeConfigFile(t, test.content)); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+}
+
+func TestApplyConfigFile(t *testing.T) {
+	tests := []struct {
+		description      string
+		args             []string
+		expectedTemplate string
+	}{
+		{"config file overrides default", nil, "from-config.tmpl"},
+		{"flag overrides config file", []string{"--template", "from-flag.tmpl"}, "from-flag.tmpl"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			path := writeConfigFile(t, "template = \"from-config.tmpl\"\nmove = true\nmax-files = 500\nmedia-priority = [\"flac\", \"mp3\"]\n")
+			var template string
+			var move bool
+			var maxFiles int
+			var mediaPriority []string
+			cmd := &cli.Command{
+				Flags: []cli.Flag{
+					&cli.StringFlag{Name: "config"},
+					&cli.StringFlag{Name: "template", Value: "default.tmpl"},
+					&cli.BoolFlag{Name: "move"},
+					&cli.IntFlag{Name: "max-files"},
+					&cli.StringSliceFlag{Name: "media-priority"},
+				},
+				Action: func(_ context.Context, cmd *cli.Command) error {
+					if err := applyConfigFile(cmd); err != nil {
+						return err
+					}
+					template = cmd.String("template")
+					move = cmd.Bool("move")
+					maxFiles = cmd.Int("max-files")
+					mediaPriority = cmd.StringSlice("media-priority")
+					return nil
+				},
+			}
+
+			args := append([]string{"mediasorter", "--config", path}, test.args...)
+			if err := cmd.Run(context.Background(), args); err != nil {
+				t.Fatalf("Run returned error: %v", err)
+			}
+			if template != test.expectedTemplate {
+				t.Errorf("Expected template '%s' but got '%s'", test.expectedTemplate, template)
+			}
+			if !move || maxFiles != 500 || !slices.Equal(mediaPriority, []string{"flac", "mp3"}) {
+				t.Errorf("Expected move, max-files and media-priority from the config file, got %t, %d and %q", move, maxFiles, mediaPriority)
+			}
+		})
+	}
+}
+
+func TestApplyConfigFileWithDisabledVerbose(t *testing.T) {
+	tests := []struct {
+		description       string
+		config            string
+		expectedVerbosity int
+	}{
+		{"false", "verbose = false\n", 0},
+		{"true", "verbose = true\n", 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			path := writeConfigFile(t, test.config)
+			var verbosity int
+			cmd := &cli.Command{
+				Flags: []cli.Flag{
+					&cli.StringFlag{Name: "config"},
+					&cli.BoolFlag{Name: "verbose", Config: cli.BoolConfig{Count: &verbosity}},
+				},
+				Action: func(_ context.Context, cmd *cli.Command) error {
+					return applyConfigFile(cmd)
+				},
+			}
+
+			if err := cmd.Run(context.Background(), []string{"mediasorter", "--config", path}); err != nil {
+				t.Fatalf("Run returned error: %v", err)
+			}
+			if verbosity != test.expectedVerbosity {
+				t.Errorf("Expected verbosity %d but got %d", test.expectedVerbosity, verbosity)
+			}
+		})
+	}
+}
@@ -3,6 +3,8 @@ module github.com/gbirke/mediasorter
 go 1.24.2
 
 require (
+	github.com/BurntSushi/toml v1.6.0
 	github.com/dhowden/tag v0.0.0-20240417053706-3d75831295e8
 	github.com/urfave/cli/v3 v3.3.3
+	golang.org/x/text v0.34.0
 )
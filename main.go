@@ -1,450 +1,383 @@
 package main
 
 import (
-	"bytes"
+	"bufio"
 	"context"
 	"errors"
 	"fmt"
-	"io"
 	"io/fs"
 	"os"
-	"path/filepath"
+	"slices"
 	"strings"
-	"text/template"
 
-	"github.com/dhowden/tag"
+	"github.com/gbirke/mediasorter/sorter"
 	"github.com/urfave/cli/v3"
 )
 
 var ErrConfig = errors.New("command line error")
 
-// TODO read template from file, explain whitespace trimming and placeholders in README
-var defaultPathTemplate = `
-	{{- or .AlbumArtist .Artist -}}
-	{{- pathSep -}}
-	{{- .Album -}}
-	{{- pathSep -}}
-	{{- if .Track }}{{ printf "%02d" .Track }}. {{ end -}}
-	{{- .Title -}}
-`
-
-type Config struct {
-	SrcDir    string
-	DestDir   string
-	DryRun    bool
-	Move      bool
-	Override  bool
-	Template  string
-	Verbosity Verbosity
-}
-
-type OverrideChecker interface {
-	DestinationFileExists(destPath string) bool
-}
-
-type NoOverrideChecker struct {
-}
-
-func (n *NoOverrideChecker) DestinationFileExists(destPath string) bool {
-	return false
-}
-
-type MemoryOverrideChecker struct {
-	SeenFiles map[string]struct{}
-}
+func buildConfig(cmd *cli.Command, verbosity int) (*sorter.Config, error) {
+	srcDir := cmd.StringArg("srcDir")
+	destDir := cmd.StringArg("destDir")
 
-func (m *MemoryOverrideChecker) DestinationFileExists(destPath string) bool {
-	if _, exists := m.SeenFiles[destPath]; exists {
-		return true
+	if cmd.Bool("from-stdin") {
+		// The list of files replaces the source directory, so the only argument is the destination directory
+		if destDir != "" {
+			return nil, fmt.Errorf("%w: --from-stdin reads the source files from stdin, it only needs a destination directory", ErrConfig)
+		}
+		if cmd.Bool("migrate") || cmd.Bool("prune-empty") {
+			return nil, fmt.Errorf("%w: --from-stdin can't be used with --migrate or --prune-empty, they need a source directory", ErrConfig)
+		}
+		if cmd.Bool("confirm") {
+			return nil, fmt.Errorf("%w: --from-stdin can't be used with --confirm, the answer would be read from the list of files", ErrConfig)
+		}
+		srcDir, destDir = "", srcDir
+	} else if srcDir == "" {
+		return nil, fmt.Errorf("%w: source directory is required", ErrConfig)
 	}
-	m.SeenFiles[destPath] = struct{}{}
-	return false
-}
 
-type FileExistsError struct {
-	srcPath  string
-	destPath string
-}
+	if cmd.Bool("dry-run") && cmd.Bool("move") {
+		return nil, fmt.Errorf("%w: cannot use both --dry-run and --move flags together", ErrConfig)
+	}
 
-func (err *FileExistsError) Error() string {
-	return fmt.Sprintf("File %s already exists, skipping %s\n", err.destPath, err.srcPath)
-}
+	onLocked, err := sorter.ParseLockedFilePolicy(cmd.String("on-locked"))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrConfig, err)
+	}
 
-type FileProcessor func(srcPath string, destPath string) error
+	sidecarPolicy, err := sorter.ParseSidecarPolicy(cmd.StringSlice("sidecar-policy"))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrConfig, err)
+	}
 
-func DryRunFileProcessor(srcPath string, destPath string) error {
-	return nil
-}
+	mediaSelection, err := sorter.ParseMediaSelection(cmd.String("media-selection"))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrConfig, err)
+	}
 
-func CopyFile(srcPath string, destPath string) (err error) {
-	// create destination directory if it does not exist
-	err = os.MkdirAll(filepath.Dir(destPath), 0755)
+	fileTypes, err := sorter.ParseFileTypes(cmd.StringSlice("type"))
 	if err != nil {
-		return fmt.Errorf("error creating directory %s: %v", filepath.Dir(destPath), err)
+		return nil, fmt.Errorf("%w: %v", ErrConfig, err)
+	}
+
+	if err := sorter.CheckPatterns(slices.Concat(cmd.StringSlice("include"), cmd.StringSlice("exclude"))); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrConfig, err)
 	}
 
-	destFile, err := os.Create(destPath)
+	onExists, err := sorter.ParseExistingFilePolicy(cmd.String("on-exists"))
 	if err != nil {
-		return fmt.Errorf("error creating file %s: %v", destPath, err)
+		return nil, fmt.Errorf("%w: %v", ErrConfig, err)
 	}
-	defer func() {
-		if closeErr := destFile.Close(); closeErr != nil && err == nil {
-			err = fmt.Errorf("error closing file %s: %v", destPath, closeErr)
+	if cmd.Bool("override") {
+		if cmd.IsSet("on-exists") && onExists != sorter.OverwriteExisting {
+			return nil, fmt.Errorf("%w: --override is the same as --on-exists=overwrite, it can't be used with --on-exists=%s", ErrConfig, onExists)
 		}
-	}()
-	f, err := os.Open(srcPath)
-	if err != nil {
-		return fmt.Errorf("error opening file %s: %v", srcPath, err)
+		onExists = sorter.OverwriteExisting
 	}
-	defer f.Close()
-	_, err = io.Copy(destFile, f)
-	if err != nil {
-		return fmt.Errorf("error copying file %s to %s: %v", srcPath, destPath, err)
+	if cmd.Bool("skip-up-to-date") {
+		if cmd.IsSet("on-exists") && onExists != sorter.UpdateExisting {
+			return nil, fmt.Errorf("%w: --skip-up-to-date is the same as --on-exists=update, it can't be used with --on-exists=%s", ErrConfig, onExists)
+		}
+		onExists = sorter.UpdateExisting
+	}
+	if cmd.Bool("dedupe") {
+		if cmd.IsSet("on-exists") && onExists != sorter.DedupeExisting {
+			return nil, fmt.Errorf("%w: --dedupe is the same as --on-exists=dedupe, it can't be used with --on-exists=%s", ErrConfig, onExists)
+		}
+		if cmd.Bool("override") || cmd.Bool("skip-up-to-date") {
+			return nil, fmt.Errorf("%w: --dedupe can't be used with --override or --skip-up-to-date", ErrConfig)
+		}
+		onExists = sorter.DedupeExisting
 	}
-	return nil
-}
 
-func MoveFile(srcPath string, destPath string) (err error) {
-	// create destination directory if it does not exist
-	err = os.MkdirAll(filepath.Dir(destPath), 0755)
+	outputEncoding, err := sorter.ParseOutputEncoding(cmd.String("output-encoding"))
 	if err != nil {
-		return fmt.Errorf("error creating directory %s: %v", filepath.Dir(destPath), err)
+		return nil, fmt.Errorf("%w: %v", ErrConfig, err)
 	}
 
-	err = os.Rename(srcPath, destPath)
+	verifyPlan, err := sorter.ParsePlanVerification(cmd.String("verify-plan"))
 	if err != nil {
-		return fmt.Errorf("error moving file %s to %s: %v", srcPath, destPath, err)
+		return nil, fmt.Errorf("%w: %v", ErrConfig, err)
+	}
+	if cmd.Bool("check-collisions") {
+		if cmd.IsSet("verify-plan") && verifyPlan != sorter.AbortOnCollisions {
+			return nil, fmt.Errorf("%w: --check-collisions is the same as --verify-plan=abort, it can't be used with --verify-plan=%s", ErrConfig, verifyPlan)
+		}
+		verifyPlan = sorter.AbortOnCollisions
 	}
 
-	return nil
-}
-
-type MediaSorter struct {
-	DestDir         string
-	PathTemplate    *template.Template
-	MetadataReader  *MetaDataReader
-	FileProcessor   FileProcessor
-	OverrideChecker OverrideChecker
-	OutputWriter    *OutputWriter
-}
-
-func (m *MediaSorter) ProcessFileGroup(group *FileGroup) error {
-	metadata, err := m.MetadataReader.ReadMetadata(group.MediaFile)
-
+	sanitize, err := sorter.ParseSanitizeLevel(cmd.String("sanitize"))
 	if err != nil {
-		re, ok := err.(*NotAMediaFileError)
-		if ok {
-			m.OutputWriter.Info(re.Error())
-			return nil
+		return nil, fmt.Errorf("%w: %v", ErrConfig, err)
+	}
+	if cmd.IsSet("fs-profile") {
+		if cmd.IsSet("sanitize") {
+			return nil, fmt.Errorf("%w: --fs-profile chooses the sanitize level, it can't be used with --sanitize", ErrConfig)
+		}
+		sanitize, err = sorter.ParseFilesystemProfile(cmd.String("fs-profile"))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrConfig, err)
 		}
-		return err
 	}
 
-	// Generate the destination path and `destPath` for sidecar files, using the template
-	var pathBuffer bytes.Buffer
-	if err := m.PathTemplate.Execute(&pathBuffer, metadata.CleanForPaths()); err != nil {
-		return fmt.Errorf("error executing template: %v", err)
+	if cmd.IsSet("separator") && cmd.String("separator") == "" {
+		return nil, fmt.Errorf("%w: --separator can't be empty", ErrConfig)
 	}
-	pathStr := cleanPath(pathBuffer.String())
-	mediaExt := filepath.Ext(string(group.MediaFile))
-	destPath := filepath.Join(m.DestDir, pathStr+mediaExt)
 
-	if string(group.MediaFile) == destPath {
-		return fmt.Errorf("destination path %s is the same as source path, skipping", destPath)
+	if cmd.Bool("check-writable") && !cmd.Bool("dry-run") {
+		return nil, fmt.Errorf("%w: --check-writable can only be used together with --dry-run", ErrConfig)
 	}
 
-	m.OutputWriter.Info(fmt.Sprintf("Processing file %s -> %s", group.MediaFile, destPath))
-
-	if m.OverrideChecker.DestinationFileExists(destPath) {
-		m.OutputWriter.Warn(fmt.Sprintf("File %s already exists, skipping %s", destPath, group.MediaFile))
-		return nil
+	if cmd.Bool("migrate") && destDir != "" && destDir != srcDir {
+		return nil, fmt.Errorf("%w: --migrate sorts the source directory in place, it does not need a destination directory", ErrConfig)
 	}
 
-	err = m.FileProcessor(string(group.MediaFile), destPath)
-	if err != nil {
-		return err
+	if cmd.Bool("apply") && !cmd.Bool("migrate") {
+		return nil, fmt.Errorf("%w: --apply can only be used together with --migrate", ErrConfig)
 	}
 
-	// Process sidecar files
-	for _, sidecarFile := range group.SidecarFiles {
-		sidecarExt := filepath.Ext(sidecarFile)
-		sidecarDestPath := filepath.Join(m.DestDir, pathStr+sidecarExt)
-
-		err := m.FileProcessor(sidecarFile, sidecarDestPath)
-		if err != nil {
-			return err
-		}
+	if cmd.Bool("apply") && cmd.Bool("dry-run") {
+		return nil, fmt.Errorf("%w: cannot use both --dry-run and --apply flags together", ErrConfig)
 	}
 
-	return nil
-}
-
-func (m *MediaSorter) Sort(srcDir string) error {
-	// First pass: collect all files and group by path without suffix
-	fileGroups := make(map[string][]string)
-	// Walk recursively through the source directory
-	err := filepath.WalkDir(srcDir, func(path string, info fs.DirEntry, err error) error {
-		if err != nil {
-			return err
-		}
-
-		// We don't do anything with directories, filepath.WalkDir will recursively walk them anyway
-		if info.IsDir() {
-			return nil
-		}
+	if cmd.Bool("quiet") && verbosity > 0 {
+		return nil, fmt.Errorf("%w: cannot use both --quiet and --verbose flags together", ErrConfig)
+	}
 
-		// Skip hidden files on Unix-like systems
-		isHidenOnUnix := strings.HasPrefix(info.Name(), ".")
-		if isHidenOnUnix {
-			return nil
-		}
+	if cmd.Int("jobs") < 1 {
+		return nil, fmt.Errorf("%w: --jobs must be at least 1", ErrConfig)
+	}
 
-		basename := strings.TrimSuffix(path, filepath.Ext(path))
-		fileGroups[basename] = append(fileGroups[basename], path)
+	if cmd.Int("min-year") < 0 || cmd.Int("max-year") < 0 {
+		return nil, fmt.Errorf("%w: --min-year and --max-year must not be negative", ErrConfig)
+	}
 
-		return nil
-	})
+	if cmd.Int("min-year") > 0 && cmd.Int("max-year") > 0 && cmd.Int("min-year") > cmd.Int("max-year") {
+		return nil, fmt.Errorf("%w: --min-year %d is after --max-year %d", ErrConfig, cmd.Int("min-year"), cmd.Int("max-year"))
+	}
 
+	minSize, err := sizeFlag(cmd, "min-size")
 	if err != nil {
-		return err
+		return nil, err
+	}
+	maxSize, err := sizeFlag(cmd, "max-size")
+	if err != nil {
+		return nil, err
+	}
+	if minSize > 0 && maxSize > 0 && minSize > maxSize {
+		return nil, fmt.Errorf("%w: --min-size %s is more than --max-size %s", ErrConfig, cmd.String("min-size"), cmd.String("max-size"))
 	}
 
-	// Second pass: process each group
-	for basename, files := range fileGroups {
-
-		group, err := m.MetadataReader.GetFileGroup(files)
+	if cmd.Int("max-segment-length") < 0 {
+		return nil, fmt.Errorf("%w: --max-segment-length must not be negative", ErrConfig)
+	}
 
-		if err != nil {
-			switch len(files) {
-			case 0:
-				m.OutputWriter.Warn(fmt.Sprintf("Strange error: No files found in group '%s'. This should never happen. Please contact program author", basename))
-			case 1:
-				m.OutputWriter.Warn(fmt.Sprintf("%s is not a media file, skipping", files[0]))
-			default:
-				m.OutputWriter.Warn(fmt.Sprintf("No media file found for %d files starting with %s, skipping", len(files), basename))
-			}
-			continue
-		}
+	if cmd.Int("max-depth") < 0 {
+		return nil, fmt.Errorf("%w: --max-depth must not be negative", ErrConfig)
+	}
 
-		err = m.ProcessFileGroup(group)
+	if cmd.Int("sample") < 0 {
+		return nil, fmt.Errorf("%w: --sample must not be negative", ErrConfig)
+	}
 
-		if err == tag.ErrNoTagsFound {
-			m.OutputWriter.Warn(fmt.Sprintf("No tags found in file %s, skipping", group.MediaFile))
-			continue
-		}
+	if cmd.Int("sample") > 0 && cmd.Bool("confirm") {
+		return nil, fmt.Errorf("%w: --sample doesn't process any files, it can't be used with --confirm", ErrConfig)
+	}
 
-		switch err.(type) {
-		case *FileExistsError:
-			m.OutputWriter.Warn(err.Error())
-		case *NotAMediaFileError:
-			m.OutputWriter.Warn(err.Error())
-		case nil:
-			// Success, continue
-		default:
-			return err
-		}
+	if cmd.Bool("prune-empty") && !cmd.Bool("move") && !cmd.Bool("migrate") {
+		return nil, fmt.Errorf("%w: --prune-empty can only be used together with --move or --migrate", ErrConfig)
 	}
 
-	return nil
-}
+	if (cmd.Bool("delete") || cmd.IsSet("trash-dir")) && !cmd.Bool("prune-empty") {
+		return nil, fmt.Errorf("%w: --delete and --trash-dir can only be used together with --prune-empty", ErrConfig)
+	}
 
-func buildConfig(cmd *cli.Command, verbosity int) (*Config, error) {
-	srcDir := cmd.StringArg("srcDir")
-	destDir := cmd.StringArg("destDir")
+	if cmd.Bool("delete") && cmd.IsSet("trash-dir") {
+		return nil, fmt.Errorf("%w: cannot use both --delete and --trash-dir flags together", ErrConfig)
+	}
 
-	if srcDir == "" {
-		return nil, fmt.Errorf("%w: source directory is required", ErrConfig)
+	if cmd.Bool("confirm") && cmd.Bool("dry-run") {
+		return nil, fmt.Errorf("%w: cannot use both --dry-run and --confirm flags together", ErrConfig)
 	}
 
-	if cmd.Bool("dry-run") && cmd.Bool("move") {
-		return nil, fmt.Errorf("%w: cannot use both --dry-run and --move flags together", ErrConfig)
+	if !slices.Contains(sorter.ManifestFormatNames(), cmd.String("manifest-format")) {
+		return nil, fmt.Errorf("%w: unknown manifest format '%s', must be one of %s", ErrConfig, cmd.String("manifest-format"), strings.Join(sorter.ManifestFormatNames(), ", "))
 	}
 
-	return &Config{
+	config := &sorter.Config{
 		SrcDir:    srcDir,
 		DestDir:   destDir,
 		DryRun:    cmd.Bool("dry-run"),
 		Move:      cmd.Bool("move"),
 		Override:  cmd.Bool("override"),
 		Template:  cmd.String("template"),
-		Verbosity: Verbosity(verbosity),
-	}, nil
+		Verbosity: sorter.Verbosity(verbosity),
+		Quiet:     cmd.Bool("quiet"),
+
+		KeepOriginalName:   cmd.Bool("keep-original-name"),
+		StrictTemplate:     cmd.Bool("strict-template"),
+		UnknownArtist:      cmd.String("unknown-artist"),
+		UnknownAlbum:       cmd.String("unknown-album"),
+		UnknownTitle:       cmd.String("unknown-title"),
+		NoMetadataDefaults: cmd.Bool("no-defaults"),
+		MaxFiles:           cmd.Int("max-files"),
+		Force:              cmd.Bool("force"),
+		FuzzySidecars:      cmd.Bool("fuzzy-sidecars"),
+		KeepUnsorted:       cmd.Bool("keep-unsorted"),
+		UnsortedPrefix:     cmd.String("unsorted-prefix"),
+		OnLocked:           onLocked,
+
+		NormalizePunctuation: cmd.Bool("normalize-punctuation"),
+		Manifest:             cmd.String("manifest"),
+		ManifestFormat:       cmd.String("manifest-format"),
+		CheckWritable:        cmd.Bool("check-writable"),
+		SidecarPolicy:        sidecarPolicy,
+		SidecarExtensions:    cmd.StringSlice("sidecar-ext"),
+		FlattenSidecars:      cmd.Bool("flatten-sidecars"),
+		ArtworkTemplate:      cmd.String("artwork-template"),
+		Ledger:               cmd.String("ledger"),
+		MediaPriority:        cmd.StringSlice("media-priority"),
+		MediaSelection:       mediaSelection,
+		Migrate:              cmd.Bool("migrate"),
+		Flatten:              cmd.Bool("flatten"),
+		FlattenIndex:         cmd.String("flatten-index"),
+
+		AlbumArtistFromTracks: cmd.Bool("normalize-album-artist-from-tracks"),
+		CopyNewerSidecarsOnly: cmd.Bool("copy-newer-sidecars-only"),
+		Sanitize:              sanitize,
+		VerifyPlan:            verifyPlan,
+		ReportSkipsAsErrors:   cmd.Bool("report-skips-as-errors"),
+		SummarizeSkips:        cmd.Bool("summarize-skips"),
+		DetectSplits:          cmd.Bool("detect-splits"),
+		SplitSeparator:        cmd.String("split-separator"),
+		NormalizeTrackZero:    cmd.Bool("normalize-track-zero"),
+		OutputEncoding:        outputEncoding,
+		KeepBrackets:          cmd.Bool("keep-brackets"),
+		MaxSegmentLength:      cmd.Int("max-segment-length"),
+		MaxPathLength:         cmd.Int("max-path-length"),
+		OnExists:              onExists,
+		FixExtension:          cmd.Bool("fix-extension"),
+		ExtractLyrics:         cmd.Bool("extract-lyrics"),
+		ExtractArt:            cmd.Bool("extract-art"),
+		Sample:                cmd.Int("sample"),
+		PruneEmpty:            cmd.Bool("prune-empty"),
+		DeleteEmpty:           cmd.Bool("delete"),
+		TrashDir:              cmd.String("trash-dir"),
+		SkipMarker:            cmd.String("skip-marker"),
+		WriteMarker:           cmd.String("write-marker"),
+		Jobs:                  cmd.Int("jobs"),
+		FileTypes:             fileTypes,
+		MinYear:               cmd.Int("min-year"),
+		MaxYear:               cmd.Int("max-year"),
+		MinSize:               minSize,
+		MaxSize:               maxSize,
+		Genre:                 cmd.String("genre"),
+		Include:               cmd.StringSlice("include"),
+		Exclude:               cmd.StringSlice("exclude"),
+		LimitDepth:            cmd.IsSet("max-depth"),
+		FollowSymlinks:        cmd.Bool("follow-symlinks"),
+		KeepGoing:             cmd.Bool("keep-going"),
+		NormalizeUnicode:      cmd.Bool("normalize-unicode"),
+		Separator:             cmd.String("separator"),
+		AtomicGroup:           cmd.Bool("atomic-group"),
+		Verify:                cmd.Bool("verify"),
+		MaxDepth:              cmd.Int("max-depth"),
+		LogFile:               cmd.String("log-file"),
+		// A counter is only useful when someone watches the output
+		Progress: cmd.Bool("progress") && isTerminal(os.Stdout),
+		Summary:  true,
+	}
+
+	if cmd.Bool("confirm") {
+		config.Confirm = confirm
+	}
+
+	// Migrating moves files inside the source directory and is a dry run unless explicitly applied
+	if config.Migrate {
+		config.DestDir = srcDir
+		config.Move = true
+		config.DryRun = !cmd.Bool("apply") && !cmd.Bool("confirm")
+	}
+
+	return config, nil
 }
 
-func createOutputWriter(config *Config) *OutputWriter {
-	outputWriter := &OutputWriter{Quiet}
-	if config.Verbosity == Verbose {
-		outputWriter.Verbosity = Verbose
-	} else if config.Verbosity >= Debug {
-		outputWriter.Verbosity = Debug
+// sizeFlag returns the size of the flag in bytes, or 0 if the flag is not set
+func sizeFlag(cmd *cli.Command, name string) (int64, error) {
+	if !cmd.IsSet(name) {
+		return 0, nil
 	}
-	return outputWriter
-}
-
-func determineFileProcessor(config *Config, outputWriter *OutputWriter) FileProcessor {
-	var fileProcessor = CopyFile
-	if config.Move {
-		if config.DryRun {
-			outputWriter.Warn("Dry run mode is not compatible with move operation, no files will be moved")
-		}
-		fileProcessor = MoveFile
-	}
-	if config.DryRun {
-		fileProcessor = DryRunFileProcessor
-		// Dry run mode should always be verbose to show what would happen
-		if config.Verbosity < Verbose {
-			outputWriter.Verbosity = Verbose
-		}
+	size, err := sorter.ParseSize(cmd.String(name))
+	if err != nil {
+		return 0, fmt.Errorf("%w: --%s: %v", ErrConfig, name, err)
 	}
-	return fileProcessor
+	return size, nil
 }
 
-func determineOverrideChecker(config *Config) OverrideChecker {
-	var overrideChecker OverrideChecker = &NoOverrideChecker{}
-	if config.Override {
-		overrideChecker = &MemoryOverrideChecker{SeenFiles: make(map[string]struct{})}
-	}
-	return overrideChecker
+// isTerminal returns true if the file is a terminal and not a pipe or a regular file
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
 }
 
-func createPathTemplate(templatePath string) (*template.Template, error) {
-	var templateStr = defaultPathTemplate
-	if templatePath != "" {
-		templateFileContents, err := os.ReadFile(templatePath)
-		if err != nil {
-			return nil, fmt.Errorf("error reading template file %s: %v", templatePath, err)
-		}
-		templateStr = string(templateFileContents)
-	}
-
-	pathTemplate, err := template.New("path").Funcs(template.FuncMap{
-		// Path separator function to make the separator more visible in templates than a simple "/"
-		"pathSep":           func() string { return "/" },
-		"replaceInBrackets": ReplaceInBrackets,
-		"removeBrackets":    RemoveBrackets,
-		// TODO add more custom functions for normalizing names:
-		// - underscores instead of spaces
-		// - transform unicode
-		// - etc
-	}).Parse(templateStr)
-	if err != nil {
-		return nil, fmt.Errorf("error parsing template: %v", err)
-	}
-	// Check if template is valid by executing it with a dummy Metadata struct
-	if err := pathTemplate.Execute(io.Discard, &Metadata{}); err != nil {
-		return nil, fmt.Errorf("error executing template: %v", err)
-	}
-
-	return pathTemplate, nil
+// confirm asks a yes/no question on the terminal, the default answer is no
+func confirm(question string) bool {
+	fmt.Printf("%s [y/N] ", question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
 }
 
-func createMediaSorter(config *Config) (*MediaSorter, error) {
-	outputWriter := createOutputWriter(config)
-	fileProcessor := determineFileProcessor(config, outputWriter)
-	overrideChecker := determineOverrideChecker(config)
-
-	pathTemplate, err := createPathTemplate(config.Template)
-	if err != nil {
-		return nil, err
+func run(_ context.Context, cmd *cli.Command, verbosity *int) error {
+	if err := applyConfigFile(cmd); err != nil {
+		return err
 	}
 
-	return &MediaSorter{
-		DestDir:         config.DestDir,
-		PathTemplate:    pathTemplate,
-		FileProcessor:   fileProcessor,
-		MetadataReader:  &MetaDataReader{outputWriter},
-		OverrideChecker: overrideChecker,
-		OutputWriter:    outputWriter,
-	}, nil
-}
-
-func validatePaths(srcPath, destPath string) error {
-	// Check source exists and get its info
-	fi, err := os.Stat(srcPath)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return fmt.Errorf("source directory %s does not exist", srcPath)
+	if templatePath := cmd.String("init-template"); templatePath != "" {
+		err := sorter.InitTemplate(templatePath, cmd.Bool("override"))
+		if errors.Is(err, fs.ErrExist) {
+			return fmt.Errorf("%w: template file %s already exists, use --override to overwrite it", ErrConfig, templatePath)
 		}
-		return fmt.Errorf("error getting file system information for source directory %s: %w", srcPath, err)
-	}
-
-	// Determine source directory path for comparison
-	var srcDirPath string
-	if fi.IsDir() {
-		srcDirPath = srcPath
-	} else {
-		srcDirPath = filepath.Dir(srcPath)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Wrote the default template to %s\n", templatePath)
+		return nil
 	}
 
-	// Check path relationships
-	absSrcDir, err := filepath.Abs(srcDirPath)
+	config, err := buildConfig(cmd, *verbosity)
 	if err != nil {
-		return fmt.Errorf("error resolving absolute path for source directory %s: %w", srcDirPath, err)
-	}
-	absDestDir, err := filepath.Abs(destPath)
-	if err != nil {
-		return fmt.Errorf("error resolving absolute path for destination directory %s: %w", destPath, err)
+		return err
 	}
 
-	rel, err := filepath.Rel(absSrcDir, absDestDir)
-	if err != nil {
-		return fmt.Errorf("error determining relative path from source to destination: %w", err)
-	}
-	if rel == "." {
-		return fmt.Errorf("source and destination directories are the same: %s", absSrcDir)
+	mediaSorter, err := sorter.New(config)
+	if errors.Is(err, sorter.ErrEmptyTemplate) {
+		return fmt.Errorf("%w: %v", ErrConfig, err)
 	}
-	if !strings.HasPrefix(rel, "..") {
-		return fmt.Errorf("destination directory %s is inside source directory %s", absDestDir, absSrcDir)
-	}
-
-	// Check if destination directory exists and is a directory
-	destFi, err := os.Stat(destPath)
 	if err != nil {
-		if !os.IsNotExist(err) {
-			return fmt.Errorf("error getting file system information for destination directory %s: %w", destPath, err)
-		}
-		// Destination doesn't exist, which is fine - it will be created
-	} else if !destFi.IsDir() {
-		return fmt.Errorf("destination %s is not a directory", destPath)
-	}
-
-	return nil
-}
-
-func processInput(srcDir string, mediaSorter *MediaSorter) error {
-	if err := validatePaths(srcDir, mediaSorter.DestDir); err != nil {
 		return err
 	}
 
-	fi, err := os.Stat(srcDir)
-	if err != nil {
-		return err // Should not happen after validatePaths, but we have to handle errors
-	}
-
-	if fi.IsDir() {
-		return mediaSorter.Sort(srcDir)
+	if cmd.Bool("from-stdin") {
+		err = mediaSorter.RunFileList(os.Stdin)
+	} else {
+		err = mediaSorter.Run(config.SrcDir)
 	}
-
-	// Process single file
-	fg, err := mediaSorter.MetadataReader.GetFileGroup([]string{srcDir})
-	if err != nil {
-		return err
+	if closeErr := mediaSorter.Close(); closeErr != nil && err == nil {
+		err = closeErr
 	}
-	return mediaSorter.ProcessFileGroup(fg)
+	return withFlagHint(err)
 }
 
-func run(_ context.Context, cmd *cli.Command, verbosity int) error {
-	config, err := buildConfig(cmd, verbosity)
-	if err != nil {
-		return err
+// withFlagHint adds the command line flag that solves the error to the errors of the sorter
+func withFlagHint(err error) error {
+	if errors.Is(err, sorter.ErrTooManyFiles) {
+		return fmt.Errorf("%w. Use --force to process them anyway", err)
 	}
-
-	mediaSorter, err := createMediaSorter(config)
-	if err != nil {
-		return err
+	if errors.Is(err, sorter.ErrNotADirectory) {
+		return fmt.Errorf("%w, or use --force to move it aside", err)
 	}
-
-	return processInput(config.SrcDir, mediaSorter)
+	return err
 }
 
 func main() {
@@ -464,16 +397,338 @@ func main() {
 				Aliases: []string{"m"},
 				Usage:   "Move files instead of copying",
 			},
+			&cli.StringFlag{
+				Name:    "on-exists",
+				Aliases: []string{"on-collision"},
+				Value:   string(sorter.OverwriteExisting),
+				Usage:   "What to do when a destination file exists: skip, rename, overwrite, update (overwrite older files), identical (skip files with the same content) or dedupe (skip files with the same content, rename the others)",
+			},
 			&cli.BoolFlag{
 				Name:  "override",
-				Usage: "Override existing files",
+				Usage: "Deprecated, same as --on-exists=overwrite, but keeps the first of several source files with the same destination",
+			},
+			&cli.BoolFlag{
+				Name:  "migrate",
+				Usage: "Re-sort the source directory in place with a new template. This is a dry run unless you add --apply",
+			},
+			&cli.BoolFlag{
+				Name:  "confirm",
+				Usage: "Show the destinations of all files and ask before copying or moving them",
+			},
+			&cli.BoolFlag{
+				Name:  "apply",
+				Usage: "Move the files when using --migrate",
+			},
+			&cli.BoolFlag{
+				Name:  "skip-up-to-date",
+				Usage: "Skip files where the destination exists and is at least as new as the source, same as --on-exists=update",
+			},
+			&cli.BoolFlag{
+				Name:  "dedupe",
+				Usage: "Same as --on-exists=dedupe",
+			},
+			&cli.StringFlag{
+				Name:  "verify-plan",
+				Usage: "Check all destinations before processing files and show files with the same destination. 'warn' continues, 'abort' stops without processing any files",
+			},
+			&cli.BoolFlag{
+				Name:  "check-collisions",
+				Usage: "Show all files with the same destination and stop without processing any files, the same as --verify-plan=abort",
+			},
+			&cli.BoolFlag{
+				Name:  "report-skips-as-errors",
+				Usage: "Exit with an error after processing all files, if files were skipped because of missing tags, collisions or other problems",
+			},
+			&cli.BoolFlag{
+				Name:  "summarize-skips",
+				Usage: "List files without tags and non-media files at the end, instead of a warning for each file",
+			},
+			&cli.StringFlag{
+				Name:  "ledger",
+				Usage: "File for recording destination paths, to avoid writing the same destination in concurrent or later runs",
 			},
 			&cli.StringFlag{
 				Name:    "template",
 				Aliases: []string{"t"},
 				Usage:   "Path to a Go template for new file names, with placeholders for metadata",
 			},
+			&cli.StringFlag{
+				Name:  "init-template",
+				Usage: "Write the default template into this file as a starting point for a custom template, and exit",
+			},
+			&cli.StringFlag{
+				Name:  "separator",
+				Usage: "Text of the pathSep template function, e.g. ' - ' for putting the parts of the template into the file name. Slashes in the template still create directories",
+			},
+			&cli.BoolFlag{
+				Name:  "flatten",
+				Usage: "Put all files into the destination directory, joining the directories of the template into the file name",
+			},
+			&cli.StringFlag{
+				Name:  "flatten-index",
+				Value: sorter.DefaultFlattenIndex,
+				Usage: "Go template for a sort index that --flatten puts in front of the last part of the file name",
+			},
+			&cli.BoolFlag{
+				Name:  "fix-extension",
+				Usage: "Change the extension of media files that don't match their format, e.g. '.mp3' to '.flac' for FLAC files",
+			},
+			&cli.BoolFlag{
+				Name:  "keep-original-name",
+				Usage: "Append the original file name to the new file name",
+			},
+			&cli.BoolFlag{
+				Name:  "strict-template",
+				Usage: "Skip files where an empty metadata field would end up in the path",
+			},
+			&cli.StringFlag{
+				Name:  "unknown-artist",
+				Value: sorter.DefaultUnknownArtist,
+				Usage: "Artist in the destination path of files without artist",
+			},
+			&cli.StringFlag{
+				Name:  "unknown-album",
+				Value: sorter.DefaultUnknownAlbum,
+				Usage: "Album in the destination path of files without album",
+			},
+			&cli.StringFlag{
+				Name:  "unknown-title",
+				Usage: "Title in the destination path of files without title (default: name of the source file)",
+			},
+			&cli.BoolFlag{
+				Name:  "no-defaults",
+				Usage: "Leave artist, album and title empty in the destination path of files without them, instead of using --unknown-artist, --unknown-album and --unknown-title",
+			},
+			&cli.BoolFlag{
+				Name:  "prune-empty",
+				Usage: "Move source directories that are empty after moving the files into the trash directory",
+			},
+			&cli.StringFlag{
+				Name:  "trash-dir",
+				Usage: "Directory for empty source directories, default is " + sorter.DefaultTrashDirName + " in the source directory",
+			},
+			&cli.BoolFlag{
+				Name:  "delete",
+				Usage: "Delete empty source directories permanently instead of moving them into the trash directory",
+			},
+			&cli.StringFlag{
+				Name:  "skip-marker",
+				Usage: "Skip media files where the MEDIASORTER tag has this value, because they are already sorted",
+			},
+			&cli.StringFlag{
+				Name:  "write-marker",
+				Usage: "Write this value into the MEDIASORTER tag of the processed FLAC and MP3 files",
+			},
+			&cli.StringSliceFlag{
+				Name:  "type",
+				Usage: "Only process media files of this type, e.g. 'flac'. Repeat the flag for several types",
+			},
+			&cli.IntFlag{
+				Name:  "min-year",
+				Usage: "Only process media files from this year or later",
+			},
+			&cli.IntFlag{
+				Name:  "max-year",
+				Usage: "Only process media files from this year or earlier",
+			},
+			&cli.StringFlag{
+				Name:  "min-size",
+				Usage: "Only process media files of at least this size, e.g. '500KB' or '5MiB'",
+			},
+			&cli.StringFlag{
+				Name:  "max-size",
+				Usage: "Only process media files of at most this size, e.g. '2GB'",
+			},
+			&cli.StringFlag{
+				Name:  "genre",
+				Usage: "Only process media files where the genre contains this text, ignoring case",
+			},
+			&cli.StringSliceFlag{
+				Name:  "include",
+				Usage: "Only process source files whose name matches this glob pattern, e.g. '*.flac'. Repeat the flag for several patterns",
+			},
+			&cli.StringSliceFlag{
+				Name:  "exclude",
+				Usage: "Ignore source files whose name matches this glob pattern, e.g. '*.m3u', even if they match --include. Repeat the flag for several patterns",
+			},
+			&cli.IntFlag{
+				Name:  "sample",
+				Usage: "Check the template with this many randomly selected media files, without processing any files",
+			},
+			&cli.StringFlag{
+				Name:  "log-file",
+				Usage: "Also write all messages into this file, adding them to the end of an existing file",
+			},
+			&cli.BoolFlag{
+				Name:  "progress",
+				Usage: "Show a counter like [12/340] for each processed file, when the output is a terminal",
+			},
+			&cli.IntFlag{
+				Name:  "jobs",
+				Value: 1,
+				Usage: "Number of files to copy or move at the same time",
+			},
+			&cli.BoolFlag{
+				Name:  "verify",
+				Usage: "Read each copied file again and compare its checksum with the source, before deleting the source when moving",
+			},
+			&cli.BoolFlag{
+				Name:  "atomic-group",
+				Usage: "Undo the media file and the other sidecar files when processing one file of a group fails",
+			},
+			&cli.BoolFlag{
+				Name:  "keep-going",
+				Usage: "Continue with the other files after an error, and report all errors at the end",
+			},
+			&cli.IntFlag{
+				Name:  "max-depth",
+				Usage: "Only descend this many levels of subdirectories into the source directory, 0 means only the source directory itself. Default is no limit",
+			},
+			&cli.BoolFlag{
+				Name:  "follow-symlinks",
+				Usage: "Descend into symbolic links to directories in the source directory",
+			},
+			&cli.BoolFlag{
+				Name:  "from-stdin",
+				Usage: "Read the paths of the source files from stdin, one per line, instead of walking a source directory",
+			},
+			&cli.IntFlag{
+				Name:  "max-files",
+				Value: 10000,
+				Usage: "Abort if the source directory contains more files than this, 0 means no limit",
+			},
+			&cli.BoolFlag{
+				Name:  "force",
+				Usage: "Process all files, even if there are more than --max-files, and move files aside that are in the way of destination directories",
+			},
+			&cli.BoolFlag{
+				Name:  "fuzzy-sidecars",
+				Usage: "Treat files with similar names as sidecar files, e.g. 'track (1).lrc' for 'track.flac'",
+			},
+			&cli.BoolFlag{
+				Name:  "flatten-sidecars",
+				Usage: "Put image sidecar files into a separate place, determined by --artwork-template",
+			},
+			&cli.StringFlag{
+				Name:  "artwork-template",
+				Value: sorter.DefaultArtworkTemplate,
+				Usage: "Go template for image sidecar files with --flatten-sidecars, without file extension",
+			},
+			&cli.StringSliceFlag{
+				Name:  "media-priority",
+				Value: sorter.DefaultMediaPriority,
+				Usage: "File extensions in order of preference, for choosing the media file when files with the same name are all media files",
+			},
+			&cli.StringFlag{
+				Name:  "media-selection",
+				Value: string(sorter.SelectByPriority),
+				Usage: "How to choose the media file when files with the same name are all media files: priority (see --media-priority), tags (most metadata) or size (largest file)",
+			},
+			&cli.StringSliceFlag{
+				Name:  "sidecar-policy",
+				Usage: "What to do with sidecar files of a file type, in the form FILETYPE:EXTENSION=ACTION, e.g. 'mp3:lrc=skip'. Actions are copy, skip and embed",
+			},
+			&cli.StringSliceFlag{
+				Name:  "sidecar-ext",
+				Usage: "Only copy or move sidecar files with this extension, e.g. 'cue', and skip all others. Repeat the flag for several extensions",
+			},
+			&cli.BoolFlag{
+				Name:  "copy-newer-sidecars-only",
+				Usage: "Only copy sidecar files that are newer than their destination, even if the media file is skipped",
+			},
+			&cli.BoolFlag{
+				Name:  "extract-lyrics",
+				Usage: "Write embedded lyrics into a .lrc file next to the media file, if there is no .lrc file",
+			},
+			&cli.BoolFlag{
+				Name:  "extract-art",
+				Usage: "Write the embedded artwork into a cover file in each album directory, e.g. cover.jpg",
+			},
+			&cli.BoolFlag{
+				Name:  "keep-unsorted",
+				Usage: "Copy or move files that can't be sorted into a subdirectory of the destination, preserving their source path",
+			},
+			&cli.StringFlag{
+				Name:  "unsorted-prefix",
+				Value: "_unsorted",
+				Usage: "Name of the destination subdirectory for --keep-unsorted",
+			},
+			&cli.StringFlag{
+				Name:  "on-locked",
+				Value: string(sorter.SkipLockedFiles),
+				Usage: "What to do with files that are locked by another program (Windows only): skip, retry or fail",
+			},
+			&cli.StringFlag{
+				Name:  "sanitize",
+				Value: string(sorter.DefaultSanitizeLevel),
+				Usage: "Which characters to replace in file names, depending on the file system of the destination: " + strings.Join(sorter.SanitizeLevelNames(), ", "),
+			},
+			&cli.StringFlag{
+				Name:  "fs-profile",
+				Usage: "File system of the destination, instead of --sanitize: " + strings.Join(sorter.FilesystemProfileNames(), ", "),
+			},
+			&cli.StringFlag{
+				Name:  "output-encoding",
+				Value: string(sorter.UTF8Encoding),
+				Usage: "Characters in destination file names: utf8, or ascii to transliterate all names to ASCII",
+			},
+			&cli.BoolFlag{
+				Name:  "normalize-unicode",
+				Usage: "Compose letters with accents in file names to the NFC form of Unicode, e.g. for metadata from macOS",
+			},
+			&cli.BoolFlag{
+				Name:  "keep-brackets",
+				Usage: "Keep brackets in file names, like 'Song (Live)', instead of replacing them with dashes",
+			},
+			&cli.IntFlag{
+				Name:  "max-segment-length",
+				Usage: "Maximum length of each file and directory name in bytes, instead of the length of the --sanitize level",
+			},
+			&cli.IntFlag{
+				Name:  "max-path-length",
+				Usage: "Skip files whose absolute destination path is longer than this many characters. 0 means 259 on Windows and no limit on other platforms, -1 means no limit",
+			},
+			&cli.BoolFlag{
+				Name:  "normalize-album-artist-from-tracks",
+				Usage: "Fill missing album artists with the artist of the album tracks, or 'Various Artists' if they differ",
+			},
+			&cli.BoolFlag{
+				Name:  "detect-splits",
+				Usage: "Use both artists as album artist for albums where two artists share the tracks, e.g. 'Artist1 & Artist2'",
+			},
+			&cli.StringFlag{
+				Name:  "split-separator",
+				Value: sorter.DefaultSplitSeparator,
+				Usage: "Separator between the artists of split albums with --detect-splits",
+			},
+			&cli.BoolFlag{
+				Name:  "normalize-track-zero",
+				Usage: "Keep track number 0 for files that have a track number tag, e.g. hidden tracks, instead of treating it as missing",
+			},
+			&cli.BoolFlag{
+				Name:  "normalize-punctuation",
+				Usage: "Replace full-width characters, typographic quotes and dashes in metadata with ASCII characters",
+			},
+			&cli.StringFlag{
+				Name:    "manifest",
+				Aliases: []string{"report"},
+				Usage:   "Write a manifest of all file actions, including skipped files, to this file",
+			},
+			&cli.StringFlag{
+				Name:  "manifest-format",
+				Value: "json",
+				Usage: "Format of the manifest file: " + strings.Join(sorter.ManifestFormatNames(), ", "),
+			},
 
+			&cli.StringFlag{
+				Name:  "config",
+				Usage: "Read default values for the flags from this TOML file, default is " + defaultConfigFile + " in the user config directory",
+			},
+			&cli.BoolFlag{
+				Name:    "quiet",
+				Aliases: []string{"q"},
+				Usage:   "Only display warnings and errors, even in dry-run mode",
+			},
 			&cli.BoolFlag{
 				Name:    "verbose",
 				Aliases: []string{"v"},
@@ -493,7 +748,7 @@ func main() {
 		},
 		ArgsUsage: "<source directory> [destination directory]",
 		Action: func(ctx context.Context, cmd *cli.Command) error {
-			return run(ctx, cmd, verbosity)
+			return run(ctx, cmd, &verbosity)
 		},
 	}
 
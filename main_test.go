@@ -0,0 +1,38 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/gbirke/mediasorter/sorter"
+)
+
+func TestWithFlagHint(t *testing.T) {
+	tests := []struct {
+		description string
+		err         error
+		expected    string
+	}{
+		{"no error", nil, ""},
+		{"other error", errors.New("broken"), "broken"},
+		{"too many files", fmt.Errorf("%w: found 3 files", sorter.ErrTooManyFiles), ". Use --force to process them anyway"},
+		{"not a directory", fmt.Errorf("cannot create directory: %w", sorter.ErrNotADirectory), "or use --force to move it aside"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			err := withFlagHint(test.err)
+			if test.expected == "" {
+				if err != nil {
+					t.Errorf("Expected no error, got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.HasSuffix(err.Error(), test.expected) || !errors.Is(err, test.err) {
+				t.Errorf("Expected error ending with '%s' that wraps '%v', got %v", test.expected, test.err, err)
+			}
+		})
+	}
+}
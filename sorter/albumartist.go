@@ -0,0 +1,113 @@
+package sorter
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Album artist for albums where the tracks have different artists
+const VariousArtists = "Various Artists"
+
+// albumKey identifies an album by the directory of the media file and the album tag
+func albumKey(mediaFile MediaFile, album string) string {
+	return filepath.Dir(string(mediaFile)) + "\x00" + album
+}
+
+// consensusArtist returns the artist if all artists are the same, otherwise VariousArtists.
+// Empty artists don't count, if all artists are empty, it returns an empty string.
+func consensusArtist(artists []string) string {
+	consensus := ""
+	for _, artist := range artists {
+		if artist == "" {
+			continue
+		}
+		if consensus != "" && consensus != artist {
+			return VariousArtists
+		}
+		consensus = artist
+	}
+	return consensus
+}
+
+// DefaultSplitSeparator joins the two artists of a split album
+const DefaultSplitSeparator = " & "
+
+// splitArtists returns the two artists of a split album, ordered by their number of tracks and name.
+// An album is a split if it has exactly two artists and each artist has at least a third of the tracks,
+// otherwise one of the artists is probably a guest.
+func splitArtists(artists []string) ([]string, bool) {
+	counts := make(map[string]int)
+	total := 0
+	for _, artist := range artists {
+		if artist == "" {
+			continue
+		}
+		counts[artist]++
+		total++
+	}
+	if len(counts) != 2 {
+		return nil, false
+	}
+	pair := make([]string, 0, 2)
+	for artist, count := range counts {
+		if count*3 < total {
+			return nil, false
+		}
+		pair = append(pair, artist)
+	}
+	slices.SortFunc(pair, func(a, b string) int {
+		if counts[a] != counts[b] {
+			return counts[b] - counts[a]
+		}
+		return strings.Compare(a, b)
+	})
+	return pair, true
+}
+
+// collectAlbumArtists reads the metadata of all media files and determines an album artist for each album,
+// from the artists of its tracks. ProcessFileGroup uses it for files without album artist.
+func (m *MediaSorter) collectAlbumArtists(mediaGroups map[string]*FileGroup) {
+	albumTrackArtists := make(map[string][]string)
+	for _, group := range mediaGroups {
+		metadata, err := m.MetadataReader.ReadMetadata(group.MediaFile)
+		if err != nil {
+			// ProcessFileGroup will report the error
+			continue
+		}
+		key := albumKey(group.MediaFile, metadata.Album)
+		albumTrackArtists[key] = append(albumTrackArtists[key], metadata.Artist)
+	}
+
+	m.albumArtists = make(map[string]string, len(albumTrackArtists))
+	for key, artists := range albumTrackArtists {
+		if m.SplitSeparator != "" {
+			dir, album, _ := strings.Cut(key, "\x00")
+			if pair, ok := splitArtists(artists); ok {
+				m.OutputWriter.Info(fmt.Sprintf("Album '%s' in %s is a split album of %s", album, dir, strings.Join(pair, " and ")))
+				m.albumArtists[key] = strings.Join(pair, m.SplitSeparator)
+				continue
+			}
+			if consensusArtist(artists) == VariousArtists {
+				m.OutputWriter.Info(fmt.Sprintf("Album '%s' in %s has more than one artist, but is not a split album", album, dir))
+			}
+		}
+		if m.AlbumArtistFromTracks {
+			m.albumArtists[key] = consensusArtist(artists)
+		}
+	}
+}
+
+// fillAlbumArtist sets the album artist from the consensus of the album tracks, if the file has no album artist
+func (m *MediaSorter) fillAlbumArtist(mediaFile MediaFile, metadata *Metadata) {
+	if m.albumArtists == nil || metadata.AlbumArtist != "" {
+		return
+	}
+	albumArtist := m.albumArtists[albumKey(mediaFile, metadata.Album)]
+	if albumArtist == "" {
+		return
+	}
+	m.OutputWriter.Debug(fmt.Sprintf("Using album artist '%s' for %s", albumArtist, mediaFile))
+	metadata.AlbumArtist = albumArtist
+}
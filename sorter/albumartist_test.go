@@ -0,0 +1,110 @@
+package sorter
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConsensusArtist(t *testing.T) {
+	tests := []struct {
+		description string
+		artists     []string
+		expected    string
+	}{
+		{"no artists", nil, ""},
+		{"same artist", []string{"Blur", "Blur", "Blur"}, "Blur"},
+		{"different artists", []string{"Blur", "Oasis"}, VariousArtists},
+		{"empty artists are ignored", []string{"", "Blur", ""}, "Blur"},
+		{"all artists empty", []string{"", ""}, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			actual := consensusArtist(test.artists)
+			if actual != test.expected {
+				t.Errorf("consensusArtist(%q) = %q; want %q", test.artists, actual, test.expected)
+			}
+		})
+	}
+}
+
+func TestFillAlbumArtist(t *testing.T) {
+	m := &MediaSorter{
+		OutputWriter: &OutputWriter{Verbosity: Quiet, Writer: io.Discard},
+		albumArtists: map[string]string{
+			albumKey("music/a/01.mp3", "Compilation"): VariousArtists,
+		},
+	}
+
+	metadata := &Metadata{Album: "Compilation"}
+	m.fillAlbumArtist("music/a/02.mp3", metadata)
+	if metadata.AlbumArtist != VariousArtists {
+		t.Errorf("Expected '%s' but got '%s'", VariousArtists, metadata.AlbumArtist)
+	}
+
+	metadata = &Metadata{Album: "Compilation", AlbumArtist: "DJ"}
+	m.fillAlbumArtist("music/a/02.mp3", metadata)
+	if metadata.AlbumArtist != "DJ" {
+		t.Errorf("Expected existing album artist to be kept, got '%s'", metadata.AlbumArtist)
+	}
+
+	metadata = &Metadata{Album: "Compilation"}
+	m.fillAlbumArtist("music/b/01.mp3", metadata)
+	if metadata.AlbumArtist != "" {
+		t.Errorf("Expected album in other directory to stay empty, got '%s'", metadata.AlbumArtist)
+	}
+}
+
+func TestSplitArtists(t *testing.T) {
+	tests := []struct {
+		description string
+		artists     []string
+		expected    []string
+	}{
+		{"two artists with half of the tracks", []string{"Propagandhi", "I Spy", "Propagandhi", "I Spy"}, []string{"I Spy", "Propagandhi"}},
+		{"artist with more tracks comes first", []string{"B", "A", "B", "B", "A"}, []string{"B", "A"}},
+		{"one artist", []string{"Blur", "Blur"}, nil},
+		{"guest artist", []string{"Blur", "Blur", "Blur", "Blur", "Guest"}, nil},
+		{"three artists", []string{"A", "B", "C"}, nil},
+		{"empty artists are ignored", []string{"A", "", "B"}, []string{"A", "B"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			actual, ok := splitArtists(test.artists)
+			if ok != (test.expected != nil) || strings.Join(actual, ",") != strings.Join(test.expected, ",") {
+				t.Errorf("splitArtists(%q) = %q, %t; want %q", test.artists, actual, ok, test.expected)
+			}
+		})
+	}
+}
+
+func TestCollectAlbumArtistsDetectsSplits(t *testing.T) {
+	dir := t.TempDir()
+	mediaGroups := make(map[string]*FileGroup)
+	for i, artist := range []string{"Artist1", "Artist2", "Artist1", "Artist2"} {
+		path := filepath.Join(dir, fmt.Sprintf("%d.flac", i))
+		if err := os.WriteFile(path, flacStream("TITLE=Title", "ALBUM=Split", "ARTIST="+artist), 0644); err != nil {
+			t.Fatal(err)
+		}
+		mediaGroups[path] = &FileGroup{MediaFile: MediaFile(path)}
+	}
+	outputWriter := &OutputWriter{Verbosity: Quiet, Writer: io.Discard}
+	m := &MediaSorter{
+		OutputWriter:   outputWriter,
+		MetadataReader: &MetaDataReader{OutputWriter: outputWriter},
+		SplitSeparator: " & ",
+	}
+
+	m.collectAlbumArtists(mediaGroups)
+
+	metadata := &Metadata{Album: "Split", Artist: "Artist2"}
+	m.fillAlbumArtist(MediaFile(filepath.Join(dir, "1.flac")), metadata)
+	if metadata.AlbumArtist != "Artist1 & Artist2" {
+		t.Errorf("Expected 'Artist1 & Artist2' but got '%s'", metadata.AlbumArtist)
+	}
+}
@@ -0,0 +1,114 @@
+package sorter
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// OutputEncoding determines which characters are allowed in destination file names
+type OutputEncoding string
+
+const (
+	UTF8Encoding  OutputEncoding = "utf8"
+	ASCIIEncoding OutputEncoding = "ascii"
+)
+
+func ParseOutputEncoding(encoding string) (OutputEncoding, error) {
+	switch OutputEncoding(encoding) {
+	case UTF8Encoding, ASCIIEncoding:
+		return OutputEncoding(encoding), nil
+	}
+	return "", fmt.Errorf("invalid output encoding '%s', must be %s or %s", encoding, UTF8Encoding, ASCIIEncoding)
+}
+
+// Latin letters without a Unicode decomposition into an ASCII letter and diacritics, by their ASCII base letter
+var asciiBaseLetters = map[string]string{
+	"D": "ĐÐ",
+	"d": "đð",
+	"H": "Ħ",
+	"h": "ħ",
+	"i": "ı",
+	"L": "ĿŁ",
+	"l": "ŀł",
+	"O": "Ø",
+	"o": "ø",
+	"T": "Ŧ",
+	"t": "ŧ",
+}
+
+// Letters that are transliterated with more than one ASCII letter
+var asciiLigatures = map[rune]string{
+	'Æ': "AE",
+	'æ': "ae",
+	'Œ': "OE",
+	'œ': "oe",
+	'Ĳ': "IJ",
+	'ĳ': "ij",
+	'ß': "ss",
+	'Þ': "Th",
+	'þ': "th",
+}
+
+var asciiTransliterations = func() map[rune]string {
+	transliterations := make(map[rune]string, len(asciiLigatures))
+	for base, letters := range asciiBaseLetters {
+		for _, letter := range letters {
+			transliterations[letter] = base
+		}
+	}
+	for letter, replacement := range asciiLigatures {
+		transliterations[letter] = replacement
+	}
+	return transliterations
+}()
+
+// asciiFold transliterates text to ASCII, e.g. "Motörhead" to "Motorhead".
+// It drops characters that have no transliteration. It's also the ascii template function.
+func asciiFold(text string) string {
+	var folded strings.Builder
+	for _, r := range normalizePunctuation(text) {
+		replacement, _ := foldRune(r)
+		folded.WriteString(replacement)
+	}
+	return folded.String()
+}
+
+// foldRune returns the ASCII transliteration of the character and whether it has one.
+// Letters with diacritics are decomposed and lose their combining marks, e.g. "ắ" becomes "a".
+func foldRune(r rune) (string, bool) {
+	// Keep the separators of the snake template function, e.g. for {{ ascii (snake .Title) }}
+	if r < 0x80 || string(r) == snakeSeparator {
+		return string(r), true
+	}
+	if replacement, ok := asciiTransliterations[r]; ok {
+		return replacement, true
+	}
+	if unicode.Is(unicode.Mn, r) {
+		return "", true
+	}
+	var base strings.Builder
+	for _, decomposed := range norm.NFD.String(string(r)) {
+		if unicode.Is(unicode.Mn, decomposed) {
+			continue
+		}
+		if decomposed >= 0x80 {
+			return "", false
+		}
+		base.WriteRune(decomposed)
+	}
+	return base.String(), base.Len() > 0
+}
+
+// unfoldableChars returns the characters that asciiFold drops from the text
+func unfoldableChars(text string) []rune {
+	var dropped []rune
+	for _, r := range normalizePunctuation(text) {
+		if _, ok := foldRune(r); !ok {
+			dropped = append(dropped, r)
+		}
+	}
+	return dropped
+}
@@ -0,0 +1,49 @@
+package sorter
+
+import (
+	"testing"
+)
+
+func TestAsciiFold(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"Motörhead", "Motorhead"},
+		{"Sigur Rós – Ágætis byrjun", "Sigur Ros - Agaetis byrjun"},
+		{"Straße", "Strasse"},
+		{"Łódź", "Lodz"},
+		{"Björk’s “Début”", "Bjork's \"Debut\""},
+		{"坂本龍一 Ryuichi", " Ryuichi"},
+		{"plain ASCII", "plain ASCII"},
+		{"Sơn Tùng", "Son Tung"},
+		{"Ǻ ǧ ư ắ", "A g u a"},
+		{"Mo\u0308tley", "Motley"},
+	}
+	for _, test := range tests {
+		result := asciiFold(test.input)
+		if result != test.expected {
+			t.Errorf("asciiFold(%q) = %q; want %q", test.input, result, test.expected)
+		}
+	}
+}
+
+func TestUnfoldableChars(t *testing.T) {
+	if dropped := string(unfoldableChars("Motörhead – 坂本")); dropped != "坂本" {
+		t.Errorf("Expected '坂本' but got '%s'", dropped)
+	}
+	if dropped := unfoldableChars("Sigur Rós"); len(dropped) != 0 {
+		t.Errorf("Expected no dropped characters but got '%s'", string(dropped))
+	}
+}
+
+func TestSanitizerWithASCIIEncoding(t *testing.T) {
+	sanitizer, err := NewSanitizer(WindowsSanitizing, ASCIIEncoding)
+	if err != nil {
+		t.Fatal(err)
+	}
+	actual := sanitizer.cleanPath("Motörhead/坂本 Best/Ace of Spades")
+	if actual != "Motorhead/Best/Ace of Spades" {
+		t.Errorf("Expected 'Motorhead/Best/Ace of Spades' but got '%s'", actual)
+	}
+}
@@ -0,0 +1,127 @@
+package sorter
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// createdFile is a destination file that processing a file group created.
+// The source path is empty for files that were written without a source, like extracted lyrics.
+type createdFile struct {
+	srcPath  string
+	destPath string
+}
+
+// groupTransaction records the files and directories that processing a file group created,
+// for undoing them when processing the group fails. It also records the destinations and
+// artwork that the group claimed in this run, for releasing them to other file groups.
+type groupTransaction struct {
+	files   []createdFile
+	dirs    []string
+	claims  []string
+	artwork []string
+}
+
+// track wraps a FileProcessor to record the files it creates
+func (tx *groupTransaction) track(fileProcessor FileProcessor) FileProcessor {
+	return func(srcPath string, destPath string) error {
+		return tx.create(srcPath, destPath, func() error {
+			return fileProcessor(srcPath, destPath)
+		})
+	}
+}
+
+// create calls the write function and records the destination file if the function created it.
+// Files that overwrite an existing destination are not recorded, removing them would lose the existing file.
+// Without a transaction, it only calls the write function.
+func (tx *groupTransaction) create(srcPath string, destPath string, write func() error) error {
+	if tx == nil {
+		return write()
+	}
+	tx.claims = append(tx.claims, destPath)
+	if _, err := os.Lstat(destPath); err == nil {
+		return write()
+	}
+	// The write function can create the directories and a partial file even if it fails
+	tx.dirs = append(tx.dirs, missingDirs(filepath.Dir(destPath))...)
+	err := write()
+	if _, statErr := os.Lstat(destPath); err == nil || statErr == nil {
+		tx.files = append(tx.files, createdFile{srcPath: srcPath, destPath: destPath})
+	}
+	return err
+}
+
+// claimArtwork records an artwork destination that the file group claimed
+func (tx *groupTransaction) claimArtwork(destPath string) {
+	if tx != nil {
+		tx.artwork = append(tx.artwork, destPath)
+	}
+}
+
+// missingDirs returns the directories of the path that don't exist, the deepest directory first
+func missingDirs(dir string) []string {
+	var missing []string
+	for ; ; dir = filepath.Dir(dir) {
+		if _, err := os.Lstat(dir); !errors.Is(err, os.ErrNotExist) {
+			return missing
+		}
+		missing = append(missing, dir)
+		if parent := filepath.Dir(dir); parent == dir {
+			return missing
+		}
+	}
+}
+
+// rollback removes the created files in reverse order and moves moved files back to their source.
+// Afterwards, it removes the created directories that are empty.
+func (tx *groupTransaction) rollback(outputWriter *OutputWriter) {
+	moveBack := withCopyFallback(MoveFile, CopyFile, outputWriter)
+	for _, file := range slices.Backward(tx.files) {
+		if _, err := os.Lstat(file.srcPath); file.srcPath != "" && errors.Is(err, os.ErrNotExist) {
+			outputWriter.Info(fmt.Sprintf("Rolling back: moving %s back to %s", file.destPath, file.srcPath))
+			if err := moveBack(file.destPath, file.srcPath); err != nil {
+				outputWriter.Warn(fmt.Sprintf("Could not move %s back to %s: %v", file.destPath, file.srcPath, err))
+			}
+			continue
+		}
+		outputWriter.Info(fmt.Sprintf("Rolling back: removing %s", file.destPath))
+		if err := os.Remove(file.destPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			outputWriter.Warn(fmt.Sprintf("Could not remove %s: %v", file.destPath, err))
+		}
+	}
+
+	// Longer paths are deeper, removing them first empties their parents. Directories that
+	// other file groups use in the meantime are not empty, os.Remove doesn't remove them.
+	slices.SortFunc(tx.dirs, func(a, b string) int { return len(b) - len(a) })
+	for _, dir := range slices.Compact(tx.dirs) {
+		_ = os.Remove(dir)
+	}
+}
+
+// claimReleaser is an OverrideChecker that remembers the destinations of this run
+type claimReleaser interface {
+	release(destPath string)
+}
+
+// releaseClaims makes the destinations and artwork that a rolled back file group claimed available to other file groups
+func (m *MediaSorter) releaseClaims(tx *groupTransaction) {
+	m.mu.Lock()
+	for _, destPath := range tx.claims {
+		delete(m.usedDestinations, destPath)
+	}
+	for _, destPath := range tx.artwork {
+		delete(m.artworkDestinations, destPath)
+	}
+	m.mu.Unlock()
+
+	for _, checker := range []OverrideChecker{m.OverrideChecker, m.SidecarOverrideChecker} {
+		if releaser, ok := checker.(claimReleaser); ok {
+			for _, destPath := range tx.claims {
+				releaser.release(destPath)
+			}
+		}
+	}
+}
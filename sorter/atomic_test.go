@@ -0,0 +1,201 @@
+package sorter
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dhowden/tag"
+)
+
+func TestAtomicGroupRollsBackMediaFileWhenSidecarFails(t *testing.T) {
+	errFull := errors.New("disk full")
+	tests := []struct {
+		description string
+		move        bool
+		processor   FileProcessor
+	}{
+		{"copy", false, CopyFile},
+		{"move", true, MoveFile},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			srcDir := t.TempDir()
+			destDir := t.TempDir()
+			mediaPath := filepath.Join(srcDir, "track.flac")
+			if err := os.WriteFile(mediaPath, flacStream("TITLE=Title", "ARTIST=Artist", "ALBUM=Album"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(srcDir, "track.cue"), []byte("cue sheet"), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			mediaSorter, err := New(&Config{DestDir: destDir, Move: test.move, AtomicGroup: true, Output: io.Discard})
+			if err != nil {
+				t.Fatalf("New returned error: %v", err)
+			}
+			mediaSorter.FileProcessor = func(srcPath string, destPath string) error {
+				if filepath.Ext(srcPath) == ".cue" {
+					return errFull
+				}
+				return test.processor(srcPath, destPath)
+			}
+
+			if err := mediaSorter.Run(srcDir); !errors.Is(err, errFull) {
+				t.Fatalf("Expected the error of the sidecar file, got %v", err)
+			}
+			if _, err := os.Stat(filepath.Join(destDir, "Artist", "Album", "Title.flac")); !os.IsNotExist(err) {
+				t.Errorf("Expected the media file to be rolled back, got %v", err)
+			}
+			if _, err := os.Stat(filepath.Join(destDir, "Artist")); !os.IsNotExist(err) {
+				t.Errorf("Expected the created directories to be removed, got %v", err)
+			}
+			if _, err := os.Stat(mediaPath); err != nil {
+				t.Errorf("Expected the media file to be at its source: %v", err)
+			}
+		})
+	}
+}
+
+func TestAtomicGroupKeepsExistingDirectories(t *testing.T) {
+	srcDir := t.TempDir()
+	destDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(srcDir, "track.flac"), flacStream("TITLE=Title", "ARTIST=Artist", "ALBUM=Album"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(srcDir, "track.cue"), []byte("cue sheet"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	artistDir := filepath.Join(destDir, "Artist")
+	if err := os.Mkdir(artistDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	mediaSorter, err := New(&Config{DestDir: destDir, AtomicGroup: true, Output: io.Discard})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	mediaSorter.FileProcessor = func(srcPath string, destPath string) error {
+		if filepath.Ext(srcPath) == ".cue" {
+			return errors.New("disk full")
+		}
+		return CopyFile(srcPath, destPath)
+	}
+
+	if err := mediaSorter.Run(srcDir); err == nil {
+		t.Fatal("Expected Run to return an error")
+	}
+	if _, err := os.Stat(filepath.Join(artistDir, "Album")); !os.IsNotExist(err) {
+		t.Errorf("Expected the album directory to be removed, got %v", err)
+	}
+	if _, err := os.Stat(artistDir); err != nil {
+		t.Errorf("Expected the existing artist directory to stay: %v", err)
+	}
+}
+
+func TestWithoutAtomicGroupKeepsProcessedMediaFile(t *testing.T) {
+	srcDir := t.TempDir()
+	destDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(srcDir, "track.flac"), flacStream("TITLE=Title", "ARTIST=Artist", "ALBUM=Album"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(srcDir, "track.cue"), []byte("cue sheet"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	mediaSorter, err := New(&Config{DestDir: destDir, Output: io.Discard})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	mediaSorter.FileProcessor = func(srcPath string, destPath string) error {
+		if filepath.Ext(srcPath) == ".cue" {
+			return errors.New("disk full")
+		}
+		return CopyFile(srcPath, destPath)
+	}
+
+	if err := mediaSorter.Run(srcDir); err == nil {
+		t.Fatal("Expected Run to return an error")
+	}
+	if _, err := os.Stat(filepath.Join(destDir, "Artist", "Album", "Title.flac")); err != nil {
+		t.Errorf("Expected the media file to stay in the destination: %v", err)
+	}
+}
+
+func TestAtomicGroupRollsBackExtractedFiles(t *testing.T) {
+	srcDir := t.TempDir()
+	destDir := t.TempDir()
+	writeSourceFiles(t, srcDir, map[string][]byte{
+		"track.mp3": id3WithPicture("Artist", "Album", "Title", "image/jpeg", []byte("\xff\xd8\xff\xe0 jpeg data")),
+	})
+
+	mediaSorter, err := New(&Config{DestDir: destDir, AtomicGroup: true, ExtractArt: true, Output: io.Discard})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	errFull := errors.New("disk full")
+	mediaSorter.CoverWriter = func(picture *tag.Picture, destPath string) error {
+		if err := WriteCoverFile(picture, destPath); err != nil {
+			return err
+		}
+		return errFull
+	}
+
+	if err := mediaSorter.Run(srcDir); !errors.Is(err, errFull) {
+		t.Fatalf("Expected the error of the cover file, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(destDir, "Artist")); !os.IsNotExist(err) {
+		t.Errorf("Expected the media file, the cover file and the directories to be rolled back, got %v", err)
+	}
+}
+
+func TestAtomicGroupReleasesClaimsOfRolledBackGroup(t *testing.T) {
+	jpeg := []byte("\xff\xd8\xff\xe0 jpeg data")
+	srcDir := t.TempDir()
+	destDir := t.TempDir()
+	writeSourceFiles(t, srcDir, map[string][]byte{
+		"a.mp3": id3WithPicture("Artist", "Album", "Title", "image/jpeg", jpeg),
+		"a.cue": []byte("cue sheet"),
+		"b.mp3": id3WithPicture("Artist", "Album", "Title", "image/jpeg", jpeg),
+	})
+
+	mediaSorter, err := New(&Config{DestDir: destDir, OnExists: SkipExisting, AtomicGroup: true, ExtractArt: true, Output: io.Discard})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	errFull := errors.New("disk full")
+	mediaSorter.FileProcessor = func(srcPath string, destPath string) error {
+		if filepath.Ext(srcPath) == ".cue" {
+			return errFull
+		}
+		return CopyFile(srcPath, destPath)
+	}
+
+	// Run processes the groups in random order
+	first := &FileGroup{MediaFile: MediaFile(filepath.Join(srcDir, "a.mp3")), SidecarFiles: []string{filepath.Join(srcDir, "a.cue")}}
+	if err := mediaSorter.ProcessFileGroup(first); !errors.Is(err, errFull) {
+		t.Fatalf("Expected the error of the sidecar file, got %v", err)
+	}
+	if err := mediaSorter.ProcessFileGroup(&FileGroup{MediaFile: MediaFile(filepath.Join(srcDir, "b.mp3"))}); err != nil {
+		t.Fatalf("ProcessFileGroup returned error: %v", err)
+	}
+	// The second file gets the destination and the cover that the rolled back group claimed
+	content, err := os.ReadFile(filepath.Join(destDir, "Artist", "Album", "Title.mp3"))
+	if err != nil {
+		t.Fatalf("Expected the second file at the destination: %v", err)
+	}
+	expected, err := os.ReadFile(filepath.Join(srcDir, "b.mp3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(content, expected) {
+		t.Error("Expected the content of the second file")
+	}
+	if _, err := os.Stat(filepath.Join(destDir, "Artist", "Album", "cover.jpg")); err != nil {
+		t.Errorf("Expected the cover of the second file: %v", err)
+	}
+}
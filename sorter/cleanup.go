@@ -0,0 +1,161 @@
+package sorter
+
+import (
+	"regexp"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Cleanup for file and directory names generated from templates
+var spacePattern = regexp.MustCompile(`[_\t\r\n]+`)
+
+var multispacePattern = regexp.MustCompile(`\s+`)
+
+var forbiddenCharPattern = regexp.MustCompile(`[<>:"'/\\|?*\x00-\x1F]`)
+
+var trimPathPattern = regexp.MustCompile(`^[. ]+|[-. ]+$`)
+
+var bracketPattern = regexp.MustCompile(`[\[\](){}]`)
+
+// Typographic characters and their ASCII replacements
+var punctuationReplacer = strings.NewReplacer(
+	"\u2018", "'", // left single quotation mark
+	"\u2019", "'", // right single quotation mark
+	"\u201A", "'", // single low-9 quotation mark
+	"\u201B", "'", // single high-reversed-9 quotation mark
+	"\u2032", "'", // prime
+	"\u201C", "\"", // left double quotation mark
+	"\u201D", "\"", // right double quotation mark
+	"\u201E", "\"", // double low-9 quotation mark
+	"\u201F", "\"", // double high-reversed-9 quotation mark
+	"\u2033", "\"", // double prime
+	"\u00AB", "\"", // left-pointing double angle quotation mark
+	"\u00BB", "\"", // right-pointing double angle quotation mark
+	"\u2010", "-", // hyphen
+	"\u2011", "-", // non-breaking hyphen
+	"\u2012", "-", // figure dash
+	"\u2013", "-", // en dash
+	"\u2014", "-", // em dash
+	"\u2015", "-", // horizontal bar
+	"\u2026", "...", // horizontal ellipsis
+	"\u00A0", " ", // no-break space
+	"\u3000", " ", // ideographic space
+)
+
+// normalizePunctuation replaces full-width ASCII variants with their half-width forms
+// and typographic quotes, dashes and spaces with their ASCII equivalents
+func normalizePunctuation(text string) string {
+	text = strings.Map(func(r rune) rune {
+		// The full-width forms of the printable ASCII characters are in the same order as ASCII
+		if r >= '\uFF01' && r <= '\uFF5E' {
+			return r - '\uFF01' + '!'
+		}
+		return r
+	}, text)
+	return punctuationReplacer.Replace(text)
+}
+
+func (s *Sanitizer) cleanPathSegment(pathSegment string) string {
+	// The index directory of firstLetter is safe on all file systems, it would otherwise become "No"
+	if pathSegment == FirstLetterOther {
+		return pathSegment
+	}
+	if s.normalizeUnicode {
+		pathSegment = norm.NFC.String(pathSegment)
+	}
+	// Clean the words that the snake template function joined separately, to keep the underscores between them
+	var words []string
+	for _, word := range strings.Split(pathSegment, snakeSeparator) {
+		if cleaned := s.cleanText(word); cleaned != "" {
+			words = append(words, cleaned)
+		}
+	}
+	return truncate(strings.Join(words, "_"), s.maxLength)
+}
+
+func (s *Sanitizer) cleanText(pathSegment string) string {
+	if s.asciiOnly {
+		pathSegment = asciiFold(pathSegment)
+	}
+
+	// Remove characters not safe for filenames
+	if !s.replaceSpecialChars {
+		cleaned := s.forbiddenChars.ReplaceAllString(pathSegment, " ")
+		cleaned = multispacePattern.ReplaceAllString(cleaned, " ")
+		return trimPathPattern.ReplaceAllString(cleaned, "")
+	}
+
+	// Keep letters, digits, some punctuation, spaces, dashes and underscores
+	cleaned := s.forbiddenChars.ReplaceAllString(pathSegment, "_")
+
+	// Replace "special notifiers" in brackets like "(Explicit)" with safer delimiters
+	if !s.keepBrackets {
+		cleaned = bracketPattern.ReplaceAllString(cleaned, " - ")
+	}
+
+	// Shell-awkward characters
+	cleaned = strings.ReplaceAll(cleaned, "`", "")    // Remove backticks
+	cleaned = strings.ReplaceAll(cleaned, "&", "and") // Replace ampersand
+	cleaned = strings.ReplaceAll(cleaned, "#", "No")  // Replace hash
+
+	// Collapse multiple underscores/spaces
+	cleaned = spacePattern.ReplaceAllString(cleaned, " ")
+	cleaned = multispacePattern.ReplaceAllString(cleaned, " ")
+
+	// Trim leading/trailing spaces and dots
+	// Trimming leading dots avoids hidden file and path traversal
+	// Trimming trailing dots avoids weird-looking file names
+	return trimPathPattern.ReplaceAllString(cleaned, "")
+}
+
+func (s *Sanitizer) cleanPath(path string) string {
+	segments := strings.Split(path, "/")
+	newSegments := make([]string, len(segments))
+	for _, segment := range segments {
+		cleanSegment := s.cleanPathSegment(segment)
+		if cleanSegment != "" {
+			newSegments = append(newSegments, cleanSegment)
+		}
+	}
+
+	cleanedPath := strings.Join(newSegments, "/")
+
+	// Avoid absolute paths, paths must always be relative and a file name
+	cleanedPath = strings.Trim(cleanedPath, "/")
+	return cleanedPath
+}
+
+// splitName splits a cleaned path into its directories, with a trailing slash, and its last segment
+func splitName(path string) (string, string) {
+	if i := strings.LastIndex(path, "/"); i >= 0 {
+		return path[:i+1], path[i+1:]
+	}
+	return "", path
+}
+
+// appendToName appends a cleaned suffix to the last segment of a cleaned path.
+// It shortens the segment so it stays within the maximum length together with the suffix.
+func (s *Sanitizer) appendToName(path string, suffix string) string {
+	dir, name := splitName(path)
+	name = truncate(name, max(s.maxLength-len(suffix), 0))
+	return dir + strings.TrimLeft(name+suffix, " ")
+}
+
+// shortenName shortens the last segment of a cleaned path, to keep room for an extension of extLength bytes
+func (s *Sanitizer) shortenName(path string, extLength int) string {
+	dir, name := splitName(path)
+	return dir + truncate(name, max(s.maxLength-extLength, 0))
+}
+
+// flattenPath joins the segments of a cleaned path into a single file name.
+// If the index is not empty, it goes in front of the last segment, to keep tracks in order.
+func (s *Sanitizer) flattenPath(path string, index string) string {
+	segments := strings.Split(path, "/")
+	index = s.cleanPathSegment(index)
+	if index != "" {
+		last := len(segments) - 1
+		segments = append(segments[:last], index, segments[last])
+	}
+	return strings.Join(segments, " - ")
+}
@@ -0,0 +1,170 @@
+package sorter
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCleanPathSegment(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"valid_name", "valid name"},
+		{"invalid/name", "invalid name"},
+		{"with spaces", "with spaces"},
+		{" trailing_spaces ", "trailing spaces"},
+		{"with   multiple   spaces", "with multiple spaces"},
+		{"with_underscores_and_spaces", "with underscores and spaces"},
+		{"\nwhitespace\tcharacters trailing\r\n", "whitespace characters trailing"},
+		{"whitespace\t\r\ninside", "whitespace inside"},
+		// Testing bracket handling at the end of segments
+		{"(Explicit)", "- Explicit"},
+		{"Copkiller (Explicit)", "Copkiller - Explicit"},
+		{"[Album Title]", "- Album Title"},
+		// Leading and traing slashes
+		{".hidden_file", "hidden file"},
+		{"../escaped/.hidden_file", "escaped .hidden file"},
+		// special characters
+		{"The Path separators: \\/", "The Path separators"},
+		{"The shell busters: *\"'?\x01", "The shell busters"},
+		// Special replacements
+		{"Adam & the Ants", "Adam and the Ants"},
+		{"Song #1", "Song No1"},
+		{strings.Repeat("a", 300), strings.Repeat("a", 255)}, // Test for max length
+	}
+	for _, test := range tests {
+		result := sanitizers[WindowsSanitizing].cleanPathSegment(test.input)
+		if result != test.expected {
+			t.Errorf("Expected '%s' but got '%s'", test.expected, result)
+		}
+	}
+}
+
+func TestCleanPath(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"valid/name/structure", "valid/name/structure"},
+		{"invalid/name/with/forbidden<chars>", "invalid/name/with/forbidden chars"},
+		{"with/multiple/slashes//and/spaces", "with/multiple/slashes/and/spaces"},
+		{"/absolute/path", "absolute/path"},
+		{"trailing/slash/", "trailing/slash"},
+		{"hidden/.file", "hidden/file"},
+		{"../path/traversal/../impossible/", "path/traversal/impossible"},
+	}
+	for _, test := range tests {
+		result := sanitizers[WindowsSanitizing].cleanPath(test.input)
+		if result != test.expected {
+			t.Errorf("Expected '%s' but got '%s'", test.expected, result)
+		}
+	}
+}
+
+func TestNormalizePunctuation(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"Song’s Title", "Song's Title"},
+		{"“Quoted” and „German“", "\"Quoted\" and \"German\""},
+		{"Track：Ｐａｒｔ１", "Track:Part1"},
+		{"Full-width　space", "Full-width space"},
+		{"Rock – Live — 1999…", "Rock - Live - 1999..."},
+		{"ＡＢＣ／ＸＹＺ", "ABC/XYZ"},
+		{"Ünïcödé stays", "Ünïcödé stays"},
+	}
+	for _, test := range tests {
+		result := normalizePunctuation(test.input)
+		if result != test.expected {
+			t.Errorf("Expected '%s' but got '%s'", test.expected, result)
+		}
+	}
+}
+
+func TestFlattenPath(t *testing.T) {
+	tests := []struct {
+		path     string
+		index    string
+		expected string
+	}{
+		{"Artist/Album/Title", "", "Artist - Album - Title"},
+		{"Artist/Album/Title", "01", "Artist - Album - 01 - Title"},
+		{"Artist/Album/Title", "2-01", "Artist - Album - 2-01 - Title"},
+		{"Title", "01", "01 - Title"},
+		{"Artist/Title", " / ", "Artist - Title"},
+	}
+	for _, test := range tests {
+		result := sanitizers[WindowsSanitizing].flattenPath(test.path, test.index)
+		if result != test.expected {
+			t.Errorf("Expected '%s' but got '%s'", test.expected, result)
+		}
+	}
+}
+
+func TestAppendToName(t *testing.T) {
+	sanitizer := &Sanitizer{maxLength: 20}
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"Artist/Title", "Artist/Title [orig_x]"},
+		{"Title", "Title [orig_x]"},
+		{"Artist/A very long title", "Artist/A very long [orig_x]"},
+		{"Artist/A very long. title", "Artist/A very long [orig_x]"},
+		{"Artist/", "Artist/[orig_x]"},
+	}
+	for _, test := range tests {
+		if result := sanitizer.appendToName(test.path, " [orig_x]"); result != test.expected {
+			t.Errorf("Expected '%s' but got '%s'", test.expected, result)
+		}
+	}
+}
+
+func TestShortenName(t *testing.T) {
+	sanitizer := &Sanitizer{maxLength: 12}
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"Artist/Title", "Artist/Title"},
+		{"Artist/Long Title", "Artist/Long Ti"},
+		{"Artist/Title. Live", "Artist/Title"},
+		{"Title. Live", "Title"},
+	}
+	for _, test := range tests {
+		if result := sanitizer.shortenName(test.path, 5); result != test.expected {
+			t.Errorf("Expected '%s' but got '%s'", test.expected, result)
+		}
+	}
+}
+
+func TestSanitizerNormalizesUnicode(t *testing.T) {
+	tests := []struct {
+		name             string
+		normalizeUnicode bool
+		input            string
+		expected         string
+	}{
+		{"off", false, "Beyonce\u0301 - Halo", "Beyonce\u0301 - Halo"},
+		{"acute accent", true, "Beyonce\u0301 - Halo", "Beyonc\u00e9 - Halo"},
+		{"two marks in any order", true, "Vie\u0302\u0323t Nam", "Vi\u1ec7t Nam"},
+		{"composed letter and mark", true, "\u00e9\u0323", "\u1eb9\u0301"},
+		{"arabic", true, "\u0627\u0653", "\u0622"},
+		{"kana", true, "\u304b\u3099", "\u304c"},
+		{"hangul", true, "\u1100\u1161\u11a8", "\uac01"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sanitizer, err := NewSanitizer(WindowsSanitizing, UTF8Encoding)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sanitizer.normalizeUnicode = test.normalizeUnicode
+			if result := sanitizer.cleanPathSegment(test.input); result != test.expected {
+				t.Errorf("Expected %+q but got %+q", test.expected, result)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package sorter
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dhowden/tag"
+)
+
+// coverName is the file name of extracted artwork in the album directory, without extension
+const coverName = "cover"
+
+// coverExtensions maps the MIME types of embedded pictures to the extension of the cover file
+var coverExtensions = map[string]string{
+	"image/jpeg": "jpg",
+	"image/jpg":  "jpg",
+	"image/png":  "png",
+	"image/gif":  "gif",
+	"image/bmp":  "bmp",
+	"image/webp": "webp",
+}
+
+// CoverWriter writes an embedded picture into a file
+type CoverWriter func(picture *tag.Picture, destPath string) error
+
+func DryRunCoverWriter(picture *tag.Picture, destPath string) error {
+	return nil
+}
+
+func WriteCoverFile(picture *tag.Picture, destPath string) error {
+	if err := createDestinationDir(destPath); err != nil {
+		return err
+	}
+	if err := os.WriteFile(destPath, picture.Data, 0644); err != nil {
+		return fmt.Errorf("error writing cover to %s: %w", destPath, err)
+	}
+	return nil
+}
+
+// coverExtension returns the file extension for an embedded picture, or an empty string for unknown image formats
+func coverExtension(picture *tag.Picture) string {
+	mimeType, _, _ := strings.Cut(strings.ToLower(picture.MIMEType), ";")
+	if ext, ok := coverExtensions[strings.TrimSpace(mimeType)]; ok {
+		return ext
+	}
+	// ID3v2.2 tags only have an extension, like "JPG"
+	ext := strings.ToLower(picture.Ext)
+	for _, known := range coverExtensions {
+		if ext == known {
+			return ext
+		}
+	}
+	return ""
+}
+
+// coverKey returns the destination of the cover of an album directory, without extension
+func coverKey(dest *destination) string {
+	return filepath.Join(filepath.Dir(dest.destPath), coverName)
+}
+
+// readCover returns the embedded picture of the media file, or nil if the file has no picture
+// or the album directory already has a cover. It must run before the media file is moved.
+func (m *MediaSorter) readCover(group *FileGroup, dest *destination) *tag.Picture {
+	if m.artworkClaimed(coverKey(dest)) {
+		return nil
+	}
+	file, err := os.Open(string(group.MediaFile))
+	if err != nil {
+		m.OutputWriter.Warn(fmt.Sprintf("Could not read artwork of %s: %v", group.MediaFile, err))
+		return nil
+	}
+	defer file.Close()
+	rawMetadata, err := tag.ReadFrom(file)
+	if err != nil {
+		return nil
+	}
+	picture := rawMetadata.Picture()
+	if picture == nil || len(picture.Data) == 0 {
+		return nil
+	}
+	return picture
+}
+
+// extractCover writes the embedded picture of the media file as cover file into the album directory,
+// unless another file of the album already did or the cover file exists. The transaction records the cover file.
+func (m *MediaSorter) extractCover(group *FileGroup, dest *destination, picture *tag.Picture, tx *groupTransaction) error {
+	ext := coverExtension(picture)
+	if ext == "" {
+		m.OutputWriter.Warn(fmt.Sprintf("Unknown image format '%s' of the artwork in %s, skipping artwork", picture.MIMEType, group.MediaFile))
+		return nil
+	}
+	key := coverKey(dest)
+	if !m.claimArtwork(tx, key) {
+		return nil
+	}
+
+	coverPath := key + "." + ext
+	if _, err := os.Lstat(coverPath); err == nil {
+		m.OutputWriter.Info(fmt.Sprintf("Cover file %s already exists, skipping artwork of %s", coverPath, group.MediaFile))
+		return nil
+	}
+
+	m.OutputWriter.Info(fmt.Sprintf("Extracting artwork %s -> %s", group.MediaFile, coverPath))
+	return tx.create("", coverPath, func() error {
+		return m.CoverWriter(picture, coverPath)
+	})
+}
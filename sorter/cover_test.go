@@ -0,0 +1,114 @@
+package sorter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dhowden/tag"
+)
+
+// id3Frame creates an ID3v2.3 frame
+func id3Frame(id string, data []byte) []byte {
+	var frame bytes.Buffer
+	frame.WriteString(id)
+	binary.Write(&frame, binary.BigEndian, uint32(len(data)))
+	frame.Write([]byte{0, 0})
+	frame.Write(data)
+	return frame.Bytes()
+}
+
+// id3WithPicture creates an ID3v2.3 tag with artist, album, title and an embedded picture, if data is not empty
+func id3WithPicture(artist, album, title, mimeType string, data []byte) []byte {
+	var frames bytes.Buffer
+	for id, text := range map[string]string{"TPE1": artist, "TALB": album, "TIT2": title} {
+		frames.Write(id3Frame(id, append([]byte{0}, text...)))
+	}
+	if len(data) > 0 {
+		var picture bytes.Buffer
+		picture.WriteByte(0) // ISO-8859-1 encoding
+		picture.WriteString(mimeType + "\x00")
+		picture.WriteByte(3) // front cover
+		picture.WriteString("\x00")
+		picture.Write(data)
+		frames.Write(id3Frame("APIC", picture.Bytes()))
+	}
+	return id3WithFrames(frames.Bytes())
+}
+
+// id3WithFrames creates an ID3v2.3 tag with the frames and some padding
+func id3WithFrames(frames []byte) []byte {
+	size := len(frames) + 16 // padding
+	var buf bytes.Buffer
+	buf.WriteString("ID3")
+	buf.Write([]byte{3, 0, 0})
+	buf.Write([]byte{byte(size >> 21 & 0x7f), byte(size >> 14 & 0x7f), byte(size >> 7 & 0x7f), byte(size & 0x7f)})
+	buf.Write(frames)
+	buf.Write(make([]byte, 16))
+	return buf.Bytes()
+}
+
+func TestCoverExtension(t *testing.T) {
+	tests := []struct {
+		picture  tag.Picture
+		expected string
+	}{
+		{tag.Picture{MIMEType: "image/jpeg"}, "jpg"},
+		{tag.Picture{MIMEType: "IMAGE/PNG"}, "png"},
+		{tag.Picture{Ext: "JPG"}, "jpg"},
+		{tag.Picture{MIMEType: "image/x-unknown", Ext: "xyz"}, ""},
+	}
+
+	for _, test := range tests {
+		if actual := coverExtension(&test.picture); actual != test.expected {
+			t.Errorf("coverExtension(%+v) = %q, expected %q", test.picture, actual, test.expected)
+		}
+	}
+}
+
+func TestRunExtractsCoverOncePerAlbum(t *testing.T) {
+	jpeg := []byte("\xff\xd8\xff\xe0 jpeg data")
+	png := []byte("\x89PNG\r\n\x1a\n png data")
+	srcDir := t.TempDir()
+	files := map[string][]byte{
+		"one.mp3":   id3WithPicture("Artist", "Album", "One", "image/jpeg", jpeg),
+		"two.mp3":   id3WithPicture("Artist", "Album", "Two", "image/jpeg", jpeg),
+		"other.mp3": id3WithPicture("Artist", "Other", "Other", "image/png", png),
+		"none.mp3":  id3WithPicture("Artist", "No Art", "None", "", nil),
+	}
+	writeSourceFiles(t, srcDir, files)
+	destDir := t.TempDir()
+
+	mediaSorter, err := New(&Config{DestDir: destDir, Move: true, ExtractArt: true, Jobs: 2, Output: io.Discard})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	if err := mediaSorter.Run(srcDir); err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+
+	expectedCovers := map[string][]byte{
+		filepath.Join(destDir, "Artist", "Album", "cover.jpg"): jpeg,
+		filepath.Join(destDir, "Artist", "Other", "cover.png"): png,
+	}
+	for path, expected := range expectedCovers {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			t.Errorf("Expected cover file %s: %v", path, err)
+			continue
+		}
+		if !bytes.Equal(content, expected) {
+			t.Errorf("Expected cover %s to contain %q, got %q", path, expected, content)
+		}
+	}
+	entries, err := os.ReadDir(filepath.Join(destDir, "Artist", "No Art"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("Expected only the media file in the album without artwork, got %v", entries)
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !windows
+
+package sorter
+
+import "syscall"
+
+// errCrossDevice is the error for renaming a file to another file system
+var errCrossDevice error = syscall.EXDEV
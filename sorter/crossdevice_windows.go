@@ -0,0 +1,8 @@
+//go:build windows
+
+package sorter
+
+import "syscall"
+
+// errCrossDevice is the Windows error code ERROR_NOT_SAME_DEVICE for moving a file to another drive
+var errCrossDevice error = syscall.Errno(17)
@@ -0,0 +1,116 @@
+package sorter
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ErrNotADirectory matches the errors for destination paths that contain a file where a directory is needed
+var ErrNotADirectory = errors.New("file is in the way of a directory")
+
+// NotADirectoryError occurs when a destination path contains a file where a directory is needed,
+// for example when a previous run with a different template created "Artist/Album" as a file.
+type NotADirectoryError struct {
+	path     string
+	destPath string
+}
+
+func (err *NotADirectoryError) Error() string {
+	return fmt.Sprintf("cannot create directory for %s: %s is a file, not a directory. Rename or remove the file", err.destPath, err.path)
+}
+
+func (err *NotADirectoryError) Is(target error) bool {
+	return target == ErrNotADirectory
+}
+
+// createDestinationDir creates the parent directories of destPath, with a clear error if one of them is a file
+func createDestinationDir(destPath string) error {
+	dir := filepath.Dir(destPath)
+	if conflict := findFileInPath(dir); conflict != "" {
+		return &NotADirectoryError{path: conflict, destPath: destPath}
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("error creating directory %s: %w", dir, err)
+	}
+	return nil
+}
+
+// findFileInPath returns the deepest existing component of the directory path if it's not a directory,
+// otherwise an empty string
+func findFileInPath(dir string) string {
+	for path := dir; ; path = filepath.Dir(path) {
+		fi, err := os.Stat(path)
+		if err == nil {
+			if fi.IsDir() {
+				return ""
+			}
+			return path
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return ""
+		}
+	}
+}
+
+// moveAsideName returns a name for moving a conflicting file out of the way, that does not exist yet
+func moveAsideName(path string) string {
+	candidate := path + ".moved-aside"
+	for i := 1; ; i++ {
+		if _, err := os.Lstat(candidate); os.IsNotExist(err) {
+			return candidate
+		}
+		candidate = path + ".moved-aside-" + strconv.Itoa(i)
+	}
+}
+
+// withConflictingFilesMovedAside wraps a FileProcessor to rename files that are in the way of destination directories
+func withConflictingFilesMovedAside(fileProcessor FileProcessor, outputWriter *OutputWriter) FileProcessor {
+	return func(srcPath string, destPath string) error {
+		err := fileProcessor(srcPath, destPath)
+		notADirErr, ok := err.(*NotADirectoryError)
+		if !ok {
+			return err
+		}
+		newName := moveAsideName(notADirErr.path)
+		if renameErr := os.Rename(notADirErr.path, newName); renameErr != nil {
+			return fmt.Errorf("error moving %s aside to %s: %w", notADirErr.path, newName, renameErr)
+		}
+		outputWriter.Warn(fmt.Sprintf("File %s was in the way of a directory, moved it to %s", notADirErr.path, newName))
+		return fileProcessor(srcPath, destPath)
+	}
+}
+
+// directoryDepth returns the number of directories between the root and the directory, 0 for the root itself
+func directoryDepth(root string, dir string) int {
+	rel, err := filepath.Rel(root, dir)
+	if err != nil || rel == "." {
+		return 0
+	}
+	return strings.Count(rel, string(filepath.Separator)) + 1
+}
+
+// checkInsideDir returns an error if the path is not inside the directory.
+// This guards against templates that produce paths outside of the destination directory.
+func checkInsideDir(dir string, path string) error {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return fmt.Errorf("error resolving absolute path for directory %s: %w", dir, err)
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("error resolving absolute path for %s: %w", path, err)
+	}
+	rel, err := filepath.Rel(absDir, absPath)
+	if err != nil {
+		return fmt.Errorf("error determining relative path from %s to %s: %w", absDir, absPath, err)
+	}
+	if rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("destination path %s is outside of destination directory %s, check your template", absPath, absDir)
+	}
+	return nil
+}
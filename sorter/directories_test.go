@@ -0,0 +1,159 @@
+package sorter
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCreateDestinationDirReportsFileInPath(t *testing.T) {
+	dir := t.TempDir()
+	conflict := filepath.Join(dir, "Artist", "Album")
+	if err := os.MkdirAll(filepath.Dir(conflict), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(conflict, []byte{}, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	err := createDestinationDir(filepath.Join(conflict, "Disc 1", "01 Title.mp3"))
+	notADirErr, ok := err.(*NotADirectoryError)
+	if !ok {
+		t.Fatalf("Expected NotADirectoryError, got %v", err)
+	}
+	if notADirErr.path != conflict {
+		t.Errorf("Expected conflicting path %s, got %s", conflict, notADirErr.path)
+	}
+	if !errors.Is(err, ErrNotADirectory) || strings.Contains(err.Error(), "--force") {
+		t.Errorf("Expected an error that matches ErrNotADirectory without command line flags, got %v", err)
+	}
+}
+
+func TestCreateDestinationDirCreatesDirectories(t *testing.T) {
+	dir := t.TempDir()
+	if err := createDestinationDir(filepath.Join(dir, "Artist", "Album", "01 Title.mp3")); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if fi, err := os.Stat(filepath.Join(dir, "Artist", "Album")); err != nil || !fi.IsDir() {
+		t.Errorf("Expected directory to be created, got %v", err)
+	}
+}
+
+func TestWithConflictingFilesMovedAside(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src.mp3")
+	conflict := filepath.Join(dir, "dest", "Artist")
+	for _, file := range []string{src, conflict, conflict + ".moved-aside"} {
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(file), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	processor := withConflictingFilesMovedAside(CopyFile, &OutputWriter{Verbosity: Quiet, Writer: io.Discard})
+	if err := processor(src, filepath.Join(conflict, "01 Title.mp3")); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(conflict, "01 Title.mp3")); err != nil {
+		t.Errorf("Expected destination file to exist, got %v", err)
+	}
+	content, err := os.ReadFile(conflict + ".moved-aside-1")
+	if err != nil || string(content) != conflict {
+		t.Errorf("Expected conflicting file to be moved aside, got %q, %v", content, err)
+	}
+}
+
+func TestCheckInsideDir(t *testing.T) {
+	tests := []struct {
+		dir         string
+		path        string
+		expectError bool
+	}{
+		{"dest", "dest/Artist/Album/01 Title.mp3", false},
+		{"dest", "dest/..hidden/file.mp3", false},
+		{"", "Artist/Title.mp3", false},
+		{"dest", "dest", true},
+		{"dest", "dest/../etc/passwd", true},
+		{"dest", "other/Title.mp3", true},
+		{"dest/sub", "dest/Title.mp3", true},
+	}
+	for _, test := range tests {
+		err := checkInsideDir(test.dir, test.path)
+		if test.expectError && err == nil {
+			t.Errorf("checkInsideDir(%q, %q): expected error", test.dir, test.path)
+		}
+		if !test.expectError && err != nil {
+			t.Errorf("checkInsideDir(%q, %q): expected no error, got %v", test.dir, test.path, err)
+		}
+	}
+}
+
+func TestRunIgnoresDirectoriesDeeperThanMaxDepth(t *testing.T) {
+	srcDir := t.TempDir()
+	writeSourceFiles(t, srcDir, map[string][]byte{
+		"top.flac":                  flacStream("TITLE=Top", "ARTIST=Artist", "ALBUM=Album"),
+		"sub/sub.flac":              flacStream("TITLE=Sub", "ARTIST=Artist", "ALBUM=Album"),
+		"sub/deeper/deeper.flac":    flacStream("TITLE=Deeper", "ARTIST=Artist", "ALBUM=Album"),
+		"sub/deeper/deep/deep.flac": flacStream("TITLE=Deep", "ARTIST=Artist", "ALBUM=Album"),
+	})
+
+	tests := []struct {
+		description string
+		limitDepth  bool
+		maxDepth    int
+		expected    []string
+	}{
+		{"only the source directory", true, 0, []string{"Top"}},
+		{"direct subdirectories", true, 1, []string{"Top", "Sub"}},
+		{"two levels", true, 2, []string{"Top", "Sub", "Deeper"}},
+		{"no limit", false, 0, []string{"Top", "Sub", "Deeper", "Deep"}},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			destDir := t.TempDir()
+			mediaSorter, err := New(&Config{DestDir: destDir, LimitDepth: test.limitDepth, MaxDepth: test.maxDepth, Output: io.Discard})
+			if err != nil {
+				t.Fatalf("New returned error: %v", err)
+			}
+			if err := mediaSorter.Run(srcDir); err != nil {
+				t.Fatalf("Run returned error: %v", err)
+			}
+
+			entries, err := os.ReadDir(filepath.Join(destDir, "Artist", "Album"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != len(test.expected) {
+				t.Errorf("Expected %d files, got %d", len(test.expected), len(entries))
+			}
+			for _, title := range test.expected {
+				if _, err := os.Stat(filepath.Join(destDir, "Artist", "Album", title+".flac")); err != nil {
+					t.Errorf("Expected sorted file %s: %v", title, err)
+				}
+			}
+		})
+	}
+}
+
+func TestDirectoryDepth(t *testing.T) {
+	root := filepath.Join("music", "source")
+	tests := []struct {
+		dir      string
+		expected int
+	}{
+		{root, 0},
+		{filepath.Join(root, "Artist"), 1},
+		{filepath.Join(root, "Artist", "Album", "CD1"), 3},
+	}
+	for _, test := range tests {
+		if actual := directoryDepth(root, test.dir); actual != test.expected {
+			t.Errorf("Expected depth %d for %s but got %d", test.expected, test.dir, actual)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package sorter
+
+import (
+	"slices"
+
+	"github.com/dhowden/tag"
+)
+
+// File extensions for the detected file types, the first extension is the one for corrections
+var fileTypeExtensions = map[tag.FileType][]string{
+	tag.MP3:  {"mp3"},
+	tag.M4A:  {"m4a", "mp4", "aac"},
+	tag.M4B:  {"m4b"},
+	tag.M4P:  {"m4p"},
+	tag.ALAC: {"m4a", "mp4"},
+	tag.FLAC: {"flac"},
+	tag.OGG:  {"ogg", "oga", "opus"},
+	tag.DSF:  {"dsf"},
+}
+
+// correctExtension returns the extension for the detected file type, with a leading dot,
+// and false if the extension already matches the file type or the file type is unknown
+func correctExtension(ext string, fileType tag.FileType) (string, bool) {
+	extensions, known := fileTypeExtensions[fileType]
+	if !known || slices.Contains(extensions, normalizeExtension(ext)) {
+		return ext, false
+	}
+	return "." + extensions[0], true
+}
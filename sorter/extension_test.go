@@ -0,0 +1,54 @@
+package sorter
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dhowden/tag"
+)
+
+func TestCorrectExtension(t *testing.T) {
+	tests := []struct {
+		ext               string
+		fileType          tag.FileType
+		expected          string
+		expectedCorrected bool
+	}{
+		{".mp3", tag.FLAC, ".flac", true},
+		{".flac", tag.FLAC, ".flac", false},
+		{".FLAC", tag.FLAC, ".FLAC", false},
+		{".mp4", tag.M4A, ".mp4", false},
+		{".ogg", tag.MP3, ".mp3", true},
+		{".mp4", tag.UnknownFileType, ".mp4", false},
+	}
+	for _, test := range tests {
+		actual, corrected := correctExtension(test.ext, test.fileType)
+		if actual != test.expected || corrected != test.expectedCorrected {
+			t.Errorf("correctExtension(%q, %q) = %q, %t; want %q, %t", test.ext, test.fileType, actual, corrected, test.expected, test.expectedCorrected)
+		}
+	}
+}
+
+func TestRunFixesExtension(t *testing.T) {
+	srcDir := t.TempDir()
+	destDir := filepath.Join(t.TempDir(), "sorted")
+	// A FLAC file with the wrong extension
+	content := flacStream("TITLE=Title", "ARTIST=Artist", "ALBUM=Album")
+	if err := os.WriteFile(filepath.Join(srcDir, "track.mp3"), content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	mediaSorter, err := New(&Config{DestDir: destDir, FixExtension: true, Output: io.Discard})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	if err := mediaSorter.Run(srcDir); err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(destDir, "Artist", "Album", "Title.flac")); err != nil {
+		t.Errorf("Expected file with corrected extension: %v", err)
+	}
+}
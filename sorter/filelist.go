@@ -0,0 +1,115 @@
+package sorter
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// RunFileList sorts the files of a list with one path per line, e.g. the output of find, instead of a source directory.
+// It groups the files like Run groups the files of a directory, so the list must contain the sidecar files, too.
+func (m *MediaSorter) RunFileList(list io.Reader) error {
+	return m.finishRun(m.sortFileList(list))
+}
+
+func (m *MediaSorter) sortFileList(list io.Reader) error {
+	paths, err := m.readFileList(list)
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		m.OutputWriter.Info("The list of files is empty, nothing to sort")
+		return nil
+	}
+
+	fileGroups := make(map[string][]string)
+	for _, path := range paths {
+		basename := strings.TrimSuffix(path, filepath.Ext(path))
+		fileGroups[basename] = append(fileGroups[basename], path)
+	}
+	plan, err := m.planGroups(fileGroups)
+	if err != nil {
+		return err
+	}
+	if m.Sample > 0 {
+		return m.checkSample(plan.mediaGroups)
+	}
+	if !m.confirmPlan(plan.mediaGroups) {
+		return nil
+	}
+	// Unsorted files keep their path relative to the directory that contains all listed files
+	return m.execute(commonDir(paths), plan)
+}
+
+// readFileList returns the absolute paths of the files in the list, skipping empty lines, duplicates, directories and hidden files
+func (m *MediaSorter) readFileList(list io.Reader) ([]string, error) {
+	var paths []string
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(list)
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		path, err := filepath.Abs(line)
+		if err != nil {
+			return nil, fmt.Errorf("error resolving absolute path for %s: %w", line, err)
+		}
+		if seen[path] {
+			continue
+		}
+		seen[path] = true
+
+		fi, err := os.Stat(path)
+		if err != nil {
+			m.OutputWriter.Warn(fmt.Sprintf("Could not read %s, skipping: %v", line, err))
+			continue
+		}
+		if fi.IsDir() {
+			m.OutputWriter.Warn(fmt.Sprintf("%s is a directory, skipping", line))
+			continue
+		}
+		// Skip hidden files like Run, e.g. the ._ files of macOS in the output of find
+		hidden, err := isHidden(path, fs.FileInfoToDirEntry(fi))
+		if err != nil {
+			return nil, err
+		}
+		if hidden || !m.matchesPatterns(path) {
+			continue
+		}
+		paths = append(paths, path)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading the list of files: %w", err)
+	}
+
+	if m.MaxFiles > 0 && len(paths) > m.MaxFiles && m.Sample == 0 {
+		return nil, fmt.Errorf("%w: found %d files in the list, which is more than the maximum of %d files", ErrTooManyFiles, len(paths), m.MaxFiles)
+	}
+	return paths, nil
+}
+
+// commonDir returns the deepest directory that contains all of the absolute paths
+func commonDir(paths []string) string {
+	dir := filepath.Dir(paths[0])
+	for _, path := range paths[1:] {
+		for !isInsideDir(dir, path) {
+			parent := filepath.Dir(dir)
+			if parent == dir {
+				return dir
+			}
+			dir = parent
+		}
+	}
+	return dir
+}
+
+// isInsideDir checks if the path is inside the directory or one of its subdirectories
+func isInsideDir(dir string, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
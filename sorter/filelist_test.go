@@ -0,0 +1,69 @@
+package sorter
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunFileListSortsListedFiles(t *testing.T) {
+	srcDir := t.TempDir()
+	files := map[string][]byte{
+		"a/listed.flac":   flacStream("TITLE=Listed", "ARTIST=Artist", "ALBUM=Album"),
+		"a/listed.lrc":    []byte("[00:00.00] lyrics"),
+		"b/other.flac":    flacStream("TITLE=Other", "ARTIST=Artist", "ALBUM=Album"),
+		"b/unlisted.flac": flacStream("TITLE=Unlisted", "ARTIST=Artist", "ALBUM=Album"),
+		"b/.hidden.flac":  flacStream("TITLE=Hidden", "ARTIST=Artist", "ALBUM=Album"),
+	}
+	writeSourceFiles(t, srcDir, files)
+	list := strings.Join([]string{
+		filepath.Join(srcDir, "a", "listed.flac"),
+		filepath.Join(srcDir, "a", "listed.lrc"),
+		"",
+		filepath.Join(srcDir, "b", "other.flac") + "\r",
+		filepath.Join(srcDir, "b", "missing.flac"),
+		filepath.Join(srcDir, "b"),
+		filepath.Join(srcDir, "b", ".hidden.flac"),
+	}, "\n")
+	destDir := filepath.Join(t.TempDir(), "sorted")
+
+	mediaSorter, err := New(&Config{DestDir: destDir, Output: io.Discard})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	if err := mediaSorter.RunFileList(strings.NewReader(list)); err != nil {
+		t.Fatalf("RunFileList returned error: %v", err)
+	}
+
+	for _, name := range []string{"Listed.flac", "Listed.lrc", "Other.flac"} {
+		if _, err := os.Stat(filepath.Join(destDir, "Artist", "Album", name)); err != nil {
+			t.Errorf("Expected sorted file %s: %v", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(destDir, "Artist", "Album", "Unlisted.flac")); !os.IsNotExist(err) {
+		t.Errorf("Expected file that is not in the list to be ignored, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(destDir, "Artist", "Album", "Hidden.flac")); !os.IsNotExist(err) {
+		t.Errorf("Expected hidden file to be ignored, got %v", err)
+	}
+}
+
+func TestCommonDir(t *testing.T) {
+	root := t.TempDir()
+	tests := []struct {
+		paths    []string
+		expected string
+	}{
+		{[]string{filepath.Join(root, "a", "track.flac")}, filepath.Join(root, "a")},
+		{[]string{filepath.Join(root, "a", "track.flac"), filepath.Join(root, "a", "b", "track.flac")}, filepath.Join(root, "a")},
+		{[]string{filepath.Join(root, "a", "b", "track.flac"), filepath.Join(root, "ab", "track.flac")}, root},
+	}
+	for _, test := range tests {
+		actual := commonDir(test.paths)
+		if actual != test.expected {
+			t.Errorf("Expected '%s' but got '%s'", test.expected, actual)
+		}
+	}
+}
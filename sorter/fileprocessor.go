@@ -0,0 +1,139 @@
+package sorter
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+type FileProcessor func(srcPath string, destPath string) error
+
+func DryRunFileProcessor(srcPath string, destPath string) error {
+	return nil
+}
+
+// ErrChecksumMismatch occurs when a verified copy has different content than its source
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+func CopyFile(srcPath string, destPath string) error {
+	_, err := copyFile(srcPath, destPath, false)
+	return err
+}
+
+// VerifiedCopyFile copies the file and reads the copy again, to check that it has the same content as the source.
+// It removes copies with different content and returns an error that matches ErrChecksumMismatch.
+func VerifiedCopyFile(srcPath string, destPath string) error {
+	return verifiedCopy(srcPath, destPath, copyFile)
+}
+
+// verifiedCopy copies the file with the copy function and checks the copy
+func verifiedCopy(srcPath string, destPath string, copy func(srcPath string, destPath string, checksum bool) ([]byte, error)) error {
+	sum, err := copy(srcPath, destPath, true)
+	if err != nil {
+		return err
+	}
+	if err := checkCopy(srcPath, destPath, sum); err != nil {
+		if removeErr := os.Remove(destPath); removeErr != nil {
+			return fmt.Errorf("%w, and the copy can't be removed: %v", err, removeErr)
+		}
+		return fmt.Errorf("%w, removed the copy", err)
+	}
+	return nil
+}
+
+// copyFile copies the file and returns the SHA-256 checksum of the source with checksum,
+// calculated while copying to avoid reading the source a second time
+func copyFile(srcPath string, destPath string, checksum bool) (sum []byte, err error) {
+	// create destination directory if it does not exist
+	if err := createDestinationDir(destPath); err != nil {
+		return nil, err
+	}
+
+	// Open the source first, to avoid creating empty destination files when the source is locked
+	f, err := os.Open(srcPath)
+	if err != nil {
+		return nil, fmt.Errorf("error opening file %s: %w", srcPath, err)
+	}
+	defer f.Close()
+	srcInfo, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("error reading permissions of file %s: %w", srcPath, err)
+	}
+	// New copies get the permissions of the source like moved files, limited by the umask like other new files.
+	// Overwritten files keep their permissions, changing them fails on some file systems, like network drives.
+	destFile, err := os.OpenFile(destPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, srcInfo.Mode().Perm())
+	if err != nil {
+		return nil, fmt.Errorf("error creating file %s: %w", destPath, err)
+	}
+	defer func() {
+		if closeErr := destFile.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("error closing file %s: %w", destPath, closeErr)
+		}
+	}()
+	var writer io.Writer = destFile
+	hash := sha256.New()
+	if checksum {
+		writer = io.MultiWriter(destFile, hash)
+	}
+	_, err = io.Copy(writer, f)
+	if err != nil {
+		return nil, fmt.Errorf("error copying file %s to %s: %w", srcPath, destPath, err)
+	}
+	// Write the copy to the drive before the source can be deleted, e.g. when moving to another file system
+	if err := destFile.Sync(); err != nil {
+		return nil, fmt.Errorf("error writing file %s: %w", destPath, err)
+	}
+	if checksum {
+		sum = hash.Sum(nil)
+	}
+	return sum, nil
+}
+
+// checkCopy reads the copy and compares its SHA-256 checksum with the checksum of the source
+func checkCopy(srcPath string, destPath string, sum []byte) error {
+	copySum, err := fileChecksum(destPath)
+	if err != nil {
+		return fmt.Errorf("error reading copy %s for verification: %w", destPath, err)
+	}
+	if !bytes.Equal(copySum, sum) {
+		return fmt.Errorf("%w: copy %s has different content than the source %s", ErrChecksumMismatch, destPath, srcPath)
+	}
+	return nil
+}
+
+func MoveFile(srcPath string, destPath string) (err error) {
+	// create destination directory if it does not exist
+	if err := createDestinationDir(destPath); err != nil {
+		return err
+	}
+
+	err = os.Rename(srcPath, destPath)
+	if err != nil {
+		return fmt.Errorf("error moving file %s to %s: %w", srcPath, destPath, err)
+	}
+
+	return nil
+}
+
+// withCopyFallback wraps a FileProcessor for moving files to copy with the copier and delete files that it can't move
+// to another file system, for example from a memory card to a network drive
+func withCopyFallback(fileProcessor FileProcessor, copier FileProcessor, outputWriter *OutputWriter) FileProcessor {
+	return func(srcPath string, destPath string) error {
+		err := fileProcessor(srcPath, destPath)
+		if !errors.Is(err, errCrossDevice) {
+			return err
+		}
+		outputWriter.Info(fmt.Sprintf("Can't move %s to another file system, copying and deleting it instead", srcPath))
+		if err := copier(srcPath, destPath); err != nil {
+			return err
+		}
+		// Only delete the source after a successful copy
+		if err := os.Remove(srcPath); err != nil {
+			return fmt.Errorf("error removing file %s after copying it to %s: %w", srcPath, destPath, err)
+		}
+		return nil
+	}
+}
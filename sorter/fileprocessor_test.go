@@ -0,0 +1,212 @@
+package sorter
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestCopyFileKeepsPermissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows only has a read-only attribute instead of permission bits")
+	}
+	// The modes are not affected by the usual umask of 022
+	tests := []struct {
+		description string
+		mode        os.FileMode
+		existing    bool
+		expected    os.FileMode
+	}{
+		{"restricted file", 0640, false, 0640},
+		{"private file", 0600, false, 0600},
+		{"executable file", 0755, false, 0755},
+		{"overwritten file keeps its mode", 0640, true, 0600},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			srcPath := filepath.Join(t.TempDir(), "track.flac")
+			if err := os.WriteFile(srcPath, []byte("content"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			// Chmod is not affected by the umask
+			if err := os.Chmod(srcPath, test.mode); err != nil {
+				t.Fatal(err)
+			}
+			destPath := filepath.Join(t.TempDir(), "Artist", "track.flac")
+			if test.existing {
+				if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(destPath, []byte("old"), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := CopyFile(srcPath, destPath); err != nil {
+				t.Fatalf("CopyFile returned error: %v", err)
+			}
+
+			info, err := os.Stat(destPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Mode().Perm() != test.expected {
+				t.Errorf("Expected mode %v, got %v", test.expected, info.Mode().Perm())
+			}
+		})
+	}
+}
+
+func TestCopyFallbackMovesFilesToOtherFileSystems(t *testing.T) {
+	tests := []struct {
+		description string
+		moveErr     error
+		expectedErr bool
+		moved       bool
+	}{
+		{"same file system", nil, false, false},
+		{"other file system", &os.LinkError{Op: "rename", Err: errCrossDevice}, false, true},
+		{"other error", errors.New("permission denied"), true, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			srcPath := filepath.Join(t.TempDir(), "track.flac")
+			if err := os.WriteFile(srcPath, []byte("content"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			destPath := filepath.Join(t.TempDir(), "Artist", "track.flac")
+			move := func(srcPath string, destPath string) error {
+				if test.moveErr != nil {
+					return fmt.Errorf("error moving file %s to %s: %w", srcPath, destPath, test.moveErr)
+				}
+				return nil
+			}
+			var output bytes.Buffer
+
+			err := withCopyFallback(move, CopyFile, &OutputWriter{Verbosity: Verbose, Writer: &output})(srcPath, destPath)
+			if test.expectedErr != (err != nil) {
+				t.Fatalf("Expected error: %v, got %v", test.expectedErr, err)
+			}
+
+			_, srcErr := os.Stat(srcPath)
+			content, destErr := os.ReadFile(destPath)
+			if test.moved {
+				if !os.IsNotExist(srcErr) || destErr != nil || string(content) != "content" {
+					t.Errorf("Expected file to be copied and deleted, got source error %v, destination %q, %v", srcErr, content, destErr)
+				}
+				if !strings.Contains(output.String(), "copying and deleting it instead") {
+					t.Errorf("Expected message about the fallback, got '%s'", output.String())
+				}
+				return
+			}
+			if srcErr != nil || !os.IsNotExist(destErr) {
+				t.Errorf("Expected no fallback, got source error %v, destination error %v", srcErr, destErr)
+			}
+		})
+	}
+}
+
+func TestVerifiedCopyFile(t *testing.T) {
+	srcPath := filepath.Join(t.TempDir(), "track.flac")
+	if err := os.WriteFile(srcPath, []byte("content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	destPath := filepath.Join(t.TempDir(), "Artist", "track.flac")
+
+	if err := VerifiedCopyFile(srcPath, destPath); err != nil {
+		t.Fatalf("VerifiedCopyFile returned error: %v", err)
+	}
+	content, err := os.ReadFile(destPath)
+	if err != nil || string(content) != "content" {
+		t.Errorf("Expected copy with the content of the source, got '%s' (%v)", content, err)
+	}
+}
+
+func TestCheckCopyDetectsDifferentContent(t *testing.T) {
+	dir := t.TempDir()
+	srcPath := filepath.Join(dir, "track.flac")
+	if err := os.WriteFile(srcPath, []byte("content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	destPath := filepath.Join(dir, "copy.flac")
+	sum, err := copyFile(srcPath, destPath, true)
+	if err != nil {
+		t.Fatalf("copyFile returned error: %v", err)
+	}
+	if err := checkCopy(srcPath, destPath, sum); err != nil {
+		t.Fatalf("Expected an intact copy to pass the check, got %v", err)
+	}
+
+	// A changed byte, like from a flaky drive
+	if err := os.WriteFile(destPath, []byte("contenu"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	err = checkCopy(srcPath, destPath, sum)
+	if !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("Expected ErrChecksumMismatch, got %v", err)
+	}
+	if !strings.Contains(err.Error(), destPath) || !strings.Contains(err.Error(), srcPath) {
+		t.Errorf("Expected the error to name the copy and the source, got '%v'", err)
+	}
+}
+
+func TestRunWithVerifyRemovesCorruptedCopies(t *testing.T) {
+	tests := []struct {
+		description string
+		move        bool
+	}{
+		{"copy", false},
+		{"move to other file system", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			srcDir := t.TempDir()
+			destDir := t.TempDir()
+			writeSourceFiles(t, srcDir, map[string][]byte{
+				"track.flac": flacStream("TITLE=Title", "ARTIST=Artist", "ALBUM=Album"),
+			})
+
+			mediaSorter, err := New(&Config{DestDir: destDir, Move: test.move, Verify: true, Output: io.Discard, ErrOutput: io.Discard})
+			if err != nil {
+				t.Fatalf("New returned error: %v", err)
+			}
+			// A flaky drive changes the copy after writing it
+			corruptingCopy := func(srcPath string, destPath string, checksum bool) ([]byte, error) {
+				sum, err := copyFile(srcPath, destPath, checksum)
+				if err != nil {
+					return nil, err
+				}
+				return sum, os.WriteFile(destPath, []byte("corrupted"), 0644)
+			}
+			copier := func(srcPath string, destPath string) error {
+				return verifiedCopy(srcPath, destPath, corruptingCopy)
+			}
+			mediaSorter.FileProcessor = copier
+			if test.move {
+				move := func(srcPath string, destPath string) error {
+					return &os.LinkError{Op: "rename", Old: srcPath, New: destPath, Err: errCrossDevice}
+				}
+				mediaSorter.FileProcessor = withCopyFallback(move, copier, mediaSorter.OutputWriter)
+			}
+
+			if err := mediaSorter.Run(srcDir); !errors.Is(err, ErrChecksumMismatch) {
+				t.Fatalf("Expected ErrChecksumMismatch, got %v", err)
+			}
+			if _, err := os.Stat(filepath.Join(destDir, "Artist", "Album", "Title.flac")); !os.IsNotExist(err) {
+				t.Errorf("Expected the corrupted copy to be removed, got %v", err)
+			}
+			if _, err := os.Stat(filepath.Join(srcDir, "track.flac")); err != nil {
+				t.Errorf("Expected the source to stay: %v", err)
+			}
+		})
+	}
+}
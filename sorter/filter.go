@@ -0,0 +1,156 @@
+package sorter
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/dhowden/tag"
+)
+
+// fileTypes are the file types that the tag library can detect
+var fileTypes = []tag.FileType{tag.MP3, tag.M4A, tag.M4B, tag.M4P, tag.ALAC, tag.FLAC, tag.OGG, tag.DSF}
+
+// ParseFileTypes parses file type names like "mp3" or "FLAC" for filtering media files
+func ParseFileTypes(names []string) ([]tag.FileType, error) {
+	types := make([]tag.FileType, 0, len(names))
+	for _, name := range names {
+		fileType := tag.FileType(strings.ToUpper(name))
+		if !slices.Contains(fileTypes, fileType) {
+			typeNames := make([]string, len(fileTypes))
+			for i, t := range fileTypes {
+				typeNames[i] = strings.ToLower(string(t))
+			}
+			return nil, fmt.Errorf("invalid file type '%s', must be one of %s", name, strings.Join(typeNames, ", "))
+		}
+		types = append(types, fileType)
+	}
+	return types, nil
+}
+
+// genreMatches checks if the cleaned genre contains the filter, ignoring case and surrounding spaces.
+// Tags with several genres, like "Jazz; Fusion", match the filter for each genre.
+func genreMatches(genre string, filter string) bool {
+	return strings.Contains(strings.ToLower(genre), strings.ToLower(strings.TrimSpace(filter)))
+}
+
+// CheckPatterns returns an error if one of the glob patterns for the names of source files is invalid
+func CheckPatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern '%s': %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// matchesPatterns checks if the name of a source file matches one of the Include patterns and none of the Exclude patterns
+func (m *MediaSorter) matchesPatterns(path string) bool {
+	name := filepath.Base(path)
+	for _, pattern := range m.Exclude {
+		if matched, _ := filepath.Match(pattern, name); matched {
+			m.OutputWriter.Debug(fmt.Sprintf("File %s matches the exclude pattern '%s', ignoring it", path, pattern))
+			return false
+		}
+	}
+	if len(m.Include) == 0 {
+		return true
+	}
+	for _, pattern := range m.Include {
+		if matched, _ := filepath.Match(pattern, name); matched {
+			return true
+		}
+	}
+	m.OutputWriter.Debug(fmt.Sprintf("File %s matches no include pattern, ignoring it", path))
+	return false
+}
+
+// sizeUnits are the factors of the units for ParseSize, in lower case.
+// The units with "i" are powers of 1024, the others powers of 1000.
+var sizeUnits = map[string]float64{
+	"": 1, "b": 1,
+	"k": 1e3, "kb": 1e3, "kib": 1 << 10,
+	"m": 1e6, "mb": 1e6, "mib": 1 << 20,
+	"g": 1e9, "gb": 1e9, "gib": 1 << 30,
+	"t": 1e12, "tb": 1e12, "tib": 1 << 40,
+}
+
+// ParseSize parses a file size like "5MB", "700 KiB" or "1.5G" into bytes. A number without unit is in bytes.
+func ParseSize(size string) (int64, error) {
+	text := strings.TrimSpace(size)
+	unitStart := strings.IndexFunc(text, func(r rune) bool { return (r < '0' || r > '9') && r != '.' })
+	if unitStart == -1 {
+		unitStart = len(text)
+	}
+	number, err := strconv.ParseFloat(text[:unitStart], 64)
+	factor, knownUnit := sizeUnits[strings.ToLower(strings.TrimSpace(text[unitStart:]))]
+	if err != nil || !knownUnit {
+		return 0, fmt.Errorf("invalid size '%s', must be a number with an optional unit like KB, MB, GB, KiB, MiB or GiB", size)
+	}
+	return int64(number * factor), nil
+}
+
+// matchesSize checks if the size of the media file is between MinSize and MaxSize.
+// Files that can't be read match, processing them reports the error.
+func (m *MediaSorter) matchesSize(mediaFile MediaFile) bool {
+	if m.MinSize == 0 && m.MaxSize == 0 {
+		return true
+	}
+	fi, err := os.Stat(string(mediaFile))
+	if err != nil {
+		return true
+	}
+	if m.MinSize > 0 && fi.Size() < m.MinSize {
+		m.OutputWriter.Info(fmt.Sprintf("File %s has %d bytes, less than the minimum of %d bytes, skipping", mediaFile, fi.Size(), m.MinSize))
+		return false
+	}
+	if m.MaxSize > 0 && fi.Size() > m.MaxSize {
+		m.OutputWriter.Info(fmt.Sprintf("File %s has %d bytes, more than the maximum of %d bytes, skipping", mediaFile, fi.Size(), m.MaxSize))
+		return false
+	}
+	return true
+}
+
+// FilteredOutError occurs when a media file does not match the filters of the run
+type FilteredOutError struct {
+	srcPath string
+	reason  string
+}
+
+func (err *FilteredOutError) Error() string {
+	return fmt.Sprintf("File %s %s, skipping", err.srcPath, err.reason)
+}
+
+func (err *FilteredOutError) Is(target error) bool {
+	return target == ErrFilteredOut
+}
+
+// checkFilters returns a FilteredOutError if the metadata of the file does not match the filters
+func (m *MediaSorter) checkFilters(srcPath MediaFile, metadata *Metadata) error {
+	if len(m.FileTypes) > 0 && !slices.Contains(m.FileTypes, metadata.FileType) {
+		return &FilteredOutError{srcPath: string(srcPath), reason: fmt.Sprintf("has the file type %s", metadata.FileType)}
+	}
+	if m.Genre != "" && !genreMatches(metadata.Genre, m.Genre) {
+		if metadata.Genre == "" {
+			return &FilteredOutError{srcPath: string(srcPath), reason: "has no genre"}
+		}
+		return &FilteredOutError{srcPath: string(srcPath), reason: fmt.Sprintf("has the genre '%s'", metadata.Genre)}
+	}
+	if m.MinYear == 0 && m.MaxYear == 0 {
+		return nil
+	}
+	// A file without a year can't be in any range of years
+	if metadata.Year == 0 {
+		return &FilteredOutError{srcPath: string(srcPath), reason: "has no year"}
+	}
+	if m.MinYear > 0 && metadata.Year < m.MinYear {
+		return &FilteredOutError{srcPath: string(srcPath), reason: fmt.Sprintf("is from %d, before %d", metadata.Year, m.MinYear)}
+	}
+	if m.MaxYear > 0 && metadata.Year > m.MaxYear {
+		return &FilteredOutError{srcPath: string(srcPath), reason: fmt.Sprintf("is from %d, after %d", metadata.Year, m.MaxYear)}
+	}
+	return nil
+}
@@ -0,0 +1,415 @@
+package sorter
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/dhowden/tag"
+)
+
+func TestParseFileTypes(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    []string
+		expected []tag.FileType
+		wantErr  bool
+	}{
+		{"no types", nil, []tag.FileType{}, false},
+		{"lowercase", []string{"mp3", "flac"}, []tag.FileType{tag.MP3, tag.FLAC}, false},
+		{"uppercase", []string{"OGG"}, []tag.FileType{tag.OGG}, false},
+		{"unknown type", []string{"flac", "wav"}, nil, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			types, err := ParseFileTypes(test.input)
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("Expected error for %v", test.input)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseFileTypes returned error: %v", err)
+			}
+			if !slices.Equal(types, test.expected) {
+				t.Errorf("Expected %v, got %v", test.expected, types)
+			}
+		})
+	}
+}
+
+func TestRunProcessesOnlyFilteredFileTypes(t *testing.T) {
+	srcDir := t.TempDir()
+	files := map[string][]byte{
+		"lossless.flac": flacStream("TITLE=Lossless", "ARTIST=Artist", "ALBUM=Album"),
+		"lossy.mp3":     id3Tag("Lossy"),
+	}
+	writeSourceFiles(t, srcDir, files)
+
+	tests := []struct {
+		name     string
+		types    []tag.FileType
+		expected []string
+	}{
+		{"only flac", []tag.FileType{tag.FLAC}, []string{"Artist/Album/Lossless.flac"}},
+		{"only mp3", []tag.FileType{tag.MP3}, []string{"Unknown Artist/Unknown Album/Lossy.mp3"}},
+		{"no filter", nil, []string{"Artist/Album/Lossless.flac", "Unknown Artist/Unknown Album/Lossy.mp3"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			destDir := t.TempDir()
+			mediaSorter, err := New(&Config{DestDir: destDir, FileTypes: test.types, Output: io.Discard})
+			if err != nil {
+				t.Fatalf("New returned error: %v", err)
+			}
+			if err := mediaSorter.Run(srcDir); err != nil {
+				t.Fatalf("Run returned error: %v", err)
+			}
+
+			var sorted []string
+			filepath.WalkDir(destDir, func(path string, d os.DirEntry, err error) error {
+				if err == nil && !d.IsDir() {
+					relPath, _ := filepath.Rel(destDir, path)
+					sorted = append(sorted, filepath.ToSlash(relPath))
+				}
+				return err
+			})
+			if !slices.Equal(sorted, test.expected) {
+				t.Errorf("Expected files %v, got %v", test.expected, sorted)
+			}
+		})
+	}
+}
+
+func TestRunProcessesOnlyFilesInYearRange(t *testing.T) {
+	srcDir := t.TempDir()
+	files := map[string][]byte{
+		"early.flac":   flacStream("TITLE=Early", "ARTIST=Artist", "ALBUM=Album", "DATE=1985"),
+		"middle.flac":  flacStream("TITLE=Middle", "ARTIST=Artist", "ALBUM=Album", "DATE=1995"),
+		"late.flac":    flacStream("TITLE=Late", "ARTIST=Artist", "ALBUM=Album", "DATE=2005"),
+		"unknown.flac": flacStream("TITLE=Unknown", "ARTIST=Artist", "ALBUM=Album"),
+	}
+	writeSourceFiles(t, srcDir, files)
+
+	tests := []struct {
+		name     string
+		minYear  int
+		maxYear  int
+		expected []string
+		messages []string
+	}{
+		{
+			name:     "range",
+			minYear:  1990,
+			maxYear:  2000,
+			expected: []string{"Middle.flac"},
+			messages: []string{"early.flac is from 1985, before 1990", "late.flac is from 2005, after 2000", "unknown.flac has no year"},
+		},
+		{
+			name:     "only minimum",
+			minYear:  1995,
+			expected: []string{"Late.flac", "Middle.flac"},
+			messages: []string{"early.flac is from 1985, before 1995", "unknown.flac has no year"},
+		},
+		{
+			name:     "only maximum",
+			maxYear:  1985,
+			expected: []string{"Early.flac"},
+			messages: []string{"middle.flac is from 1995, after 1985", "unknown.flac has no year"},
+		},
+		{
+			name:     "no range",
+			expected: []string{"Early.flac", "Late.flac", "Middle.flac", "Unknown.flac"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			destDir := t.TempDir()
+			var output bytes.Buffer
+			mediaSorter, err := New(&Config{DestDir: destDir, MinYear: test.minYear, MaxYear: test.maxYear, Verbosity: Verbose, Output: &output})
+			if err != nil {
+				t.Fatalf("New returned error: %v", err)
+			}
+			if err := mediaSorter.Run(srcDir); err != nil {
+				t.Fatalf("Run returned error: %v", err)
+			}
+
+			entries, err := os.ReadDir(filepath.Join(destDir, "Artist", "Album"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var sorted []string
+			for _, entry := range entries {
+				sorted = append(sorted, entry.Name())
+			}
+			if !slices.Equal(sorted, test.expected) {
+				t.Errorf("Expected files %v, got %v", test.expected, sorted)
+			}
+			for _, message := range test.messages {
+				if !strings.Contains(output.String(), message) {
+					t.Errorf("Expected output to contain '%s' but got '%s'", message, output.String())
+				}
+			}
+		})
+	}
+}
+
+func TestGenreMatches(t *testing.T) {
+	tests := []struct {
+		genre    string
+		filter   string
+		expected bool
+	}{
+		{"Jazz", "jazz", true},
+		{"Acid Jazz", "Jazz", true},
+		{"Jazz; Fusion", "fusion", true},
+		{"Rock\x00Jazz", "jazz", true},
+		{"Rock", " rock ", true},
+		{"Rock", "jazz", false},
+		{"", "jazz", false},
+	}
+
+	for _, test := range tests {
+		if actual := genreMatches(test.genre, test.filter); actual != test.expected {
+			t.Errorf("genreMatches(%q, %q) = %v, expected %v", test.genre, test.filter, actual, test.expected)
+		}
+	}
+}
+
+func TestRunProcessesOnlyFilesOfGenre(t *testing.T) {
+	srcDir := t.TempDir()
+	files := map[string][]byte{
+		"jazz.flac":   flacStream("TITLE=Jazz", "ARTIST=Artist", "ALBUM=Album", "GENRE=Jazz"),
+		"fusion.flac": flacStream("TITLE=Fusion", "ARTIST=Artist", "ALBUM=Album", "GENRE=Jazz; Fusion"),
+		"rock.flac":   flacStream("TITLE=Rock", "ARTIST=Artist", "ALBUM=Album", "GENRE=Rock"),
+		"none.flac":   flacStream("TITLE=None", "ARTIST=Artist", "ALBUM=Album"),
+	}
+	writeSourceFiles(t, srcDir, files)
+	destDir := t.TempDir()
+	var output bytes.Buffer
+
+	mediaSorter, err := New(&Config{DestDir: destDir, Genre: "JAZZ", Verbosity: Verbose, Output: &output})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	if err := mediaSorter.Run(srcDir); err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+
+	entries, err := os.ReadDir(filepath.Join(destDir, "Artist", "Album"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sorted []string
+	for _, entry := range entries {
+		sorted = append(sorted, entry.Name())
+	}
+	expected := []string{"Fusion.flac", "Jazz.flac"}
+	if !slices.Equal(sorted, expected) {
+		t.Errorf("Expected files %v, got %v", expected, sorted)
+	}
+	for _, message := range []string{"rock.flac has the genre 'Rock'", "none.flac has no genre"} {
+		if !strings.Contains(output.String(), message) {
+			t.Errorf("Expected output to contain '%s' but got '%s'", message, output.String())
+		}
+	}
+}
+
+func TestRunFiltersByCleanedGenre(t *testing.T) {
+	tests := []struct {
+		description          string
+		genre                string
+		filter               string
+		normalizePunctuation bool
+	}{
+		{"without slashes", "Rock/Pop", "RockPop", false},
+		{"with normalized punctuation", "Rock\u2019n\u2019Roll", "Rock'n'Roll", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			srcDir := t.TempDir()
+			writeSourceFiles(t, srcDir, map[string][]byte{
+				"track.flac": flacStream("TITLE=Title", "ARTIST=Artist", "ALBUM=Album", "GENRE="+test.genre),
+			})
+			destDir := t.TempDir()
+
+			mediaSorter, err := New(&Config{DestDir: destDir, Genre: test.filter, NormalizePunctuation: test.normalizePunctuation, ReportSkipsAsErrors: true, Output: io.Discard, ErrOutput: io.Discard})
+			if err != nil {
+				t.Fatalf("New returned error: %v", err)
+			}
+			if err := mediaSorter.Run(srcDir); err != nil {
+				t.Fatalf("Run returned error: %v", err)
+			}
+			if _, err := os.Stat(filepath.Join(destDir, "Artist", "Album", "Title.flac")); err != nil {
+				t.Errorf("Expected file with genre '%s' to match '%s': %v", test.genre, test.filter, err)
+			}
+		})
+	}
+}
+
+func TestRunReportsFilteredFilesAsErrors(t *testing.T) {
+	srcDir := t.TempDir()
+	files := map[string][]byte{
+		"jazz.flac": flacStream("TITLE=Jazz", "ARTIST=Artist", "ALBUM=Album", "GENRE=Jazz"),
+		"rock.flac": flacStream("TITLE=Rock", "ARTIST=Artist", "ALBUM=Album", "GENRE=Rock"),
+	}
+	writeSourceFiles(t, srcDir, files)
+	var errOutput bytes.Buffer
+
+	mediaSorter, err := New(&Config{DestDir: t.TempDir(), Genre: "Jazz", ReportSkipsAsErrors: true, Verbosity: Quiet, Output: io.Discard, ErrOutput: &errOutput})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	err = mediaSorter.Run(srcDir)
+	if err == nil || err.Error() != "skipped 1 files (1 filtered-out)" {
+		t.Errorf("Expected the filtered file to fail the run, got %v", err)
+	}
+	if !strings.Contains(errOutput.String(), "rock.flac has the genre 'Rock'") {
+		t.Errorf("Expected a warning for the filtered file, got '%s'", errOutput.String())
+	}
+}
+
+func TestRunUsesIncludeAndExcludePatterns(t *testing.T) {
+	srcDir := t.TempDir()
+	files := map[string][]byte{
+		"one.flac":  flacStream("TITLE=One", "ARTIST=Artist", "ALBUM=Album"),
+		"one.lrc":   []byte("[00:00.00] lyrics"),
+		"two.mp3":   append(id3Tag("Two"), make([]byte, 16)...),
+		"demo.flac": flacStream("TITLE=Demo", "ARTIST=Artist", "ALBUM=Album"),
+	}
+	writeSourceFiles(t, srcDir, files)
+
+	tests := []struct {
+		name     string
+		include  []string
+		exclude  []string
+		expected []string
+	}{
+		{"include only", []string{"*.flac"}, nil, []string{"Artist/Album/Demo.flac", "Artist/Album/One.flac"}},
+		{"several includes", []string{"one.*", "*.mp3"}, nil, []string{"Artist/Album/One.flac", "Artist/Album/One.lrc", "Unknown Artist/Unknown Album/Two.mp3"}},
+		{"exclude only", nil, []string{"*.lrc", "demo*"}, []string{"Artist/Album/One.flac", "Unknown Artist/Unknown Album/Two.mp3"}},
+		{"exclude wins over include", []string{"*.flac", "*.lrc"}, []string{"demo.flac"}, []string{"Artist/Album/One.flac", "Artist/Album/One.lrc"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			destDir := t.TempDir()
+			mediaSorter, err := New(&Config{DestDir: destDir, Include: test.include, Exclude: test.exclude, Output: io.Discard})
+			if err != nil {
+				t.Fatalf("New returned error: %v", err)
+			}
+			if err := mediaSorter.Run(srcDir); err != nil {
+				t.Fatalf("Run returned error: %v", err)
+			}
+
+			var sorted []string
+			filepath.WalkDir(destDir, func(path string, d os.DirEntry, err error) error {
+				if err == nil && !d.IsDir() {
+					relPath, _ := filepath.Rel(destDir, path)
+					sorted = append(sorted, filepath.ToSlash(relPath))
+				}
+				return err
+			})
+			if !slices.Equal(sorted, test.expected) {
+				t.Errorf("Expected files %v, got %v", test.expected, sorted)
+			}
+		})
+	}
+}
+
+func TestCheckPatterns(t *testing.T) {
+	if err := CheckPatterns([]string{"*.flac", "track-??.mp3", "[a-c]*"}); err != nil {
+		t.Errorf("Expected valid patterns, got %v", err)
+	}
+	if err := CheckPatterns([]string{"*.flac", "[a-"}); err == nil {
+		t.Error("Expected error for invalid pattern")
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+		wantErr  bool
+	}{
+		{"1024", 1024, false},
+		{"5MB", 5000000, false},
+		{"700 KiB", 700 * 1024, false},
+		{"1.5g", 1500000000, false},
+		{"2 TiB", 2 << 40, false},
+		{"", 0, true},
+		{"MB", 0, true},
+		{"-5MB", 0, true},
+		{"5 lightyears", 0, true},
+	}
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			size, err := ParseSize(test.input)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("Expected error %v, got %v", test.wantErr, err)
+			}
+			if size != test.expected {
+				t.Errorf("Expected %d bytes, got %d", test.expected, size)
+			}
+		})
+	}
+}
+
+func TestRunProcessesOnlyFilesInSizeRange(t *testing.T) {
+	srcDir := t.TempDir()
+	small := flacStream("TITLE=Small", "ARTIST=Artist", "ALBUM=Album")
+	files := map[string][]byte{
+		"small.flac":  small,
+		"small.lrc":   []byte("[00:00.00] lyrics"),
+		"medium.flac": append(flacStream("TITLE=Medium", "ARTIST=Artist", "ALBUM=Album"), make([]byte, 1000)...),
+		"medium.lrc":  []byte("[00:00.00] lyrics"),
+		"large.flac":  append(flacStream("TITLE=Large", "ARTIST=Artist", "ALBUM=Album"), make([]byte, 5000)...),
+	}
+	writeSourceFiles(t, srcDir, files)
+
+	tests := []struct {
+		name     string
+		minSize  int64
+		maxSize  int64
+		expected []string
+	}{
+		{"no limits", 0, 0, []string{"Artist/Album/Large.flac", "Artist/Album/Medium.flac", "Artist/Album/Medium.lrc", "Artist/Album/Small.flac", "Artist/Album/Small.lrc"}},
+		{"minimum", int64(len(small)) + 1, 0, []string{"Artist/Album/Large.flac", "Artist/Album/Medium.flac", "Artist/Album/Medium.lrc"}},
+		{"maximum", 0, 4000, []string{"Artist/Album/Medium.flac", "Artist/Album/Medium.lrc", "Artist/Album/Small.flac", "Artist/Album/Small.lrc"}},
+		{"exact limits", int64(len(small)), int64(len(small)), []string{"Artist/Album/Small.flac", "Artist/Album/Small.lrc"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			destDir := t.TempDir()
+			mediaSorter, err := New(&Config{DestDir: destDir, MinSize: test.minSize, MaxSize: test.maxSize, Output: io.Discard})
+			if err != nil {
+				t.Fatalf("New returned error: %v", err)
+			}
+			if err := mediaSorter.Run(srcDir); err != nil {
+				t.Fatalf("Run returned error: %v", err)
+			}
+
+			var sorted []string
+			filepath.WalkDir(destDir, func(path string, d os.DirEntry, err error) error {
+				if err == nil && !d.IsDir() {
+					relPath, _ := filepath.Rel(destDir, path)
+					sorted = append(sorted, filepath.ToSlash(relPath))
+				}
+				return err
+			})
+			if !slices.Equal(sorted, test.expected) {
+				t.Errorf("Expected files %v, got %v", test.expected, sorted)
+			}
+		})
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !windows
+
+package sorter
+
+import (
+	"io/fs"
+	"strings"
+)
+
+// isHidden returns true for files that start with a dot, the convention for hidden files on Unix-like systems
+func isHidden(path string, info fs.DirEntry) (bool, error) {
+	return strings.HasPrefix(info.Name(), "."), nil
+}
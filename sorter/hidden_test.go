@@ -0,0 +1,57 @@
+package sorter
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIsHidden(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{".hidden.flac", "visible.flac"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("content"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected := map[string]bool{".hidden.flac": true, "visible.flac": false}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		hidden, err := isHidden(filepath.Join(dir, entry.Name()), entry)
+		if err != nil {
+			t.Fatalf("isHidden returned error: %v", err)
+		}
+		if hidden != expected[entry.Name()] {
+			t.Errorf("isHidden(%s) = %v, expected %v", entry.Name(), hidden, expected[entry.Name()])
+		}
+	}
+}
+
+func TestRunSkipsHiddenFiles(t *testing.T) {
+	srcDir := t.TempDir()
+	files := map[string][]byte{
+		".hidden.flac": flacStream("TITLE=Hidden", "ARTIST=Artist", "ALBUM=Album"),
+		"visible.flac": flacStream("TITLE=Visible", "ARTIST=Artist", "ALBUM=Album"),
+	}
+	writeSourceFiles(t, srcDir, files)
+	destDir := t.TempDir()
+
+	mediaSorter, err := New(&Config{DestDir: destDir, Output: io.Discard})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	if err := mediaSorter.Run(srcDir); err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(destDir, "Artist", "Album", "Visible.flac")); err != nil {
+		t.Errorf("Expected visible file to be processed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(destDir, "Artist", "Album", "Hidden.flac")); !os.IsNotExist(err) {
+		t.Errorf("Expected hidden file to be skipped, got %v", err)
+	}
+}
@@ -0,0 +1,27 @@
+//go:build windows
+
+package sorter
+
+import (
+	"fmt"
+	"io/fs"
+	"strings"
+	"syscall"
+)
+
+// isHidden returns true for files with the hidden or system attribute, like desktop.ini and Thumbs.db,
+// and for files that start with a dot, which come from Unix-like systems
+func isHidden(path string, info fs.DirEntry) (bool, error) {
+	if strings.HasPrefix(info.Name(), ".") {
+		return true, nil
+	}
+	fileInfo, err := info.Info()
+	if err != nil {
+		return false, fmt.Errorf("error reading attributes of %s: %w", path, err)
+	}
+	attributes, ok := fileInfo.Sys().(*syscall.Win32FileAttributeData)
+	if !ok {
+		return false, nil
+	}
+	return attributes.FileAttributes&(syscall.FILE_ATTRIBUTE_HIDDEN|syscall.FILE_ATTRIBUTE_SYSTEM) != 0, nil
+}
@@ -0,0 +1,117 @@
+package sorter
+
+import (
+	"errors"
+	"sync"
+)
+
+// keyedMutex locks strings, e.g. destination paths. The zero value is ready to use.
+type keyedMutex struct {
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+// lock locks the key and returns the function for unlocking it
+func (k *keyedMutex) lock(key string) func() {
+	k.mu.Lock()
+	if k.locks == nil {
+		k.locks = make(map[string]*sync.Mutex)
+	}
+	lock, exists := k.locks[key]
+	if !exists {
+		lock = &sync.Mutex{}
+		k.locks[key] = lock
+	}
+	k.mu.Unlock()
+
+	lock.Lock()
+	return lock.Unlock
+}
+
+// claimArtwork returns true for the first file group of an album that uses the artwork destination.
+// The transaction records the claim, it's nil without AtomicGroup.
+func (m *MediaSorter) claimArtwork(tx *groupTransaction, destPath string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, seen := m.artworkDestinations[destPath]; seen {
+		return false
+	}
+	m.artworkDestinations[destPath] = struct{}{}
+	tx.claimArtwork(destPath)
+	return true
+}
+
+// artworkClaimed returns true if a file group already claimed the artwork destination
+func (m *MediaSorter) artworkClaimed(destPath string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, seen := m.artworkDestinations[destPath]
+	return seen
+}
+
+// processGroups processes the file groups with Jobs parallel jobs. After the first error
+// that stops the run, it doesn't start processing more groups and returns the error
+// when the running jobs are finished. With KeepGoing, it processes all groups and
+// returns the joined errors.
+func (m *MediaSorter) processGroups(srcDir string, groups []*FileGroup) error {
+	if m.Progress {
+		m.progress = &progress{total: len(groups)}
+	}
+	if m.Jobs <= 1 {
+		var errs []error
+		for _, group := range groups {
+			if err := m.processGroup(srcDir, group); err != nil {
+				if !m.KeepGoing {
+					return err
+				}
+				errs = append(errs, err)
+			}
+		}
+		return errors.Join(errs...)
+	}
+
+	work := make(chan *FileGroup)
+	failed := make(chan struct{})
+	var firstErr error
+	var failOnce sync.Once
+	var errs []error
+	var errsMu sync.Mutex
+	var wg sync.WaitGroup
+	for range m.Jobs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for group := range work {
+				err := m.processGroup(srcDir, group)
+				if err == nil {
+					continue
+				}
+				if m.KeepGoing {
+					errsMu.Lock()
+					errs = append(errs, err)
+					errsMu.Unlock()
+					continue
+				}
+				failOnce.Do(func() {
+					firstErr = err
+					close(failed)
+				})
+			}
+		}()
+	}
+
+dispatch:
+	for _, group := range groups {
+		select {
+		case work <- group:
+		case <-failed:
+			break dispatch
+		}
+	}
+	close(work)
+	wg.Wait()
+	if m.KeepGoing {
+		return errors.Join(errs...)
+	}
+	return firstErr
+}
@@ -0,0 +1,76 @@
+package sorter
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunWithKeepGoingProcessesFilesAfterAnError(t *testing.T) {
+	errBroken := errors.New("broken file")
+	for _, jobs := range []int{1, 2} {
+		t.Run(fmt.Sprintf("%d jobs", jobs), func(t *testing.T) {
+			srcDir := t.TempDir()
+			destDir := t.TempDir()
+			for _, title := range []string{"One", "Two", "Three", "Four"} {
+				name := filepath.Join(srcDir, strings.ToLower(title)+".flac")
+				if err := os.WriteFile(name, flacStream("TITLE="+title, "ARTIST=Artist", "ALBUM=Album"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			mediaSorter, err := New(&Config{DestDir: destDir, KeepGoing: true, Jobs: jobs, Output: io.Discard})
+			if err != nil {
+				t.Fatalf("New returned error: %v", err)
+			}
+			mediaSorter.FileProcessor = func(srcPath string, destPath string) error {
+				if filepath.Base(srcPath) == "two.flac" {
+					return errBroken
+				}
+				return CopyFile(srcPath, destPath)
+			}
+
+			err = mediaSorter.Run(srcDir)
+			if !errors.Is(err, errBroken) {
+				t.Fatalf("Expected the error of the broken file, got %v", err)
+			}
+			for _, title := range []string{"One", "Three", "Four"} {
+				if _, err := os.Stat(filepath.Join(destDir, "Artist", "Album", title+".flac")); err != nil {
+					t.Errorf("Expected %s to be processed after the error: %v", title, err)
+				}
+			}
+		})
+	}
+}
+
+func TestRunWithoutKeepGoingStopsAtTheFirstError(t *testing.T) {
+	errBroken := errors.New("broken file")
+	srcDir := t.TempDir()
+	for _, title := range []string{"One", "Two", "Three"} {
+		name := filepath.Join(srcDir, strings.ToLower(title)+".flac")
+		if err := os.WriteFile(name, flacStream("TITLE="+title, "ARTIST=Artist", "ALBUM=Album"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mediaSorter, err := New(&Config{DestDir: t.TempDir(), Output: io.Discard})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	processed := 0
+	mediaSorter.FileProcessor = func(srcPath string, destPath string) error {
+		processed++
+		return errBroken
+	}
+
+	if err := mediaSorter.Run(srcDir); !errors.Is(err, errBroken) {
+		t.Fatalf("Expected the error of the broken file, got %v", err)
+	}
+	if processed != 1 {
+		t.Errorf("Expected the run to stop after the first file, processed %d files", processed)
+	}
+}
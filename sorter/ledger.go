@@ -0,0 +1,225 @@
+package sorter
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// ledgerRecord is a line of the ledger file, in the JSON Lines format.
+// Records with Released remove a destination that an earlier record claimed.
+type ledgerRecord struct {
+	Path     string `json:"path"`
+	Released bool   `json:"released,omitempty"`
+}
+
+// LedgerOverrideChecker is an OverrideChecker that records claimed destination paths in a JSON Lines file.
+// Runs that use the same ledger file skip the destinations that other runs claimed, even while the files are not written yet.
+// Each check locks the file, reads the claims of other runs and appends the new claim, so only one run can claim a destination.
+// It checks the destinations that are not in the ledger with the checker of the policy for existing files.
+// Destinations that could not be written and destinations of file groups that AtomicGroup rolls back are released again.
+type LedgerOverrideChecker struct {
+	file    *os.File
+	claimed map[string]struct{}
+	// Destinations that this run claimed, only they can be released
+	ownClaims    map[string]struct{}
+	offset       int64
+	checker      OverrideChecker
+	OutputWriter *OutputWriter
+	// Dry runs only read the ledger, they don't claim destinations
+	ReadOnly bool
+	// Parallel jobs claim destinations at the same time
+	mu sync.Mutex
+}
+
+func NewLedgerOverrideChecker(path string, checker OverrideChecker, outputWriter *OutputWriter) (*LedgerOverrideChecker, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("error opening ledger file %s: %w", path, err)
+	}
+	ledger := &LedgerOverrideChecker{
+		file:         file,
+		claimed:      make(map[string]struct{}),
+		ownClaims:    make(map[string]struct{}),
+		checker:      checker,
+		OutputWriter: outputWriter,
+	}
+	// Load the destinations of earlier runs, later checks only read the records that other runs append
+	if err := ledger.withLockedFile(func() error { return nil }); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("error reading ledger file %s: %w", path, err)
+	}
+	return ledger, nil
+}
+
+// DestinationFileExists returns true if the destination path was claimed, by this run or another run,
+// or if the checker of the policy for existing files reports it. Otherwise, it claims the destination.
+// If the ledger can't be read or written, it shows a warning and returns true, to avoid writing claimed files.
+func (l *LedgerOverrideChecker) DestinationFileExists(srcPath string, destPath string) bool {
+	claimed, err := l.claim(srcPath, destPath)
+	if err != nil {
+		l.OutputWriter.Warn(fmt.Sprintf("Error updating ledger file %s: %v", l.file.Name(), err))
+		return true
+	}
+	return !claimed
+}
+
+// claim adds the absolute destination path to the ledger, returns false if it is in the ledger
+// or if the checker of the policy for existing files reports it
+func (l *LedgerOverrideChecker) claim(srcPath string, destPath string) (claimed bool, err error) {
+	absPath, err := filepath.Abs(destPath)
+	if err != nil {
+		return false, err
+	}
+	err = l.withLockedFile(func() error {
+		if _, exists := l.claimed[absPath]; exists {
+			return nil
+		}
+		if l.checker.DestinationFileExists(srcPath, destPath) {
+			return nil
+		}
+		if !l.ReadOnly {
+			if err := l.appendRecord(ledgerRecord{Path: absPath}); err != nil {
+				return err
+			}
+		}
+		claimed = true
+		return nil
+	})
+	return claimed, err
+}
+
+// Record adds the absolute destination path to the ledger, if it's not in the ledger yet
+func (l *LedgerOverrideChecker) Record(destPath string) error {
+	absPath, err := filepath.Abs(destPath)
+	if err != nil {
+		return err
+	}
+	return l.withLockedFile(func() error {
+		if _, exists := l.claimed[absPath]; exists {
+			return nil
+		}
+		return l.appendRecord(ledgerRecord{Path: absPath})
+	})
+}
+
+// appendRecord writes a record at the end of the ledger and updates the claimed destinations
+func (l *LedgerOverrideChecker) appendRecord(record ledgerRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	n, err := l.file.WriteAt(append(line, '\n'), l.offset)
+	l.offset += int64(n)
+	if err != nil {
+		return err
+	}
+	if record.Released {
+		delete(l.claimed, record.Path)
+		delete(l.ownClaims, record.Path)
+		return nil
+	}
+	l.claimed[record.Path] = struct{}{}
+	l.ownClaims[record.Path] = struct{}{}
+	return nil
+}
+
+// release removes a destination that this run claimed from the ledger, e.g. of a rolled back file group,
+// by appending the path with a leading "-". It also releases the destination in the checker of the policy.
+func (l *LedgerOverrideChecker) release(destPath string) {
+	if releaser, ok := l.checker.(claimReleaser); ok {
+		releaser.release(destPath)
+	}
+	absPath, err := filepath.Abs(destPath)
+	if err != nil {
+		return
+	}
+	err = l.withLockedFile(func() error {
+		if _, exists := l.ownClaims[absPath]; !exists {
+			return nil
+		}
+		return l.appendRecord(ledgerRecord{Path: absPath, Released: true})
+	})
+	if err != nil {
+		l.OutputWriter.Warn(fmt.Sprintf("Error updating ledger file %s: %v", l.file.Name(), err))
+	}
+}
+
+// withLockedFile locks the ledger file, reads the destinations that other runs recorded and calls the function
+func (l *LedgerOverrideChecker) withLockedFile(f func() error) (err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := lockFile(l.file); err != nil {
+		return fmt.Errorf("error locking file: %w", err)
+	}
+	defer func() {
+		if unlockErr := unlockFile(l.file); unlockErr != nil && err == nil {
+			err = fmt.Errorf("error unlocking file: %w", unlockErr)
+		}
+	}()
+
+	if err := l.readNewClaims(); err != nil {
+		return err
+	}
+	return f()
+}
+
+// withLedger wraps a FileProcessor to record the destination of each processed file in the ledger,
+// e.g. of sidecar files that were not claimed. It releases the claims of files that could not be processed.
+func withLedger(fileProcessor FileProcessor, ledger *LedgerOverrideChecker) FileProcessor {
+	return func(srcPath string, destPath string) error {
+		if err := fileProcessor(srcPath, destPath); err != nil {
+			ledger.release(destPath)
+			return err
+		}
+		if err := ledger.Record(destPath); err != nil {
+			ledger.OutputWriter.Warn(fmt.Sprintf("Error updating ledger file %s: %v", ledger.file.Name(), err))
+		}
+		return nil
+	}
+}
+
+// readNewClaims reads the destinations that other runs appended since the last read
+func (l *LedgerOverrideChecker) readNewClaims() error {
+	reader := bufio.NewReader(io.NewSectionReader(l.file, l.offset, 1<<62))
+	for {
+		line, err := reader.ReadString('\n')
+		if err == io.EOF {
+			// Ignore incomplete lines, they will be read when they are complete
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		l.offset += int64(len(line))
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		var record ledgerRecord
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			return fmt.Errorf("invalid record at offset %d: %w", l.offset-int64(len(line)), err)
+		}
+		if record.Released {
+			delete(l.claimed, record.Path)
+			continue
+		}
+		l.claimed[record.Path] = struct{}{}
+	}
+}
+
+// Close flushes the ledger to the disk and closes it
+func (l *LedgerOverrideChecker) Close() error {
+	syncErr := l.file.Sync()
+	if err := l.file.Close(); err != nil {
+		return err
+	}
+	if syncErr != nil {
+		return fmt.Errorf("error flushing ledger file %s: %w", l.file.Name(), syncErr)
+	}
+	return nil
+}
@@ -0,0 +1,294 @@
+package sorter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestLedgerOverrideChecker(t *testing.T) {
+	ledgerPath := filepath.Join(t.TempDir(), "ledger.jsonl")
+	first, err := NewLedgerOverrideChecker(ledgerPath, &NoOverrideChecker{}, &OutputWriter{Verbosity: Quiet, Writer: io.Discard})
+	if err != nil {
+		t.Fatalf("NewLedgerOverrideChecker returned error: %v", err)
+	}
+	defer first.Close()
+	second, err := NewLedgerOverrideChecker(ledgerPath, &NoOverrideChecker{}, &OutputWriter{Verbosity: Quiet, Writer: io.Discard})
+	if err != nil {
+		t.Fatalf("NewLedgerOverrideChecker returned error: %v", err)
+	}
+	defer second.Close()
+
+	if first.DestinationFileExists("src.mp3", "dest/a.mp3") {
+		t.Error("Expected dest/a.mp3 to be claimed by the first check")
+	}
+	if !first.DestinationFileExists("src.mp3", "dest/a.mp3") {
+		t.Error("Expected claimed dest/a.mp3 to exist in the same run")
+	}
+	if !second.DestinationFileExists("src.mp3", "dest/a.mp3") {
+		t.Error("Expected claimed dest/a.mp3 to exist in another run")
+	}
+	if err := second.Record("dest/b.mp3"); err != nil {
+		t.Fatalf("Record returned error: %v", err)
+	}
+	if err := second.Record("dest/b.mp3"); err != nil {
+		t.Fatalf("Record returned error: %v", err)
+	}
+	if !first.DestinationFileExists("src.mp3", "dest/b.mp3") {
+		t.Error("Expected dest/b.mp3 from another run to exist")
+	}
+
+	content, err := os.ReadFile(ledgerPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	var record ledgerRecord
+	if len(lines) != 2 || json.Unmarshal([]byte(lines[0]), &record) != nil || !filepath.IsAbs(record.Path) {
+		t.Errorf("Expected two JSON records with absolute paths in ledger, got %q", content)
+	}
+}
+
+func TestLedgerOverrideCheckerClaimsDestinationOnce(t *testing.T) {
+	ledgerPath := filepath.Join(t.TempDir(), "ledger.jsonl")
+	checkers := make([]*LedgerOverrideChecker, 2)
+	for i := range checkers {
+		checker, err := NewLedgerOverrideChecker(ledgerPath, &NoOverrideChecker{}, &OutputWriter{Verbosity: Quiet, Writer: io.Discard})
+		if err != nil {
+			t.Fatalf("NewLedgerOverrideChecker returned error: %v", err)
+		}
+		defer checker.Close()
+		checkers[i] = checker
+	}
+
+	for i := range 50 {
+		destPath := fmt.Sprintf("dest/%d.mp3", i)
+		claims := make(chan bool, len(checkers))
+		var wg sync.WaitGroup
+		for _, checker := range checkers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				claims <- !checker.DestinationFileExists("src.mp3", destPath)
+			}()
+		}
+		wg.Wait()
+		close(claims)
+		winners := 0
+		for claimed := range claims {
+			if claimed {
+				winners++
+			}
+		}
+		if winners != 1 {
+			t.Fatalf("Expected exactly one checker to claim %s, got %d", destPath, winners)
+		}
+	}
+}
+
+func TestLedgerOverrideCheckerReadOnly(t *testing.T) {
+	ledgerPath := filepath.Join(t.TempDir(), "ledger.jsonl")
+	checker, err := NewLedgerOverrideChecker(ledgerPath, &MemoryOverrideChecker{SeenFiles: make(map[string]struct{})}, &OutputWriter{Verbosity: Quiet, Writer: io.Discard})
+	if err != nil {
+		t.Fatalf("NewLedgerOverrideChecker returned error: %v", err)
+	}
+	defer checker.Close()
+	checker.ReadOnly = true
+
+	if checker.DestinationFileExists("src.mp3", "dest/a.mp3") {
+		t.Error("Expected dest/a.mp3 not to exist")
+	}
+	if !checker.DestinationFileExists("src.mp3", "dest/a.mp3") {
+		t.Error("Expected the policy checker to report dest/a.mp3 in the same run")
+	}
+	if content, _ := os.ReadFile(ledgerPath); len(content) > 0 {
+		t.Errorf("Expected the read-only checker not to write the ledger, got %q", content)
+	}
+}
+
+func TestLedgerOverrideCheckerUsesPolicyChecker(t *testing.T) {
+	destPath := filepath.Join(t.TempDir(), "a.mp3")
+	if err := os.WriteFile(destPath, []byte("existing"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	policyChecker := &FilesystemOverrideChecker{MemoryOverrideChecker{SeenFiles: make(map[string]struct{})}}
+	checker, err := NewLedgerOverrideChecker(filepath.Join(t.TempDir(), "ledger.jsonl"), policyChecker, &OutputWriter{Verbosity: Quiet, Writer: io.Discard})
+	if err != nil {
+		t.Fatalf("NewLedgerOverrideChecker returned error: %v", err)
+	}
+	defer checker.Close()
+
+	if !checker.DestinationFileExists("src.mp3", destPath) {
+		t.Error("Expected the existing destination to be skipped by the policy checker")
+	}
+}
+
+func TestLedgerOverrideCheckerReleasesDestinations(t *testing.T) {
+	ledgerPath := filepath.Join(t.TempDir(), "ledger.jsonl")
+	first, err := NewLedgerOverrideChecker(ledgerPath, &MemoryOverrideChecker{SeenFiles: make(map[string]struct{})}, &OutputWriter{Verbosity: Quiet, Writer: io.Discard})
+	if err != nil {
+		t.Fatalf("NewLedgerOverrideChecker returned error: %v", err)
+	}
+	defer first.Close()
+	second, err := NewLedgerOverrideChecker(ledgerPath, &NoOverrideChecker{}, &OutputWriter{Verbosity: Quiet, Writer: io.Discard})
+	if err != nil {
+		t.Fatalf("NewLedgerOverrideChecker returned error: %v", err)
+	}
+	defer second.Close()
+
+	if first.DestinationFileExists("src.mp3", "dest/a.mp3") {
+		t.Fatal("Expected dest/a.mp3 not to exist")
+	}
+	if !second.DestinationFileExists("src.mp3", "dest/a.mp3") {
+		t.Error("Expected claimed dest/a.mp3 to exist in another run")
+	}
+	second.release("dest/a.mp3")
+	if !first.DestinationFileExists("src.mp3", "dest/a.mp3") {
+		t.Error("Expected another run not to release the claim of dest/a.mp3")
+	}
+	first.release("dest/a.mp3")
+	if second.DestinationFileExists("src.mp3", "dest/a.mp3") {
+		t.Error("Expected released dest/a.mp3 to be claimed by another run")
+	}
+	if !first.DestinationFileExists("src.mp3", "dest/a.mp3") {
+		t.Error("Expected dest/a.mp3 that another run claimed again to exist")
+	}
+}
+
+func TestLedgerOverrideCheckerReadsExistingClaims(t *testing.T) {
+	ledgerPath := filepath.Join(t.TempDir(), "ledger.jsonl")
+	claimedPath, _ := filepath.Abs("dest/a.mp3")
+	releasedPath, _ := filepath.Abs("dest/b.mp3")
+	records := fmt.Sprintf("{\"path\":%q}\n{\"path\":%q}\n{\"path\":%q,\"released\":true}\n", claimedPath, releasedPath, releasedPath)
+	if err := os.WriteFile(ledgerPath, []byte(records), 0644); err != nil {
+		t.Fatal(err)
+	}
+	checker, err := NewLedgerOverrideChecker(ledgerPath, &NoOverrideChecker{}, &OutputWriter{Verbosity: Quiet, Writer: io.Discard})
+	if err != nil {
+		t.Fatalf("NewLedgerOverrideChecker returned error: %v", err)
+	}
+	defer checker.Close()
+
+	if !checker.DestinationFileExists("src.mp3", "dest/a.mp3") {
+		t.Error("Expected claim from previous run to be found")
+	}
+	if checker.DestinationFileExists("src.mp3", "dest/b.mp3") {
+		t.Error("Expected released claim from previous run not to be found")
+	}
+}
+
+func TestNewLedgerOverrideCheckerRejectsInvalidLedger(t *testing.T) {
+	ledgerPath := filepath.Join(t.TempDir(), "ledger.jsonl")
+	if err := os.WriteFile(ledgerPath, []byte("/dest/a.mp3\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewLedgerOverrideChecker(ledgerPath, &NoOverrideChecker{}, &OutputWriter{Verbosity: Quiet, Writer: io.Discard}); err == nil {
+		t.Error("Expected error for a ledger that is not in the JSON Lines format")
+	}
+}
+
+func TestRunSkipsDestinationsRecordedByEarlierRun(t *testing.T) {
+	srcDir := t.TempDir()
+	srcPath := filepath.Join(srcDir, "track.flac")
+	destDir := filepath.Join(t.TempDir(), "sorted")
+	ledgerPath := filepath.Join(t.TempDir(), "ledger.jsonl")
+	run := func(content []byte) error {
+		if err := os.WriteFile(srcPath, content, 0644); err != nil {
+			t.Fatal(err)
+		}
+		mediaSorter, err := New(&Config{DestDir: destDir, Ledger: ledgerPath, ReportSkipsAsErrors: true, Output: io.Discard})
+		if err != nil {
+			t.Fatalf("New returned error: %v", err)
+		}
+		err = mediaSorter.Run(srcDir)
+		if closeErr := mediaSorter.Close(); closeErr != nil {
+			t.Fatalf("Close returned error: %v", closeErr)
+		}
+		return err
+	}
+
+	first := flacStream("TITLE=Title", "ARTIST=Artist", "ALBUM=Album")
+	if err := run(first); err != nil {
+		t.Fatalf("First run returned error: %v", err)
+	}
+	err := run(flacStream("TITLE=Title", "ARTIST=Artist", "ALBUM=Album", "COMMENT=changed"))
+	if err == nil || err.Error() != "skipped 1 files (1 collision)" {
+		t.Errorf("Expected second run to skip the recorded destination, got %v", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(destDir, "Artist", "Album", "Title.flac"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != string(first) {
+		t.Error("Expected the file of the first run to be kept")
+	}
+}
+
+func TestRunRecordsOnlyWrittenDestinationsInLedger(t *testing.T) {
+	srcDir := t.TempDir()
+	destDir := filepath.Join(t.TempDir(), "sorted")
+	ledgerPath := filepath.Join(t.TempDir(), "ledger.jsonl")
+	files := map[string][]byte{
+		"one.flac": flacStream("TITLE=One", "ARTIST=Artist", "ALBUM=Album"),
+		"two.flac": flacStream("TITLE=Two", "ARTIST=Artist", "ALBUM=Album"),
+	}
+	writeSourceFiles(t, srcDir, files)
+	errBroken := errors.New("broken file")
+	run := func(config *Config, fileProcessor FileProcessor) error {
+		mediaSorter, err := New(config)
+		if err != nil {
+			t.Fatalf("New returned error: %v", err)
+		}
+		if fileProcessor != nil {
+			mediaSorter.FileProcessor = withLedger(fileProcessor, mediaSorter.OverrideChecker.(*LedgerOverrideChecker))
+		}
+		err = mediaSorter.Run(srcDir)
+		if closeErr := mediaSorter.Close(); closeErr != nil {
+			t.Fatalf("Close returned error: %v", closeErr)
+		}
+		return err
+	}
+
+	if err := run(&Config{DestDir: destDir, Ledger: ledgerPath, DryRun: true, Verbosity: Quiet, Output: io.Discard}, nil); err != nil {
+		t.Fatalf("Dry run returned error: %v", err)
+	}
+	if content, _ := os.ReadFile(ledgerPath); len(content) > 0 {
+		t.Errorf("Expected the dry run not to write the ledger, got %q", content)
+	}
+
+	failTwo := func(srcPath string, destPath string) error {
+		if filepath.Base(srcPath) == "two.flac" {
+			return errBroken
+		}
+		return CopyFile(srcPath, destPath)
+	}
+	if err := run(&Config{DestDir: destDir, Ledger: ledgerPath, KeepGoing: true, Output: io.Discard}, failTwo); !errors.Is(err, errBroken) {
+		t.Fatalf("Expected the error of the broken file, got %v", err)
+	}
+	ledger, err := NewLedgerOverrideChecker(ledgerPath, &NoOverrideChecker{}, &OutputWriter{Verbosity: Quiet, Writer: io.Discard})
+	if err != nil {
+		t.Fatalf("NewLedgerOverrideChecker returned error: %v", err)
+	}
+	ledger.ReadOnly = true
+	if !ledger.DestinationFileExists("one.flac", filepath.Join(destDir, "Artist", "Album", "One.flac")) {
+		t.Error("Expected the written file in the ledger")
+	}
+	if ledger.DestinationFileExists("two.flac", filepath.Join(destDir, "Artist", "Album", "Two.flac")) {
+		t.Error("Expected the claim of the failed file to be released")
+	}
+	ledger.Close()
+
+	if err := run(&Config{DestDir: destDir, Ledger: ledgerPath, ReportSkipsAsErrors: true, Output: io.Discard}, nil); err == nil || err.Error() != "skipped 1 files (1 collision)" {
+		t.Errorf("Expected the next run to skip only the recorded destination, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(destDir, "Artist", "Album", "Two.flac")); err != nil {
+		t.Errorf("Expected the failed file to be written by the next run: %v", err)
+	}
+}
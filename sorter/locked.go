@@ -0,0 +1,75 @@
+package sorter
+
+import (
+	"fmt"
+	"time"
+)
+
+// LockedFilePolicy determines what happens when a file is locked by another program
+type LockedFilePolicy string
+
+const (
+	SkipLockedFiles  LockedFilePolicy = "skip"
+	RetryLockedFiles LockedFilePolicy = "retry"
+	FailLockedFiles  LockedFilePolicy = "fail"
+)
+
+// Number of retries and delay before the first retry for RetryLockedFiles, the delay doubles with every retry
+const (
+	lockedFileRetries    = 3
+	lockedFileRetryDelay = 500 * time.Millisecond
+)
+
+func ParseLockedFilePolicy(policy string) (LockedFilePolicy, error) {
+	switch LockedFilePolicy(policy) {
+	case SkipLockedFiles, RetryLockedFiles, FailLockedFiles:
+		return LockedFilePolicy(policy), nil
+	}
+	return "", fmt.Errorf("invalid policy for locked files '%s', must be one of %s, %s or %s", policy, SkipLockedFiles, RetryLockedFiles, FailLockedFiles)
+}
+
+type FileLockedError struct {
+	srcPath string
+	err     error
+}
+
+func (err *FileLockedError) Error() string {
+	return fmt.Sprintf("File %s is locked by another program, skipping: %v", err.srcPath, err.err)
+}
+
+func (err *FileLockedError) Unwrap() error {
+	return err.err
+}
+
+func (err *FileLockedError) Is(target error) bool {
+	return target == ErrLocked
+}
+
+// withLockedFilePolicy wraps a FileProcessor to handle files that are locked by other programs
+func withLockedFilePolicy(fileProcessor FileProcessor, policy LockedFilePolicy, outputWriter *OutputWriter) FileProcessor {
+	return handleLockedFiles(fileProcessor, policy, outputWriter, isLockedFileError, lockedFileRetryDelay)
+}
+
+// handleLockedFiles wraps the FileProcessor with the policy for errors where isLocked returns true
+func handleLockedFiles(fileProcessor FileProcessor, policy LockedFilePolicy, outputWriter *OutputWriter, isLocked func(err error) bool, retryDelay time.Duration) FileProcessor {
+	if policy == FailLockedFiles {
+		return fileProcessor
+	}
+	return func(srcPath string, destPath string) error {
+		err := fileProcessor(srcPath, destPath)
+		if policy == RetryLockedFiles {
+			delay := retryDelay
+			for retry := 1; retry <= lockedFileRetries && isLocked(err); retry++ {
+				outputWriter.Info(fmt.Sprintf("File %s is locked, retrying in %s (%d/%d)", srcPath, delay, retry, lockedFileRetries))
+				time.Sleep(delay)
+				delay *= 2
+				err = fileProcessor(srcPath, destPath)
+			}
+			return err
+		}
+		if isLocked(err) {
+			return &FileLockedError{srcPath: srcPath, err: err}
+		}
+		return err
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !windows
+
+package sorter
+
+// Other operating systems don't prevent reading, moving or deleting files that are opened by another process
+func isLockedFileError(err error) bool {
+	return false
+}
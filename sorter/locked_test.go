@@ -0,0 +1,107 @@
+package sorter
+
+import (
+	"errors"
+	"io"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseLockedFilePolicy(t *testing.T) {
+	for _, policy := range []string{"skip", "retry", "fail"} {
+		actual, err := ParseLockedFilePolicy(policy)
+		if err != nil {
+			t.Errorf("ParseLockedFilePolicy(%q) returned error: %v", policy, err)
+		}
+		if string(actual) != policy {
+			t.Errorf("ParseLockedFilePolicy(%q) = %q", policy, actual)
+		}
+	}
+
+	if _, err := ParseLockedFilePolicy("wait"); err == nil {
+		t.Error("Expected error for invalid policy")
+	}
+}
+
+func TestWithLockedFilePolicyPassesOtherErrors(t *testing.T) {
+	processorErr := errors.New("disk full")
+	processor := func(srcPath string, destPath string) error {
+		return processorErr
+	}
+	for _, policy := range []LockedFilePolicy{SkipLockedFiles, RetryLockedFiles, FailLockedFiles} {
+		err := withLockedFilePolicy(processor, policy, &OutputWriter{Verbosity: Quiet, Writer: io.Discard})("src", "dest")
+		if err != processorErr {
+			t.Errorf("Expected original error for policy %s, got %v", policy, err)
+		}
+	}
+}
+
+var errTestLocked = errors.New("file is open in another program")
+
+func isTestLockedError(err error) bool {
+	return errors.Is(err, errTestLocked)
+}
+
+// lockedProcessor returns a FileProcessor that fails with a locked file error for the first calls
+func lockedProcessor(lockedCalls int, calls *int) FileProcessor {
+	return func(srcPath string, destPath string) error {
+		*calls++
+		if *calls <= lockedCalls {
+			return errTestLocked
+		}
+		return nil
+	}
+}
+
+func TestHandleLockedFiles(t *testing.T) {
+	tests := []struct {
+		description   string
+		policy        LockedFilePolicy
+		lockedCalls   int
+		expectedCalls int
+		expectedErr   error
+		skipped       bool
+	}{
+		{"skip", SkipLockedFiles, 1, 1, ErrLocked, true},
+		{"retry until unlocked", RetryLockedFiles, 2, 3, nil, false},
+		{"retry gives up", RetryLockedFiles, 10, lockedFileRetries + 1, errTestLocked, false},
+		{"fail", FailLockedFiles, 1, 1, errTestLocked, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			calls := 0
+			processor := handleLockedFiles(lockedProcessor(test.lockedCalls, &calls), test.policy, &OutputWriter{Verbosity: Quiet, Writer: io.Discard}, isTestLockedError, 0)
+			err := processor("src", "dest")
+			if !errors.Is(err, test.expectedErr) || (test.expectedErr == nil && err != nil) {
+				t.Errorf("Expected error %v, got %v", test.expectedErr, err)
+			}
+			if _, skipped := SkipReasonOf(err); skipped != test.skipped {
+				t.Errorf("Expected skipped %v, got %v", test.skipped, skipped)
+			}
+			if calls != test.expectedCalls {
+				t.Errorf("Expected %d calls, got %d", test.expectedCalls, calls)
+			}
+		})
+	}
+}
+
+func TestRunSkipsLockedFiles(t *testing.T) {
+	srcDir := t.TempDir()
+	writeSourceFiles(t, srcDir, map[string][]byte{
+		"track.flac": flacStream("TITLE=Title", "ARTIST=Artist", "ALBUM=Album"),
+	})
+	mediaSorter, err := New(&Config{DestDir: filepath.Join(t.TempDir(), "sorted"), Output: io.Discard, ErrOutput: io.Discard})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	calls := 0
+	mediaSorter.FileProcessor = handleLockedFiles(lockedProcessor(1, &calls), SkipLockedFiles, mediaSorter.OutputWriter, isTestLockedError, 0)
+
+	if err := mediaSorter.Run(srcDir); err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+	if mediaSorter.skipped[SkipLocked] != 1 {
+		t.Errorf("Expected 1 skipped locked file, got %d", mediaSorter.skipped[SkipLocked])
+	}
+}
@@ -0,0 +1,18 @@
+//go:build windows
+
+package sorter
+
+import (
+	"errors"
+	"syscall"
+)
+
+// Windows error codes for files that are opened by another process
+const (
+	errorSharingViolation syscall.Errno = 32
+	errorLockViolation    syscall.Errno = 33
+)
+
+func isLockedFileError(err error) bool {
+	return errors.Is(err, errorSharingViolation) || errors.Is(err, errorLockViolation)
+}
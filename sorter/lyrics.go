@@ -0,0 +1,63 @@
+package sorter
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/dhowden/tag"
+)
+
+// Raw tag names for unsynchronized lyrics, for tags that the tag library doesn't read as lyrics
+var lyricsTags = []string{"lyrics", "LYRICS", "unsyncedlyrics", "USLT", "ULT", "\xa9lyr"}
+
+// readLyrics returns the embedded lyrics of a file
+func readLyrics(rawMetadata tag.Metadata) string {
+	if lyrics := rawMetadata.Lyrics(); lyrics != "" {
+		return lyrics
+	}
+	return rawString(rawMetadata.Raw(), lyricsTags...)
+}
+
+// LyricsWriter writes lyrics into a file
+type LyricsWriter func(lyrics string, destPath string) error
+
+func DryRunLyricsWriter(lyrics string, destPath string) error {
+	return nil
+}
+
+func WriteLyricsFile(lyrics string, destPath string) error {
+	if err := createDestinationDir(destPath); err != nil {
+		return err
+	}
+	if err := os.WriteFile(destPath, []byte(lyrics), 0644); err != nil {
+		return fmt.Errorf("error writing lyrics to %s: %w", destPath, err)
+	}
+	return nil
+}
+
+// extractLyrics writes the embedded lyrics of the media file into a .lrc file next to the destination,
+// unless the file group already has a .lrc file or the destination exists. The transaction records the lyrics file.
+func (m *MediaSorter) extractLyrics(group *FileGroup, dest *destination, tx *groupTransaction) error {
+	if dest.metadata.Lyrics == "" {
+		return nil
+	}
+	hasLyricsFile := slices.ContainsFunc(group.SidecarFiles, func(sidecarFile string) bool {
+		return normalizeExtension(filepath.Ext(sidecarFile)) == "lrc"
+	})
+	if hasLyricsFile {
+		return nil
+	}
+
+	lyricsPath := filepath.Join(m.DestDir, dest.pathStr+".lrc")
+	if _, err := os.Lstat(lyricsPath); err == nil {
+		m.OutputWriter.Info(fmt.Sprintf("Lyrics file %s already exists, skipping lyrics of %s", lyricsPath, group.MediaFile))
+		return nil
+	}
+
+	m.OutputWriter.Info(fmt.Sprintf("Extracting lyrics %s -> %s", group.MediaFile, lyricsPath))
+	return tx.create("", lyricsPath, func() error {
+		return m.LyricsWriter(dest.metadata.Lyrics, lyricsPath)
+	})
+}
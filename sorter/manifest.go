@@ -0,0 +1,225 @@
+package sorter
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ManifestRecord describes a file action for the manifest.
+// The metadata fields are empty for sidecar files and for files without readable tags.
+type ManifestRecord struct {
+	Action      string `json:"action"`
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+	Error       string `json:"error,omitempty"`
+	Artist      string `json:"artist,omitempty"`
+	Album       string `json:"album,omitempty"`
+	Track       int    `json:"track,omitempty"`
+	Title       string `json:"title,omitempty"`
+}
+
+// setMetadata fills the metadata fields of the record
+func (r *ManifestRecord) setMetadata(metadata *Metadata) {
+	if metadata == nil {
+		return
+	}
+	r.Artist = metadata.Artist
+	r.Album = metadata.Album
+	r.Track = metadata.Track
+	r.Title = metadata.Title
+}
+
+// ManifestWriter writes records of file actions in a specific format.
+// Close must be called after the last record, to finish the format, but does not close the underlying writer.
+type ManifestWriter interface {
+	WriteRecord(record ManifestRecord) error
+	Close() error
+}
+
+// manifestFormats contains a constructor for each manifest format. To add a new format, add its constructor here.
+var manifestFormats = map[string]func(w io.Writer) ManifestWriter{
+	"json":   func(w io.Writer) ManifestWriter { return &JSONManifestWriter{w: w} },
+	"ndjson": func(w io.Writer) ManifestWriter { return &NDJSONManifestWriter{encoder: json.NewEncoder(w)} },
+	"csv":    func(w io.Writer) ManifestWriter { return NewCSVManifestWriter(w, ',') },
+	"tsv":    func(w io.Writer) ManifestWriter { return NewCSVManifestWriter(w, '\t') },
+	"list":   func(w io.Writer) ManifestWriter { return &ListManifestWriter{w: w} },
+}
+
+func ManifestFormatNames() []string {
+	names := make([]string, 0, len(manifestFormats))
+	for name := range manifestFormats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func NewManifestWriter(format string, w io.Writer) (ManifestWriter, error) {
+	constructor, exists := manifestFormats[format]
+	if !exists {
+		return nil, fmt.Errorf("unknown manifest format '%s', must be one of %s", format, strings.Join(ManifestFormatNames(), ", "))
+	}
+	return constructor(w), nil
+}
+
+// JSONManifestWriter writes all records as one JSON array
+type JSONManifestWriter struct {
+	w       io.Writer
+	started bool
+}
+
+func (j *JSONManifestWriter) WriteRecord(record ManifestRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	separator := ",\n"
+	if !j.started {
+		separator = "[\n"
+		j.started = true
+	}
+	_, err = fmt.Fprintf(j.w, "%s%s", separator, data)
+	return err
+}
+
+func (j *JSONManifestWriter) Close() error {
+	if !j.started {
+		_, err := io.WriteString(j.w, "[]\n")
+		return err
+	}
+	_, err := io.WriteString(j.w, "\n]\n")
+	return err
+}
+
+// NDJSONManifestWriter writes each record as a JSON object on its own line
+type NDJSONManifestWriter struct {
+	encoder *json.Encoder
+}
+
+func (n *NDJSONManifestWriter) WriteRecord(record ManifestRecord) error {
+	return n.encoder.Encode(record)
+}
+
+func (n *NDJSONManifestWriter) Close() error {
+	return nil
+}
+
+// CSVManifestWriter writes records as rows with a header, separated by a configurable character
+type CSVManifestWriter struct {
+	writer        *csv.Writer
+	headerWritten bool
+}
+
+func NewCSVManifestWriter(w io.Writer, separator rune) *CSVManifestWriter {
+	writer := csv.NewWriter(w)
+	writer.Comma = separator
+	return &CSVManifestWriter{writer: writer}
+}
+
+func (c *CSVManifestWriter) WriteRecord(record ManifestRecord) error {
+	if err := c.writeHeader(); err != nil {
+		return err
+	}
+	track := ""
+	if record.Track > 0 {
+		track = strconv.Itoa(record.Track)
+	}
+	return c.writer.Write([]string{record.Action, record.Source, record.Destination, record.Error, record.Artist, record.Album, track, record.Title})
+}
+
+func (c *CSVManifestWriter) writeHeader() error {
+	if c.headerWritten {
+		return nil
+	}
+	c.headerWritten = true
+	return c.writer.Write([]string{"action", "source", "destination", "error", "artist", "album", "track", "title"})
+}
+
+func (c *CSVManifestWriter) Close() error {
+	if err := c.writeHeader(); err != nil {
+		return err
+	}
+	c.writer.Flush()
+	return c.writer.Error()
+}
+
+// ListManifestWriter writes the source and destination of each successful action, separated by a tab
+type ListManifestWriter struct {
+	w io.Writer
+}
+
+func (l *ListManifestWriter) WriteRecord(record ManifestRecord) error {
+	if record.Error != "" {
+		return nil
+	}
+	_, err := fmt.Fprintf(l.w, "%s\t%s\n", record.Source, record.Destination)
+	return err
+}
+
+func (l *ListManifestWriter) Close() error {
+	return nil
+}
+
+// manifestFile is a ManifestWriter that closes its file after finishing the manifest
+type manifestFile struct {
+	ManifestWriter
+	file *os.File
+}
+
+func CreateManifestFile(path string, format string) (ManifestWriter, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("error creating manifest file %s: %w", path, err)
+	}
+	writer, err := NewManifestWriter(format, file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &manifestFile{ManifestWriter: writer, file: file}, nil
+}
+
+func (m *manifestFile) Close() error {
+	err := m.ManifestWriter.Close()
+	if closeErr := m.file.Close(); closeErr != nil && err == nil {
+		err = fmt.Errorf("error closing manifest file %s: %w", m.file.Name(), closeErr)
+	}
+	return err
+}
+
+// syncManifestWriter is a ManifestWriter for parallel jobs and skipped files that write records at the same time
+type syncManifestWriter struct {
+	ManifestWriter
+	mu sync.Mutex
+}
+
+func (s *syncManifestWriter) WriteRecord(record ManifestRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ManifestWriter.WriteRecord(record)
+}
+
+// withManifest wraps a FileProcessor to write a record of each action to the manifest.
+// metadataOf returns the metadata for the record of a file, or nil if the file has none.
+func withManifest(fileProcessor FileProcessor, action string, manifest ManifestWriter, metadataOf func(srcPath string) *Metadata) FileProcessor {
+	return func(srcPath string, destPath string) error {
+		err := fileProcessor(srcPath, destPath)
+		record := ManifestRecord{Action: action, Source: srcPath, Destination: destPath}
+		record.setMetadata(metadataOf(srcPath))
+		if err != nil {
+			record.Error = err.Error()
+		}
+		manifestErr := manifest.WriteRecord(record)
+		if manifestErr != nil && err == nil {
+			return fmt.Errorf("error writing manifest: %w", manifestErr)
+		}
+		return err
+	}
+}
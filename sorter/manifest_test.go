@@ -0,0 +1,209 @@
+package sorter
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+var testManifestRecords = []ManifestRecord{
+	{Action: "copy", Source: "src/a.mp3", Destination: "dest/Artist/a.mp3", Artist: "Artist", Album: "Album, Live", Track: 1, Title: "A"},
+	{Action: "copy", Source: "src/b, c.mp3", Destination: "dest/Artist/b.mp3", Error: "disk full"},
+}
+
+func TestManifestWriters(t *testing.T) {
+	tests := []struct {
+		format   string
+		expected string
+	}{
+		{"json", `[
+{"action":"copy","source":"src/a.mp3","destination":"dest/Artist/a.mp3","artist":"Artist","album":"Album, Live","track":1,"title":"A"},
+{"action":"copy","source":"src/b, c.mp3","destination":"dest/Artist/b.mp3","error":"disk full"}
+]
+`},
+		{"ndjson", `{"action":"copy","source":"src/a.mp3","destination":"dest/Artist/a.mp3","artist":"Artist","album":"Album, Live","track":1,"title":"A"}
+{"action":"copy","source":"src/b, c.mp3","destination":"dest/Artist/b.mp3","error":"disk full"}
+`},
+		{"csv", `action,source,destination,error,artist,album,track,title
+copy,src/a.mp3,dest/Artist/a.mp3,,Artist,"Album, Live",1,A
+copy,"src/b, c.mp3",dest/Artist/b.mp3,disk full,,,,
+`},
+		{"tsv", "action\tsource\tdestination\terror\tartist\talbum\ttrack\ttitle\ncopy\tsrc/a.mp3\tdest/Artist/a.mp3\t\tArtist\tAlbum, Live\t1\tA\ncopy\tsrc/b, c.mp3\tdest/Artist/b.mp3\tdisk full\t\t\t\t\n"},
+		{"list", "src/a.mp3\tdest/Artist/a.mp3\n"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.format, func(t *testing.T) {
+			var buf bytes.Buffer
+			writer, err := NewManifestWriter(test.format, &buf)
+			if err != nil {
+				t.Fatalf("NewManifestWriter(%q) returned error: %v", test.format, err)
+			}
+			for _, record := range testManifestRecords {
+				if err := writer.WriteRecord(record); err != nil {
+					t.Fatalf("WriteRecord returned error: %v", err)
+				}
+			}
+			if err := writer.Close(); err != nil {
+				t.Fatalf("Close returned error: %v", err)
+			}
+			if buf.String() != test.expected {
+				t.Errorf("Expected manifest\n%s\nbut got\n%s", test.expected, buf.String())
+			}
+		})
+	}
+}
+
+func TestEmptyManifests(t *testing.T) {
+	tests := []struct {
+		format   string
+		expected string
+	}{
+		{"json", "[]\n"},
+		{"ndjson", ""},
+		{"csv", "action,source,destination,error,artist,album,track,title\n"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.format, func(t *testing.T) {
+			var buf bytes.Buffer
+			writer, _ := NewManifestWriter(test.format, &buf)
+			if err := writer.Close(); err != nil {
+				t.Fatalf("Close returned error: %v", err)
+			}
+			if buf.String() != test.expected {
+				t.Errorf("Expected manifest %q but got %q", test.expected, buf.String())
+			}
+		})
+	}
+}
+
+func TestNewManifestWriterRejectsUnknownFormat(t *testing.T) {
+	if _, err := NewManifestWriter("xml", &bytes.Buffer{}); err == nil {
+		t.Error("Expected error for unknown format")
+	}
+}
+
+func TestWithManifestRecordsErrors(t *testing.T) {
+	var buf bytes.Buffer
+	manifest, _ := NewManifestWriter("list", &buf)
+	processorErr := errors.New("disk full")
+	processor := withManifest(func(srcPath string, destPath string) error {
+		if srcPath == "fail.mp3" {
+			return processorErr
+		}
+		return nil
+	}, "copy", manifest, func(srcPath string) *Metadata { return nil })
+
+	if err := processor("ok.mp3", "dest/ok.mp3"); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+	if err := processor("fail.mp3", "dest/fail.mp3"); err != processorErr {
+		t.Errorf("Expected processor error, got %v", err)
+	}
+	if buf.String() != "ok.mp3\tdest/ok.mp3\n" {
+		t.Errorf("Unexpected manifest %q", buf.String())
+	}
+}
+
+func TestRunWritesSkippedFilesToManifest(t *testing.T) {
+	srcDir := writeCollidingFiles(t)
+	destDir := filepath.Join(t.TempDir(), "sorted")
+	manifestPath := filepath.Join(t.TempDir(), "report.json")
+
+	mediaSorter, err := New(&Config{DestDir: destDir, DryRun: true, OnExists: SkipExisting, Manifest: manifestPath, ManifestFormat: "json", Output: io.Discard})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	if err := mediaSorter.Run(srcDir); err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+	if err := mediaSorter.Close(); err != nil {
+		t.Fatalf("Close returned error: %v", err)
+	}
+
+	content, err := os.ReadFile(manifestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var records []ManifestRecord
+	if err := json.Unmarshal(content, &records); err != nil {
+		t.Fatalf("Manifest is not valid JSON: %v\n%s", err, content)
+	}
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 records, got %v", records)
+	}
+	actions := map[string]ManifestRecord{}
+	for _, record := range records {
+		actions[record.Action] = record
+	}
+	planned, skipped := actions["dry-run"], actions["skip"]
+	expectedDest := filepath.Join(destDir, "Artist", "Album", "Title.flac")
+	if planned.Destination != expectedDest || planned.Error != "" {
+		t.Errorf("Expected planned record for %s, got %+v", expectedDest, planned)
+	}
+	if skipped.Destination != expectedDest || skipped.Error == "" || skipped.Source == planned.Source {
+		t.Errorf("Expected skip record with error for the other file, got %+v", skipped)
+	}
+}
+
+func TestRunWritesMetadataToCSVManifest(t *testing.T) {
+	srcDir := t.TempDir()
+	files := map[string][]byte{
+		"one.flac": flacStream("TITLE=First", "ARTIST=Artist", "ALBUM=Album, Deluxe", "TRACKNUMBER=1"),
+		"two.flac": flacStream("TITLE=Second", "ARTIST=Artist", "ALBUM=Album, Deluxe", "TRACKNUMBER=2"),
+	}
+	writeSourceFiles(t, srcDir, files)
+	destDir := filepath.Join(t.TempDir(), "sorted")
+	manifestPath := filepath.Join(t.TempDir(), "manifest.csv")
+
+	mediaSorter, err := New(&Config{DestDir: destDir, DryRun: true, Manifest: manifestPath, ManifestFormat: "csv", Output: io.Discard})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	if err := mediaSorter.Run(srcDir); err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+	if err := mediaSorter.Close(); err != nil {
+		t.Fatalf("Close returned error: %v", err)
+	}
+
+	file, err := os.Open(manifestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	rows, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		t.Fatalf("Manifest is not valid CSV: %v", err)
+	}
+	expectedHeader := []string{"action", "source", "destination", "error", "artist", "album", "track", "title"}
+	if len(rows) != 3 || !slices.Equal(rows[0], expectedHeader) {
+		t.Fatalf("Expected header %v and 2 rows, got %v", expectedHeader, rows)
+	}
+	// Files are processed in no particular order
+	slices.SortFunc(rows[1:], func(a, b []string) int { return strings.Compare(a[6], b[6]) })
+	expectedRows := []struct {
+		source string
+		fields []string
+	}{
+		{"one.flac", []string{"Artist", "Album, Deluxe", "1", "First"}},
+		{"two.flac", []string{"Artist", "Album, Deluxe", "2", "Second"}},
+	}
+	for i, expected := range expectedRows {
+		row := rows[i+1]
+		if row[1] != filepath.Join(srcDir, expected.source) {
+			t.Errorf("Expected source %s, got %v", expected.source, row)
+		}
+		if !slices.Equal(row[4:], expected.fields) {
+			t.Errorf("Expected metadata %v, got %v", expected.fields, row[4:])
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package sorter
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/dhowden/tag"
+)
+
+// Raw tag names for the marker of files that were already sorted. Vorbis comment names are lowercase,
+// ID3 uses the description of a TXXX frame, MP4 the name of a custom ("----") atom.
+var markerTags = []string{"mediasorter", "MEDIASORTER"}
+
+// markerTagName is the name of the tag that WriteMarkerTag writes
+const markerTagName = "MEDIASORTER"
+
+// MarkerWriter writes the marker of sorted files into a media file
+type MarkerWriter func(marker string, fileType tag.FileType, destPath string) error
+
+func DryRunMarkerWriter(marker string, fileType tag.FileType, destPath string) error {
+	return nil
+}
+
+// WriteMarkerTag writes the marker into the MEDIASORTER tag of FLAC and MP3 files.
+// For other file types, it returns an error that matches ErrTagWritingNotSupported.
+func WriteMarkerTag(marker string, fileType tag.FileType, destPath string) error {
+	return writeTextTag(destPath, fileType, markerTagName, marker)
+}
+
+// MarkedFileError occurs when a media file has the marker of files that were already sorted
+type MarkedFileError struct {
+	srcPath string
+	marker  string
+}
+
+func (err *MarkedFileError) Error() string {
+	return fmt.Sprintf("File %s has the marker '%s', it's already sorted, skipping", err.srcPath, err.marker)
+}
+
+func (err *MarkedFileError) Is(target error) bool {
+	return target == ErrAlreadySorted
+}
+
+// checkMarker returns a MarkedFileError if the file has the marker of sorted files.
+// An empty SkipMarker turns the check off.
+func (m *MediaSorter) checkMarker(srcPath MediaFile, metadata *Metadata) error {
+	if m.SkipMarker == "" || metadata.Marker != m.SkipMarker {
+		return nil
+	}
+	return &MarkedFileError{srcPath: string(srcPath), marker: metadata.Marker}
+}
+
+// writeMarker writes the marker into the processed media file. It only warns about file types
+// that can't get a marker, because the file itself was processed.
+func (m *MediaSorter) writeMarker(dest *destination) error {
+	m.OutputWriter.Info(fmt.Sprintf("Writing marker '%s' into %s", m.WriteMarker, dest.destPath))
+	err := m.MarkerWriter(m.WriteMarker, dest.metadata.FileType, dest.destPath)
+	if errors.Is(err, ErrTagWritingNotSupported) {
+		m.OutputWriter.Warn(fmt.Sprintf("Could not write the marker into %s: %v", dest.destPath, err))
+		return nil
+	}
+	return err
+}
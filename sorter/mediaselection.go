@@ -0,0 +1,77 @@
+package sorter
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+)
+
+// MediaSelection determines which file becomes the media file, when a group contains several media files
+type MediaSelection string
+
+const (
+	// Choose the file with the highest priority of its extension
+	SelectByPriority MediaSelection = "priority"
+	// Choose the file with the most populated metadata fields
+	SelectByTags MediaSelection = "tags"
+	// Choose the largest file, e.g. the full track instead of a preview clip
+	SelectBySize MediaSelection = "size"
+)
+
+func ParseMediaSelection(selection string) (MediaSelection, error) {
+	switch MediaSelection(selection) {
+	case SelectByPriority, SelectByTags, SelectBySize:
+		return MediaSelection(selection), nil
+	}
+	return "", fmt.Errorf("invalid media selection '%s', must be one of %s, %s or %s", selection, SelectByPriority, SelectByTags, SelectBySize)
+}
+
+// populatedFields returns the number of metadata fields with a value, not counting the format fields
+func populatedFields(metadata *Metadata) int {
+	count := 0
+	value := reflect.ValueOf(metadata).Elem()
+	for i := 0; i < value.NumField(); i++ {
+		name := value.Type().Field(i).Name
+		if name == "Format" || name == "FileType" {
+			continue
+		}
+		if !value.Field(i).IsZero() {
+			count++
+		}
+	}
+	return count
+}
+
+// mediaScore rates a media file for the selection, higher is better. Unreadable files get -1.
+func (m *MetaDataReader) mediaScore(path string) int64 {
+	switch m.MediaSelection {
+	case SelectByTags:
+		metadata, err := m.ReadMetadata(MediaFile(path))
+		if err != nil {
+			return -1
+		}
+		return int64(populatedFields(metadata))
+	case SelectBySize:
+		info, err := os.Stat(path)
+		if err != nil {
+			return -1
+		}
+		return info.Size()
+	}
+	return 0
+}
+
+// selectMediaFile returns the index of the media file with the best score.
+// Files with the same score are chosen by the priority of their extension.
+func (m *MetaDataReader) selectMediaFile(mediaFiles []string) int {
+	mediaIndex := 0
+	bestScore := m.mediaScore(mediaFiles[0])
+	for i := 1; i < len(mediaFiles); i++ {
+		score := m.mediaScore(mediaFiles[i])
+		if score > bestScore || (score == bestScore && m.mediaPriority(mediaFiles[i]) < m.mediaPriority(mediaFiles[mediaIndex])) {
+			mediaIndex = i
+			bestScore = score
+		}
+	}
+	return mediaIndex
+}
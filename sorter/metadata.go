@@ -0,0 +1,566 @@
+package sorter
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/dhowden/tag"
+)
+
+// A path to a media file that was verified by the tag library to be an actual media file
+type MediaFile string
+
+type FileGroup struct {
+	MediaFile    MediaFile
+	SidecarFiles []string
+}
+
+// Files returns the paths of the media file and all sidecar files
+func (g *FileGroup) Files() []string {
+	return append([]string{string(g.MediaFile)}, g.SidecarFiles...)
+}
+
+type Metadata struct {
+	Title       string
+	Artist      string
+	AlbumArtist string
+	Album       string
+	Format      tag.Format
+	FileType    tag.FileType
+	Genre       string
+	Composer    string
+	Comment     string
+	Year        int
+
+	Track      int
+	TrackTotal int
+	Disc       int
+	DiscTotal  int
+	// True if the track number is not 0, or if the file has a track number tag with 0 and the reader keeps track 0.
+	// Templates see it as true for all track numbers that are not 0, even if it's not set.
+	HasTrack bool
+	// True if the file is part of a compilation of several artists, e.g. a "Various Artists" sampler
+	Compilation bool
+
+	// Classical music tags
+	Work           string
+	Movement       string
+	MovementNumber int
+
+	// Software or settings used for encoding the file
+	Encoder string
+
+	// Audio properties of FLAC files, 0 for other formats
+	SampleRate int
+	BitDepth   int
+
+	// Embedded lyrics, MapText doesn't change them because they are not meant for file names
+	Lyrics string
+	// Value of the MEDIASORTER tag, for skipping files that were already sorted
+	Marker string
+}
+
+// Defaults for empty metadata fields in destination paths
+const (
+	DefaultUnknownArtist = "Unknown Artist"
+	DefaultUnknownAlbum  = "Unknown Album"
+)
+
+// MetadataDefaults are the values for empty metadata fields in destination paths
+type MetadataDefaults struct {
+	Artist string
+	Album  string
+	// Empty means the name of the source file, without extension
+	Title string
+}
+
+// WithDefaults returns a new Metadata instance where empty artist, album and title fields have the default values.
+// origName is the name of the source file, for files without title.
+func (m *Metadata) WithDefaults(defaults MetadataDefaults, origName string) *Metadata {
+	withDefaults := *m
+	if withDefaults.Artist == "" {
+		withDefaults.Artist = defaults.Artist
+	}
+	if withDefaults.Album == "" {
+		withDefaults.Album = defaults.Album
+	}
+	if withDefaults.Title == "" {
+		withDefaults.Title = cmp.Or(defaults.Title, origName)
+	}
+	return &withDefaults
+}
+
+// CleanForPaths returns a new Metadata instance with fields cleaned for use in file paths.
+// In Go, we use forward slashes on all architectures, no need to worry about OS-specific path separators.
+func (m *Metadata) CleanForPaths() *Metadata {
+	return m.MapText(func(text string) string {
+		return strings.ReplaceAll(text, "/", "")
+	})
+}
+
+// MapText returns a new Metadata instance where all text fields are transformed by the mapping function
+func (m *Metadata) MapText(mapping func(string) string) *Metadata {
+	return &Metadata{
+		Title:       mapping(m.Title),
+		Artist:      mapping(m.Artist),
+		AlbumArtist: mapping(m.AlbumArtist),
+		Album:       mapping(m.Album),
+		Format:      m.Format,
+		FileType:    m.FileType,
+		Genre:       mapping(m.Genre),
+		Composer:    mapping(m.Composer),
+		Comment:     mapping(m.Comment),
+		Year:        m.Year,
+		Track:       m.Track,
+		TrackTotal:  m.TrackTotal,
+		Disc:        m.Disc,
+		DiscTotal:   m.DiscTotal,
+		HasTrack:    m.HasTrack,
+		Compilation: m.Compilation,
+
+		Work:           mapping(m.Work),
+		Movement:       mapping(m.Movement),
+		MovementNumber: m.MovementNumber,
+
+		Encoder: mapping(m.Encoder),
+
+		SampleRate: m.SampleRate,
+		BitDepth:   m.BitDepth,
+
+		Lyrics: m.Lyrics,
+		Marker: m.Marker,
+	}
+}
+
+// Raw tag names for the classical music tags. Vorbis comment names are lowercase,
+// ID3 frames use their frame ID or the description of a TXXX frame,
+// MP4 uses the name of custom ("----") atoms or the grouping atom.
+var (
+	workTags           = []string{"work", "WORK", "TIT1", "grouping", "GRP1", "\xa9grp"}
+	movementTags       = []string{"movementname", "movement", "MVNM", "MOVEMENTNAME", "MOVEMENT"}
+	movementNumberTags = []string{"movementnumber", "MVIN", "MOVEMENTNUMBER"}
+)
+
+// Raw tag names for the compilation flag of iTunes (ID3 and MP4) and Vorbis comments
+var compilationTags = []string{"compilation", "TCMP", "TCP", "cpil", "COMPILATION"}
+
+// Raw tag names for the encoder, preferring the encoding software and settings over the person who encoded the file
+var encoderTags = []string{"encoder", "TSSE", "TSS", "\xa9too", "encoded-by", "encodedby", "TENC", "TEN"}
+
+// rawString returns the first non-empty value from the raw tags, trying each of the names in order
+func rawString(raw map[string]interface{}, names ...string) string {
+	for _, name := range names {
+		for key, value := range raw {
+			if rawTagName(key, value) != name {
+				continue
+			}
+			if text := rawText(value); text != "" {
+				return text
+			}
+		}
+	}
+	return ""
+}
+
+// rawTagName returns the name of a raw tag, using the description of user defined ID3 text frames (TXXX)
+func rawTagName(key string, value interface{}) string {
+	if strings.HasPrefix(key, "TXX") {
+		if comm, ok := value.(*tag.Comm); ok {
+			return comm.Description
+		}
+	}
+	// ID3 adds a number suffix to frames that occur more than once
+	if i := strings.Index(key, "_"); i == 4 && strings.ToUpper(key) == key {
+		return key[:i]
+	}
+	return key
+}
+
+func rawText(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return strings.TrimSpace(v)
+	case *tag.Comm:
+		return strings.TrimSpace(v.Text)
+	case int:
+		return strconv.Itoa(v)
+	}
+	return ""
+}
+
+// rawBool returns true if the first non-empty raw tag is a true value like "1" or "true"
+func rawBool(raw map[string]interface{}, names ...string) bool {
+	value, err := strconv.ParseBool(rawString(raw, names...))
+	return err == nil && value
+}
+
+// rawNumber returns the number of a raw tag, ignoring totals in "N/M" notation
+func rawNumber(raw map[string]interface{}, names ...string) int {
+	text := rawString(raw, names...)
+	text, _, _ = strings.Cut(text, "/")
+	number, err := strconv.Atoi(strings.TrimSpace(text))
+	if err != nil {
+		return 0
+	}
+	return number
+}
+
+// Raw tag names for the total number of tracks and discs. ID3 has no frames for them,
+// but some tools write them into user defined text frames (TXXX).
+var (
+	trackTotalTags = []string{"tracktotal", "totaltracks", "trkn_count", "TRACKTOTAL", "TOTALTRACKS"}
+	discTotalTags  = []string{"disctotal", "totaldiscs", "disk_count", "DISCTOTAL", "TOTALDISCS"}
+)
+
+// trackNumbers contains the track and disc numbers of a file, with their totals
+type trackNumbers struct {
+	Track      int
+	TrackTotal int
+	Disc       int
+	DiscTotal  int
+}
+
+// readTrackNumbers returns the track and disc numbers and their totals for all formats.
+// The tag library reads "N/M" values only for ID3, and reads only some of the total tags.
+func readTrackNumbers(rawMetadata tag.Metadata) trackNumbers {
+	raw := rawMetadata.Raw()
+	track, trackTotal := rawMetadata.Track()
+	disc, discTotal := rawMetadata.Disc()
+
+	var numbers trackNumbers
+	numbers.Track, numbers.TrackTotal = numberAndTotal(raw, track, trackTotal, trackTags, trackTotalTags)
+	numbers.Disc, numbers.DiscTotal = numberAndTotal(raw, disc, discTotal, discTags, discTotalTags)
+	return numbers
+}
+
+// numberAndTotal completes the number and total from the tag library with the raw tags,
+// from "N/M" values in the number tags or from separate total tags
+func numberAndTotal(raw map[string]interface{}, number, total int, numberTags, totalTags []string) (int, int) {
+	textNumber, textTotal := parseNumberAndTotal(rawString(raw, numberTags...))
+	if number == 0 {
+		number = textNumber
+	}
+	if total == 0 {
+		total = textTotal
+	}
+	if total == 0 {
+		total, _ = parseNumberAndTotal(rawString(raw, totalTags...))
+	}
+	return number, total
+}
+
+// parseNumberAndTotal parses values like "3" or "3/12", numbers that aren't valid are 0
+func parseNumberAndTotal(text string) (int, int) {
+	numberText, totalText, _ := strings.Cut(text, "/")
+	number, _ := strconv.Atoi(strings.TrimSpace(numberText))
+	total, _ := strconv.Atoi(strings.TrimSpace(totalText))
+	return number, total
+}
+
+// Default order of file extensions for choosing the media file in a group of files with the same name, audio before video
+var DefaultMediaPriority = []string{"flac", "dsf", "m4a", "ogg", "mp3", "m4b", "m4p", "mp4", "m4v"}
+
+type MetaDataReader struct {
+	OutputWriter *OutputWriter
+	// File extensions (without dot) in order of preference, when a group contains several media files.
+	// Files with other extensions have the lowest priority.
+	MediaPriority []string
+	// How to choose the media file when a group contains several media files, empty means SelectByPriority
+	MediaSelection MediaSelection
+	// Treat track number 0 as a real track number, e.g. for hidden tracks, if the file has a track number tag
+	KeepTrackZero bool
+}
+
+// mediaPriority returns the position of the file extension in the priority list, lower numbers mean higher priority
+func (m *MetaDataReader) mediaPriority(path string) int {
+	ext := normalizeExtension(filepath.Ext(path))
+	for i, priorityExt := range m.MediaPriority {
+		if ext == normalizeExtension(priorityExt) {
+			return i
+		}
+	}
+	return len(m.MediaPriority)
+}
+
+type NotAMediaFileError struct {
+	srcPath string
+}
+
+func (m *NotAMediaFileError) Error() string {
+	return fmt.Sprintf("'%s' is probably not a media file than can be parsed", m.srcPath)
+}
+
+func (m *NotAMediaFileError) Is(target error) bool {
+	return target == ErrNotAMediaFile
+}
+
+func (m *MetaDataReader) ReadMetadata(srcPath MediaFile) (*Metadata, error) {
+	// read metadata from file
+	f, err := os.Open(string(srcPath))
+	if err != nil {
+		return nil, fmt.Errorf("error opening file %s: %v", srcPath, err)
+	}
+	defer f.Close()
+
+	// Use github.com/dhowden/tag for reading audio metadata
+	rawMetadata, err := readTags(f)
+	if errors.Is(err, tag.ErrNoTagsFound) {
+		return nil, &NoTagsError{srcPath: string(srcPath), err: err}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	m.OutputWriter.Debug(fmt.Sprintf("Metadata for file %s - %v", srcPath, rawMetadata))
+
+	numbers := readTrackNumbers(rawMetadata)
+
+	metadata := &Metadata{
+		Title:       rawMetadata.Title(),
+		Artist:      rawMetadata.Artist(),
+		AlbumArtist: rawMetadata.AlbumArtist(),
+		Album:       rawMetadata.Album(),
+		Format:      rawMetadata.Format(),
+		FileType:    rawMetadata.FileType(),
+		Genre:       rawMetadata.Genre(),
+		Composer:    rawMetadata.Composer(),
+		Comment:     rawMetadata.Comment(),
+		Year:        rawMetadata.Year(),
+		Track:       numbers.Track,
+		TrackTotal:  numbers.TrackTotal,
+		Disc:        numbers.Disc,
+		DiscTotal:   numbers.DiscTotal,
+		Compilation: rawBool(rawMetadata.Raw(), compilationTags...),
+
+		Work:           rawString(rawMetadata.Raw(), workTags...),
+		Movement:       rawString(rawMetadata.Raw(), movementTags...),
+		MovementNumber: rawNumber(rawMetadata.Raw(), movementNumberTags...),
+
+		Encoder: rawString(rawMetadata.Raw(), encoderTags...),
+		Lyrics:  readLyrics(rawMetadata),
+		Marker:  rawString(rawMetadata.Raw(), markerTags...),
+	}
+
+	// The tag library doesn't read the audio properties, so we read them from the stream
+	if metadata.FileType == tag.FLAC {
+		metadata.SampleRate, metadata.BitDepth = readFLACStreamInfo(f)
+	}
+
+	fillSides(metadata, rawMetadata.Raw())
+	metadata.HasTrack = metadata.Track != 0 || (m.KeepTrackZero && rawString(rawMetadata.Raw(), trackTags...) != "")
+
+	m.OutputWriter.Debug(fmt.Sprintf("Created Metadata: %v", metadata))
+	return metadata, nil
+}
+
+// id3v2HeaderSize is the length of the ID3v2 header (and the optional footer)
+const id3v2HeaderSize = 10
+
+// readTags reads the metadata with the tag library, with special handling for
+// FLAC files where a tool prepended an ID3v2 tag. The tag library would read
+// only the ID3 tag and detect the file as MP3, so we skip the ID3 tag and prefer
+// the Vorbis comments of the FLAC stream, falling back to the ID3 tag if the
+// FLAC stream can't be read.
+func readTags(r io.ReadSeeker) (tag.Metadata, error) {
+	flacOffset, err := findFLACAfterID3(r)
+	if err != nil {
+		return nil, err
+	}
+	if flacOffset > 0 {
+		if _, err := r.Seek(flacOffset, io.SeekStart); err != nil {
+			return nil, err
+		}
+		if flacMetadata, err := tag.ReadFLACTags(r); err == nil {
+			return flacMetadata, nil
+		}
+	}
+
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return tag.ReadFrom(r)
+}
+
+// findFLACAfterID3 returns the offset of the "fLaC" marker if the reader starts
+// with an ID3v2 tag that is followed by a FLAC stream, otherwise 0.
+func findFLACAfterID3(r io.ReadSeeker) (int64, error) {
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	header := make([]byte, id3v2HeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		// Too short for an ID3 tag, let the tag library decide what to do with it
+		return 0, nil
+	}
+	if string(header[0:3]) != "ID3" {
+		return 0, nil
+	}
+
+	// The tag size is a "synchsafe" integer, using only 7 bits of each byte
+	size := int64(header[6])<<21 | int64(header[7])<<14 | int64(header[8])<<7 | int64(header[9])
+	offset := id3v2HeaderSize + size
+	// Footer flag
+	if header[5]&0x10 != 0 {
+		offset += id3v2HeaderSize
+	}
+
+	if _, err := r.Seek(offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+	marker := make([]byte, 4)
+	if _, err := io.ReadFull(r, marker); err != nil || string(marker) != "fLaC" {
+		return 0, nil
+	}
+	return offset, nil
+}
+
+// flacStreamInfoSize is the length of the STREAMINFO metadata block of FLAC streams
+const flacStreamInfoSize = 34
+
+// readFLACStreamInfo returns the sample rate and bit depth from the STREAMINFO block, which is the
+// first metadata block of a FLAC stream. It returns zeros if it can't find a valid STREAMINFO block.
+func readFLACStreamInfo(r io.ReadSeeker) (sampleRate int, bitDepth int) {
+	offset, err := findFLACAfterID3(r)
+	if err != nil {
+		return 0, 0
+	}
+	if _, err := r.Seek(offset, io.SeekStart); err != nil {
+		return 0, 0
+	}
+	// "fLaC" marker, block header with type and length, and the block
+	data := make([]byte, 8+flacStreamInfoSize)
+	if _, err := io.ReadFull(r, data); err != nil || string(data[0:4]) != "fLaC" {
+		return 0, 0
+	}
+	blockType := data[4] & 0x7f
+	blockLength := int(data[5])<<16 | int(data[6])<<8 | int(data[7])
+	if blockType != flacStreamInfoBlock || blockLength != flacStreamInfoSize {
+		return 0, 0
+	}
+
+	// After the block and frame sizes come 20 bits of sample rate, 3 bits of channels and 5 bits of bits per sample - 1
+	info := data[8:]
+	sampleRate = int(info[10])<<12 | int(info[11])<<4 | int(info[12])>>4
+	bitDepth = (int(info[12]&0x01)<<4 | int(info[13])>>4) + 1
+	return sampleRate, bitDepth
+}
+
+func (m *MetaDataReader) GetFileGroup(fileCandidates []string) (*FileGroup, error) {
+	mediaFiles, sidecarFiles, err := identifyMediaFiles(fileCandidates)
+	if err != nil {
+		return nil, err
+	}
+	return m.selectFileGroup(mediaFiles, sidecarFiles), nil
+}
+
+// GetFileGroups is like GetFileGroup, but checks if media files with the same name are the same track.
+// Media files with different tags get their own groups, the sidecar files belong to the group of the best media file.
+func (m *MetaDataReader) GetFileGroups(fileCandidates []string) ([]*FileGroup, error) {
+	mediaFiles, sidecarFiles, err := identifyMediaFiles(fileCandidates)
+	if err != nil {
+		return nil, err
+	}
+	if len(mediaFiles) == 1 {
+		return []*FileGroup{m.selectFileGroup(mediaFiles, sidecarFiles)}, nil
+	}
+
+	// Files without tags can't be compared, they stay with the best media file
+	best := mediaFiles[m.selectMediaFile(mediaFiles)]
+	bestKey := m.trackKey(best)
+	var keys []string
+	tracks := make(map[string][]string)
+	for _, file := range mediaFiles {
+		key := m.trackKey(file)
+		if key == "" {
+			key = bestKey
+		}
+		if _, exists := tracks[key]; !exists {
+			keys = append(keys, key)
+		}
+		tracks[key] = append(tracks[key], file)
+	}
+	if len(keys) == 1 {
+		return []*FileGroup{m.selectFileGroup(mediaFiles, sidecarFiles)}, nil
+	}
+
+	m.OutputWriter.Info(fmt.Sprintf("Media files %s have the same name but different tags, sorting them separately", strings.Join(mediaFiles, ", ")))
+	groups := []*FileGroup{m.selectFileGroup(tracks[bestKey], sidecarFiles)}
+	for _, key := range keys {
+		if key != bestKey {
+			groups = append(groups, m.selectFileGroup(tracks[key], nil))
+		}
+	}
+	return groups, nil
+}
+
+// trackKey returns the tags that identify a track, or an empty string if the file has no artist, album and title
+func (m *MetaDataReader) trackKey(mediaFile string) string {
+	metadata, err := m.ReadMetadata(MediaFile(mediaFile))
+	if err != nil || (metadata.Artist == "" && metadata.Album == "" && metadata.Title == "") {
+		return ""
+	}
+	return fmt.Sprintf("%s\x00%s\x00%s\x00%s\x00%d\x00%d", metadata.Artist, metadata.AlbumArtist, metadata.Album, metadata.Title, metadata.Track, metadata.Disc)
+}
+
+// identifyMediaFiles splits the files of a group into media files and sidecar files
+func identifyMediaFiles(fileCandidates []string) ([]string, []string, error) {
+	if len(fileCandidates) == 0 {
+		// This should not happen, but just in case
+		return nil, nil, fmt.Errorf("no files found in the group, skipping")
+	}
+
+	// Find the media files in the group
+	var mediaFiles []string
+	var sidecarFiles []string
+
+	for _, file := range fileCandidates {
+		// Try to identify if this is a media file
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error opening file %s: %v", file, err)
+		}
+		defer f.Close()
+
+		// Try to identify the file using the tag library
+		// We ignore the format and filetype (they'll later be read by "ReadMetadata" anyway)
+		// and are only interested in the error. If it is not nil, it means the tag library could
+		// could not identify the file as a media file.
+		_, _, err = tag.Identify(f)
+
+		if err == nil {
+			mediaFiles = append(mediaFiles, file)
+		} else {
+			// This is a sidecar file
+			sidecarFiles = append(sidecarFiles, file)
+		}
+	}
+
+	if len(mediaFiles) == 0 {
+		return nil, nil, fmt.Errorf("no media file found in the group, skipping")
+	}
+	return mediaFiles, sidecarFiles, nil
+}
+
+// selectFileGroup creates a group with the best of the media files, the other media files become sidecar files
+func (m *MetaDataReader) selectFileGroup(mediaFiles []string, sidecarFiles []string) *FileGroup {
+	// Multiple media files with same basename - use the best one, treat others as sidecars
+	mediaIndex := m.selectMediaFile(mediaFiles)
+	mediaFile := MediaFile(mediaFiles[mediaIndex])
+	for i, file := range mediaFiles {
+		if i != mediaIndex {
+			m.OutputWriter.Debug(fmt.Sprintf("Treating media file %s as sidecar file of %s", file, mediaFile))
+			sidecarFiles = append(sidecarFiles, file)
+		}
+	}
+
+	return &FileGroup{
+		MediaFile:    mediaFile,
+		SidecarFiles: sidecarFiles,
+	}
+}
@@ -0,0 +1,595 @@
+package sorter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/dhowden/tag"
+)
+
+// id3Tag creates an ID3v2.3 tag with a single title frame and some padding
+func id3Tag(title string) []byte {
+	var frame bytes.Buffer
+	frame.WriteString("TIT2")
+	binary.Write(&frame, binary.BigEndian, uint32(len(title)+1))
+	frame.Write([]byte{0, 0, 0}) // flags and ISO-8859-1 encoding
+	frame.WriteString(title)
+
+	size := frame.Len() + 16 // padding
+	var buf bytes.Buffer
+	buf.WriteString("ID3")
+	buf.Write([]byte{3, 0, 0})
+	buf.Write([]byte{byte(size >> 21 & 0x7f), byte(size >> 14 & 0x7f), byte(size >> 7 & 0x7f), byte(size & 0x7f)})
+	buf.Write(frame.Bytes())
+	buf.Write(make([]byte, 16))
+	return buf.Bytes()
+}
+
+// flacStream creates a FLAC stream that contains only a Vorbis comment block
+func flacStream(comments ...string) []byte {
+	var block bytes.Buffer
+	vendor := "test"
+	binary.Write(&block, binary.LittleEndian, uint32(len(vendor)))
+	block.WriteString(vendor)
+	binary.Write(&block, binary.LittleEndian, uint32(len(comments)))
+	for _, comment := range comments {
+		binary.Write(&block, binary.LittleEndian, uint32(len(comment)))
+		block.WriteString(comment)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("fLaC")
+	size := block.Len()
+	buf.Write([]byte{0x84, byte(size >> 16), byte(size >> 8), byte(size)}) // last block, type 4 (Vorbis comment)
+	buf.Write(block.Bytes())
+	return buf.Bytes()
+}
+
+// flacStreamWithInfo returns a FLAC stream with a STREAMINFO block before the Vorbis comments of flacStream
+func flacStreamWithInfo(sampleRate int, bitDepth int, comments ...string) []byte {
+	info := make([]byte, 34)
+	info[10] = byte(sampleRate >> 12)
+	info[11] = byte(sampleRate >> 4)
+	info[12] = byte(sampleRate<<4) | byte(1<<1) | byte((bitDepth-1)>>4) // stereo
+	info[13] = byte((bitDepth - 1) << 4)
+
+	var buf bytes.Buffer
+	buf.WriteString("fLaC")
+	buf.Write([]byte{0x00, 0, 0, byte(len(info))}) // type 0 (STREAMINFO)
+	buf.Write(info)
+	buf.Write(flacStream(comments...)[4:])
+	return buf.Bytes()
+}
+
+func TestReadTags(t *testing.T) {
+	tests := []struct {
+		description      string
+		data             []byte
+		expectedTitle    string
+		expectedFileType tag.FileType
+	}{
+		{"plain FLAC", flacStream("TITLE=Vorbis Title"), "Vorbis Title", tag.FLAC},
+		{"FLAC with prepended ID3 tag prefers Vorbis comments", append(id3Tag("ID3 Title"), flacStream("TITLE=Vorbis Title")...), "Vorbis Title", tag.FLAC},
+		{"broken FLAC with prepended ID3 tag falls back to ID3", append(id3Tag("ID3 Title"), []byte("fLaC\x84")...), "ID3 Title", tag.MP3},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			metadata, err := readTags(bytes.NewReader(test.data))
+			if err != nil {
+				t.Fatalf("readTags() returned error: %v", err)
+			}
+			if metadata.Title() != test.expectedTitle {
+				t.Errorf("Expected title '%s' but got '%s'", test.expectedTitle, metadata.Title())
+			}
+			if metadata.FileType() != test.expectedFileType {
+				t.Errorf("Expected file type '%s' but got '%s'", test.expectedFileType, metadata.FileType())
+			}
+		})
+	}
+}
+
+func TestClassicalRawTags(t *testing.T) {
+	tests := []struct {
+		description            string
+		raw                    map[string]interface{}
+		expectedWork           string
+		expectedMovement       string
+		expectedMovementNumber int
+	}{
+		{"no tags", map[string]interface{}{"title": "Allegro"}, "", "", 0},
+		{
+			"Vorbis comments",
+			map[string]interface{}{"work": "Symphony No. 5", "movementname": "Allegro con brio", "movementnumber": "1"},
+			"Symphony No. 5", "Allegro con brio", 1,
+		},
+		{
+			"ID3 frames",
+			map[string]interface{}{"TIT1": "Symphony No. 5", "MVNM": "Andante con moto", "MVIN": "2/4"},
+			"Symphony No. 5", "Andante con moto", 2,
+		},
+		{
+			"ID3 user defined frames",
+			map[string]interface{}{
+				"TXXX":   &tag.Comm{Description: "WORK", Text: "Symphony No. 5"},
+				"TXXX_0": &tag.Comm{Description: "MOVEMENTNAME", Text: "Scherzo"},
+				"TXXX_1": &tag.Comm{Description: "MOVEMENTNUMBER", Text: "3"},
+			},
+			"Symphony No. 5", "Scherzo", 3,
+		},
+		{"work is preferred over grouping", map[string]interface{}{"grouping": "Beethoven", "work": "Symphony No. 5"}, "Symphony No. 5", "", 0},
+		{"grouping as fallback", map[string]interface{}{"\xa9grp": "Symphony No. 5"}, "Symphony No. 5", "", 0},
+		{"invalid movement number", map[string]interface{}{"movementnumber": "IV"}, "", "", 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			work := rawString(test.raw, workTags...)
+			if work != test.expectedWork {
+				t.Errorf("Expected work '%s' but got '%s'", test.expectedWork, work)
+			}
+			movement := rawString(test.raw, movementTags...)
+			if movement != test.expectedMovement {
+				t.Errorf("Expected movement '%s' but got '%s'", test.expectedMovement, movement)
+			}
+			movementNumber := rawNumber(test.raw, movementNumberTags...)
+			if movementNumber != test.expectedMovementNumber {
+				t.Errorf("Expected movement number %d but got %d", test.expectedMovementNumber, movementNumber)
+			}
+		})
+	}
+}
+
+func TestEncoderRawTags(t *testing.T) {
+	tests := []struct {
+		description string
+		raw         map[string]interface{}
+		expected    string
+	}{
+		{"no tags", map[string]interface{}{"title": "Title"}, ""},
+		{"Vorbis comment", map[string]interface{}{"encoder": "reference libFLAC 1.4.3"}, "reference libFLAC 1.4.3"},
+		{"ID3 encoding settings", map[string]interface{}{"TSSE": "LAME 3.100 -V0"}, "LAME 3.100 -V0"},
+		{"MP4 encoding tool", map[string]interface{}{"\xa9too": "iTunes 12.9"}, "iTunes 12.9"},
+		{"encoded by as fallback", map[string]interface{}{"TENC": "Ripper"}, "Ripper"},
+		{"encoder is preferred over encoded by", map[string]interface{}{"TENC": "Ripper", "TSSE": "LAME 3.100"}, "LAME 3.100"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			actual := rawString(test.raw, encoderTags...)
+			if actual != test.expected {
+				t.Errorf("Expected encoder '%s' but got '%s'", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestGetFileGroupUsesMediaPriority(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string][]byte{
+		"track.mp3": id3Tag("MP3 Title"),
+		"track.mp4": append([]byte{0, 0, 0, 0x18}, []byte("ftypM4V extra")...),
+		"track.lrc": []byte("[00:00.00] lyrics"),
+	}
+	var paths []string
+	for _, name := range []string{"track.lrc", "track.mp3", "track.mp4"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, files[name], 0644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+
+	tests := []struct {
+		description   string
+		priority      []string
+		expectedMedia string
+	}{
+		{"audio before video", DefaultMediaPriority, "track.mp3"},
+		{"custom priority", []string{".MP4", "mp3"}, "track.mp4"},
+		{"no priority uses first file", nil, "track.mp3"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			reader := &MetaDataReader{OutputWriter: &OutputWriter{Verbosity: Quiet, Writer: io.Discard}, MediaPriority: test.priority}
+			group, err := reader.GetFileGroup(paths)
+			if err != nil {
+				t.Fatalf("GetFileGroup returned error: %v", err)
+			}
+			if filepath.Base(string(group.MediaFile)) != test.expectedMedia {
+				t.Errorf("Expected media file %s, got %s", test.expectedMedia, group.MediaFile)
+			}
+			if len(group.SidecarFiles) != 2 {
+				t.Errorf("Expected 2 sidecar files, got %v", group.SidecarFiles)
+			}
+		})
+	}
+}
+
+func TestGetFileGroupUsesMediaSelection(t *testing.T) {
+	dir := t.TempDir()
+	// The preview clip has the preferred extension, but fewer tags and less audio data
+	files := map[string][]byte{
+		"track.mp3":  id3Tag("Preview"),
+		"track.flac": append(flacStream("TITLE=Title", "ARTIST=Artist", "ALBUM=Album"), make([]byte, 4096)...),
+	}
+	var paths []string
+	for _, name := range []string{"track.mp3", "track.flac"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, files[name], 0644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+
+	tests := []struct {
+		selection     MediaSelection
+		expectedMedia string
+	}{
+		{"", "track.mp3"},
+		{SelectByPriority, "track.mp3"},
+		{SelectByTags, "track.flac"},
+		{SelectBySize, "track.flac"},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.selection), func(t *testing.T) {
+			reader := &MetaDataReader{
+				OutputWriter:   &OutputWriter{Verbosity: Quiet, Writer: io.Discard},
+				MediaPriority:  []string{"mp3", "flac"},
+				MediaSelection: test.selection,
+			}
+			group, err := reader.GetFileGroup(paths)
+			if err != nil {
+				t.Fatalf("GetFileGroup returned error: %v", err)
+			}
+			if filepath.Base(string(group.MediaFile)) != test.expectedMedia {
+				t.Errorf("Expected media file %s, got %s", test.expectedMedia, group.MediaFile)
+			}
+		})
+	}
+}
+
+func TestReadMetadataKeepsTrackZero(t *testing.T) {
+	tests := []struct {
+		description      string
+		comments         []string
+		keepTrackZero    bool
+		expectedHasTrack bool
+	}{
+		{"track number", []string{"TRACKNUMBER=3"}, false, true},
+		{"track zero", []string{"TRACKNUMBER=0"}, false, false},
+		{"track zero kept", []string{"TRACKNUMBER=0"}, true, true},
+		{"no track number", nil, true, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "track.flac")
+			if err := os.WriteFile(path, flacStream(append([]string{"TITLE=Title"}, test.comments...)...), 0644); err != nil {
+				t.Fatal(err)
+			}
+			reader := &MetaDataReader{OutputWriter: &OutputWriter{Verbosity: Quiet, Writer: io.Discard}, KeepTrackZero: test.keepTrackZero}
+			metadata, err := reader.ReadMetadata(MediaFile(path))
+			if err != nil {
+				t.Fatalf("ReadMetadata returned error: %v", err)
+			}
+			if metadata.HasTrack != test.expectedHasTrack {
+				t.Errorf("Expected HasTrack to be %t", test.expectedHasTrack)
+			}
+		})
+	}
+}
+
+func TestNumberAndTotal(t *testing.T) {
+	tests := []struct {
+		description   string
+		raw           map[string]interface{}
+		number        int
+		total         int
+		expectedNum   int
+		expectedTotal int
+	}{
+		{"ID3 with total", map[string]interface{}{"TRCK": "3/12"}, 3, 12, 3, 12},
+		{"ID3 without total", map[string]interface{}{"TRCK": "3"}, 3, 0, 3, 0},
+		{"ID3 with total in user defined frame", map[string]interface{}{"TRCK": "3", "TXXX": &tag.Comm{Description: "TOTALTRACKS", Text: "12"}}, 3, 0, 3, 12},
+		{"MP4", map[string]interface{}{"trkn": 3, "trkn_count": 12}, 3, 12, 3, 12},
+		{"Vorbis with total in number", map[string]interface{}{"tracknumber": "3/12"}, 0, 0, 3, 12},
+		{"Vorbis with tracktotal", map[string]interface{}{"tracknumber": "3", "tracktotal": "12"}, 3, 12, 3, 12},
+		{"Vorbis with totaltracks", map[string]interface{}{"tracknumber": "3", "totaltracks": "12"}, 3, 0, 3, 12},
+		{"total in number wins over total tag", map[string]interface{}{"tracknumber": "3/12", "totaltracks": "10"}, 0, 0, 3, 12},
+		{"vinyl side", map[string]interface{}{"tracknumber": "A2/6"}, 0, 0, 0, 6},
+		{"no tags", map[string]interface{}{}, 0, 0, 0, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			number, total := numberAndTotal(test.raw, test.number, test.total, trackTags, trackTotalTags)
+			if number != test.expectedNum || total != test.expectedTotal {
+				t.Errorf("numberAndTotal(%v, %d, %d) = %d, %d; want %d, %d", test.raw, test.number, test.total, number, total, test.expectedNum, test.expectedTotal)
+			}
+		})
+	}
+}
+
+func TestReadMetadataReadsTotals(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "track.flac")
+	if err := os.WriteFile(path, flacStream("TITLE=Title", "TRACKNUMBER=3/12", "DISCNUMBER=1", "TOTALDISCS=2"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	reader := &MetaDataReader{OutputWriter: &OutputWriter{Verbosity: Quiet, Writer: io.Discard}}
+	metadata, err := reader.ReadMetadata(MediaFile(path))
+	if err != nil {
+		t.Fatalf("ReadMetadata returned error: %v", err)
+	}
+	if metadata.Track != 3 || metadata.TrackTotal != 12 || metadata.Disc != 1 || metadata.DiscTotal != 2 {
+		t.Errorf("Expected track 3/12 and disc 1/2, got %d/%d and %d/%d", metadata.Track, metadata.TrackTotal, metadata.Disc, metadata.DiscTotal)
+	}
+}
+
+func TestRunUsesDefaultsForMissingFields(t *testing.T) {
+	tests := []struct {
+		description string
+		config      Config
+		comments    []string
+		expected    string
+	}{
+		{"missing artist", Config{}, []string{"TITLE=Title", "ALBUM=Album"}, "Unknown Artist/Album/Title.flac"},
+		{"missing album", Config{}, []string{"TITLE=Title", "ARTIST=Artist"}, "Artist/Unknown Album/Title.flac"},
+		{"missing title", Config{}, []string{"ARTIST=Artist", "ALBUM=Album"}, "Artist/Album/source name.flac"},
+		{"configured defaults", Config{UnknownArtist: "No Artist", UnknownAlbum: "No Album", UnknownTitle: "No Title"}, []string{"GENRE=Jazz"}, "No Artist/No Album/No Title.flac"},
+		{"defaults with slashes", Config{UnknownArtist: "N/A", UnknownAlbum: "N/A"}, []string{"TITLE=Title"}, "NA/NA/Title.flac"},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			srcDir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(srcDir, "source name.flac"), flacStream(test.comments...), 0644); err != nil {
+				t.Fatal(err)
+			}
+			destDir := t.TempDir()
+			config := test.config
+			config.DestDir = destDir
+			config.Output = io.Discard
+
+			mediaSorter, err := New(&config)
+			if err != nil {
+				t.Fatalf("New returned error: %v", err)
+			}
+			if err := mediaSorter.Run(srcDir); err != nil {
+				t.Fatalf("Run returned error: %v", err)
+			}
+
+			if _, err := os.Stat(filepath.Join(destDir, filepath.FromSlash(test.expected))); err != nil {
+				t.Errorf("Expected file at %s: %v", test.expected, err)
+			}
+		})
+	}
+}
+
+func TestRunWithoutDefaultsKeepsMissingFieldsEmpty(t *testing.T) {
+	srcDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(srcDir, "source name.flac"), flacStream("TITLE=Title"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	templatePath := filepath.Join(t.TempDir(), "template.txt")
+	if err := os.WriteFile(templatePath, []byte(`{{ or .Artist "Other" }}/{{ .Album }}/{{ .Title }}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	destDir := t.TempDir()
+
+	mediaSorter, err := New(&Config{DestDir: destDir, Template: templatePath, NoMetadataDefaults: true, Output: io.Discard})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	if err := mediaSorter.Run(srcDir); err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(destDir, "Other", "Title.flac")); err != nil {
+		t.Errorf("Expected file without default artist and album: %v", err)
+	}
+}
+
+func TestWithDefaultsKeepsFilledFields(t *testing.T) {
+	metadata := &Metadata{Title: "Title", Artist: "Artist", Album: "Album"}
+	actual := metadata.WithDefaults(MetadataDefaults{Artist: DefaultUnknownArtist, Album: DefaultUnknownAlbum}, "source")
+	if *actual != *metadata {
+		t.Errorf("Expected %+v but got %+v", metadata, actual)
+	}
+}
+
+func TestReadMetadataReadsCompilationFlag(t *testing.T) {
+	tests := []struct {
+		description string
+		content     []byte
+		expected    bool
+	}{
+		{"FLAC with compilation comment", flacStream("TITLE=Title", "COMPILATION=1"), true},
+		{"FLAC with disabled compilation comment", flacStream("TITLE=Title", "COMPILATION=0"), false},
+		{"FLAC without compilation comment", flacStream("TITLE=Title"), false},
+		{"MP3 with iTunes compilation frame", id3WithFrames(append(id3Frame("TIT2", []byte("\x00Title")), id3Frame("TCMP", []byte("\x001"))...)), true},
+		{"MP3 without compilation frame", id3Tag("Title"), false},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "track")
+			if err := os.WriteFile(path, test.content, 0644); err != nil {
+				t.Fatal(err)
+			}
+			reader := &MetaDataReader{OutputWriter: &OutputWriter{Writer: io.Discard}}
+			metadata, err := reader.ReadMetadata(MediaFile(path))
+			if err != nil {
+				t.Fatalf("ReadMetadata returned error: %v", err)
+			}
+			if metadata.Compilation != test.expected {
+				t.Errorf("Expected compilation %v but got %v", test.expected, metadata.Compilation)
+			}
+		})
+	}
+}
+
+func TestRunSortsCompilationsWithTemplate(t *testing.T) {
+	srcDir := t.TempDir()
+	files := map[string][]byte{
+		"sampler.flac": flacStream("TITLE=Hit", "ARTIST=Band", "ALBUM=Sampler", "COMPILATION=1"),
+		"album.flac":   flacStream("TITLE=Song", "ARTIST=Band", "ALBUM=Album"),
+	}
+	writeSourceFiles(t, srcDir, files)
+	templatePath := filepath.Join(t.TempDir(), "template.txt")
+	template := "{{ if .Compilation }}Compilations/{{ .Album }}{{ else }}{{ .Artist }}/{{ .Album }}{{ end }}/{{ .Title }}"
+	if err := os.WriteFile(templatePath, []byte(template), 0644); err != nil {
+		t.Fatal(err)
+	}
+	destDir := t.TempDir()
+
+	mediaSorter, err := New(&Config{DestDir: destDir, Template: templatePath, Output: io.Discard})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	if err := mediaSorter.Run(srcDir); err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+
+	for _, expected := range []string{"Compilations/Sampler/Hit.flac", "Band/Album/Song.flac"} {
+		if _, err := os.Stat(filepath.Join(destDir, filepath.FromSlash(expected))); err != nil {
+			t.Errorf("Expected file at %s: %v", expected, err)
+		}
+	}
+}
+
+func TestGetFileGroupsSplitsMediaFilesWithDifferentTags(t *testing.T) {
+	tests := []struct {
+		description    string
+		otherName      string
+		otherContent   []byte
+		expectedGroups int
+	}{
+		{"same track in two formats", "track.mp3", id3WithPicture("Artist", "Album", "Title", "", nil), 1},
+		{"different tracks", "track.mp3", id3WithPicture("Other Artist", "Other Album", "Other Title", "", nil), 2},
+		{"media file without tags stays with the tagged file", "track.mp4", append([]byte{0, 0, 0, 0x18}, []byte("ftypM4V extra")...), 1},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			dir := t.TempDir()
+			files := map[string][]byte{
+				"track.flac":   flacStream("TITLE=Title", "ARTIST=Artist", "ALBUM=Album"),
+				"track.lrc":    []byte("[00:00.00] lyrics"),
+				test.otherName: test.otherContent,
+			}
+			var paths []string
+			for _, name := range []string{"track.flac", "track.lrc", test.otherName} {
+				path := filepath.Join(dir, name)
+				if err := os.WriteFile(path, files[name], 0644); err != nil {
+					t.Fatal(err)
+				}
+				paths = append(paths, path)
+			}
+
+			reader := &MetaDataReader{OutputWriter: &OutputWriter{Verbosity: Quiet, Writer: io.Discard}, MediaPriority: DefaultMediaPriority}
+			groups, err := reader.GetFileGroups(paths)
+			if err != nil {
+				t.Fatalf("GetFileGroups returned error: %v", err)
+			}
+			if len(groups) != test.expectedGroups {
+				t.Fatalf("Expected %d groups, got %d", test.expectedGroups, len(groups))
+			}
+			if filepath.Base(string(groups[0].MediaFile)) != "track.flac" {
+				t.Errorf("Expected the preferred media file first, got %s", groups[0].MediaFile)
+			}
+			if !slices.Contains(groups[0].SidecarFiles, filepath.Join(dir, "track.lrc")) {
+				t.Errorf("Expected the sidecar file in the group of the preferred media file, got %v", groups[0].SidecarFiles)
+			}
+			if test.expectedGroups == 1 && !slices.Contains(groups[0].SidecarFiles, filepath.Join(dir, test.otherName)) {
+				t.Errorf("Expected %s as sidecar file of the preferred media file, got %v", test.otherName, groups[0].SidecarFiles)
+			}
+		})
+	}
+}
+
+func TestRunSortsMediaFilesWithSameNameAndDifferentTagsSeparately(t *testing.T) {
+	srcDir := t.TempDir()
+	files := map[string][]byte{
+		"01.flac": flacStream("TITLE=First Song", "ARTIST=Artist", "ALBUM=Album"),
+		"01.mp3":  id3WithPicture("Other Artist", "Other Album", "Second Song", "", nil),
+		"01.lrc":  []byte("[00:00.00] lyrics"),
+	}
+	writeSourceFiles(t, srcDir, files)
+	destDir := t.TempDir()
+
+	mediaSorter, err := New(&Config{DestDir: destDir, Output: io.Discard})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	if err := mediaSorter.Run(srcDir); err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+
+	for _, expected := range []string{"Artist/Album/First Song.flac", "Artist/Album/First Song.lrc", "Other Artist/Other Album/Second Song.mp3"} {
+		if _, err := os.Stat(filepath.Join(destDir, filepath.FromSlash(expected))); err != nil {
+			t.Errorf("Expected file at %s: %v", expected, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(destDir, "Artist", "Album", "First Song.mp3")); !os.IsNotExist(err) {
+		t.Errorf("Expected the MP3 file not to be a sidecar file of the FLAC file, got %v", err)
+	}
+}
+
+func TestReadMetadataReadsAudioProperties(t *testing.T) {
+	tests := []struct {
+		description        string
+		data               []byte
+		expectedSampleRate int
+		expectedBitDepth   int
+	}{
+		{"CD quality FLAC", flacStreamWithInfo(44100, 16, "TITLE=Title"), 44100, 16},
+		{"hi-res FLAC", flacStreamWithInfo(96000, 24, "TITLE=Title"), 96000, 24},
+		{"FLAC with prepended ID3 tag", append(id3Tag("ID3 Title"), flacStreamWithInfo(192000, 24, "TITLE=Title")...), 192000, 24},
+		{"FLAC without STREAMINFO", flacStream("TITLE=Title"), 0, 0},
+		{"MP3", append(id3Tag("Title"), make([]byte, 64)...), 0, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "track")
+			if err := os.WriteFile(path, test.data, 0644); err != nil {
+				t.Fatal(err)
+			}
+			reader := &MetaDataReader{OutputWriter: &OutputWriter{Verbosity: Quiet, Writer: io.Discard}}
+			metadata, err := reader.ReadMetadata(MediaFile(path))
+			if err != nil {
+				t.Fatalf("ReadMetadata returned error: %v", err)
+			}
+			if metadata.SampleRate != test.expectedSampleRate || metadata.BitDepth != test.expectedBitDepth {
+				t.Errorf("Expected %d Hz and %d bits, got %d Hz and %d bits", test.expectedSampleRate, test.expectedBitDepth, metadata.SampleRate, metadata.BitDepth)
+			}
+		})
+	}
+}
+
+func TestRunSortsByAudioProperties(t *testing.T) {
+	srcDir := t.TempDir()
+	destDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(srcDir, "track.flac"), flacStreamWithInfo(96000, 24, "TITLE=Title", "ARTIST=Artist"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	templatePath := filepath.Join(t.TempDir(), "template.txt")
+	if err := os.WriteFile(templatePath, []byte("{{ .BitDepth }}-{{ .SampleRate }}/{{ .Artist }}/{{ .Title }}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	mediaSorter, err := New(&Config{DestDir: destDir, Template: templatePath, Output: io.Discard})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	if err := mediaSorter.Run(srcDir); err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(destDir, "24-96000", "Artist", "Title.flac")); err != nil {
+		t.Errorf("Expected file in the directory of the audio properties: %v", err)
+	}
+}
@@ -0,0 +1,68 @@
+package sorter
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+type Verbosity int
+
+const (
+	Quiet Verbosity = iota
+	Verbose
+	Debug
+)
+
+type OutputWriter struct {
+	Verbosity Verbosity
+	// Destination for results and information messages, nil means os.Stdout
+	Writer io.Writer
+	// Destination for warnings, nil means Writer if it's set and os.Stderr otherwise
+	ErrWriter io.Writer
+	// Parallel jobs write messages at the same time
+	mu sync.Mutex
+}
+
+func (o *OutputWriter) Write(msg string, verbosity Verbosity) {
+	if verbosity > o.Verbosity {
+		return
+	}
+	writer := o.Writer
+	if writer == nil {
+		writer = os.Stdout
+	}
+	o.writeLine(writer, msg)
+}
+
+// Print writes results, like planned destinations, that are shown without verbose output
+func (o *OutputWriter) Print(msg string) {
+	o.Write(msg, Quiet)
+}
+
+// Warn writes warnings to a separate stream, to keep them out of redirected results
+func (o *OutputWriter) Warn(msg string) {
+	writer := o.ErrWriter
+	if writer == nil {
+		writer = o.Writer
+	}
+	if writer == nil {
+		writer = os.Stderr
+	}
+	o.writeLine(writer, msg)
+}
+
+func (o *OutputWriter) writeLine(writer io.Writer, msg string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	fmt.Fprintln(writer, msg)
+}
+
+func (o *OutputWriter) Info(msg string) {
+	o.Write(msg, Verbose)
+}
+
+func (o *OutputWriter) Debug(msg string) {
+	o.Write(msg, Debug)
+}
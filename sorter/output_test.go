@@ -0,0 +1,165 @@
+package sorter
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOutputWriterVerbosity(t *testing.T) {
+	tests := []struct {
+		verbosity Verbosity
+		expected  string
+	}{
+		{Quiet, "warning\n"},
+		{Verbose, "warning\ninfo\n"},
+		{Debug, "warning\ninfo\ndebug\n"},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		outputWriter := &OutputWriter{Verbosity: test.verbosity, Writer: &buf}
+		outputWriter.Warn("warning")
+		outputWriter.Info("info")
+		outputWriter.Debug("debug")
+		if buf.String() != test.expected {
+			t.Errorf("Expected output %q for verbosity %d, got %q", test.expected, test.verbosity, buf.String())
+		}
+	}
+}
+
+func TestOutputWriterWritesWarningsToErrWriter(t *testing.T) {
+	var out, errOut bytes.Buffer
+	outputWriter := &OutputWriter{Verbosity: Debug, Writer: &out, ErrWriter: &errOut}
+	outputWriter.Warn("warning")
+	outputWriter.Print("result")
+	outputWriter.Info("info")
+	outputWriter.Debug("debug")
+
+	if errOut.String() != "warning\n" {
+		t.Errorf("Expected only the warning on the error stream, got %q", errOut.String())
+	}
+	if out.String() != "result\ninfo\ndebug\n" {
+		t.Errorf("Expected results, info and debug messages on the output stream, got %q", out.String())
+	}
+}
+
+func TestOutputWriterWritesWarningsToWriterWithoutErrWriter(t *testing.T) {
+	var out bytes.Buffer
+	outputWriter := &OutputWriter{Verbosity: Quiet, Writer: &out}
+	outputWriter.Warn("warning")
+	outputWriter.Print("result")
+
+	if out.String() != "warning\nresult\n" {
+		t.Errorf("Expected all messages on the output stream, got %q", out.String())
+	}
+}
+
+func TestRunWritesMessagesToLogFile(t *testing.T) {
+	srcDir := t.TempDir()
+	files := map[string][]byte{
+		"track.flac":    flacStream("TITLE=Title", "ARTIST=Artist", "ALBUM=Album"),
+		"untagged.flac": []byte("not a media file"),
+	}
+	writeSourceFiles(t, srcDir, files)
+	logPath := filepath.Join(t.TempDir(), "mediasorter.log")
+
+	var allOutput string
+	for range 2 {
+		var output bytes.Buffer
+		mediaSorter, err := New(&Config{DestDir: t.TempDir(), LogFile: logPath, Verbosity: Verbose, Output: &output})
+		if err != nil {
+			t.Fatalf("New returned error: %v", err)
+		}
+		if err := mediaSorter.Run(srcDir); err != nil {
+			t.Fatalf("Run returned error: %v", err)
+		}
+		if err := mediaSorter.Close(); err != nil {
+			t.Fatalf("Close returned error: %v", err)
+		}
+		if !strings.Contains(output.String(), "Processing file") {
+			t.Errorf("Expected messages on the console, got '%s'", output.String())
+		}
+		allOutput += output.String()
+	}
+
+	content, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != allOutput {
+		t.Errorf("Expected log file to contain the messages of both runs\n%s\nbut got\n%s", allOutput, content)
+	}
+}
+
+func TestQuietDryRunShowsNoInfoMessages(t *testing.T) {
+	srcDir := t.TempDir()
+	files := map[string][]byte{
+		"track.flac":    flacStream("TITLE=Title", "ARTIST=Artist", "ALBUM=Album"),
+		"untagged.flac": []byte("not a media file"),
+	}
+	writeSourceFiles(t, srcDir, files)
+
+	tests := []struct {
+		description  string
+		quiet        bool
+		expectedInfo bool
+	}{
+		{"dry run is verbose", false, true},
+		{"quiet dry run", true, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			var out, errOut bytes.Buffer
+			mediaSorter, err := New(&Config{DestDir: t.TempDir(), DryRun: true, Quiet: test.quiet, Output: &out, ErrOutput: &errOut})
+			if err != nil {
+				t.Fatalf("New returned error: %v", err)
+			}
+			if err := mediaSorter.Run(srcDir); err != nil {
+				t.Fatalf("Run returned error: %v", err)
+			}
+
+			if hasInfo := strings.Contains(out.String(), "Processing file"); hasInfo != test.expectedInfo {
+				t.Errorf("Expected info messages: %v, got output '%s'", test.expectedInfo, out.String())
+			}
+			if !strings.Contains(errOut.String(), "untagged.flac") {
+				t.Errorf("Expected warning about the skipped file, got '%s'", errOut.String())
+			}
+		})
+	}
+}
+
+func TestNewClosesFilesOnError(t *testing.T) {
+	// Counting open file descriptors needs the proc file system
+	if _, err := os.Stat("/proc/self/fd"); err != nil {
+		t.Skip("Can't count open files on this system")
+	}
+	openFiles := func() int {
+		entries, err := os.ReadDir("/proc/self/fd")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(entries)
+	}
+	dir := t.TempDir()
+	config := &Config{
+		DestDir:         filepath.Join(dir, "sorted"),
+		LogFile:         filepath.Join(dir, "mediasorter.log"),
+		Ledger:          filepath.Join(dir, "ledger.json"),
+		FlattenSidecars: true,
+		ArtworkTemplate: "{{ .Album",
+		Output:          io.Discard,
+	}
+
+	before := openFiles()
+	if _, err := New(config); err == nil {
+		t.Fatal("Expected error for invalid artwork template")
+	}
+	if after := openFiles(); after != before {
+		t.Errorf("Expected New to close the files it opened, %d files were open before and %d after", before, after)
+	}
+}
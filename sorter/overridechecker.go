@@ -0,0 +1,159 @@
+package sorter
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// ExistingFilePolicy determines what happens when the destination of a file already exists
+type ExistingFilePolicy string
+
+const (
+	// Skip files where the destination exists or was already written in this run
+	SkipExisting ExistingFilePolicy = "skip"
+	// Add a number to the file name, e.g. "Title (2).flac"
+	RenameExisting ExistingFilePolicy = "rename"
+	// Overwrite existing files
+	OverwriteExisting ExistingFilePolicy = "overwrite"
+	// Overwrite existing files that are older than the source
+	UpdateExisting ExistingFilePolicy = "update"
+	// Skip files where the destination has the same content, overwrite the others
+	SkipIdentical ExistingFilePolicy = "identical"
+	// Skip files where the destination or a renamed destination has the same content, rename the others
+	DedupeExisting ExistingFilePolicy = "dedupe"
+)
+
+// Other names for the policies
+var existingFilePolicyAliases = map[string]ExistingFilePolicy{
+	"override": OverwriteExisting,
+}
+
+func ParseExistingFilePolicy(policy string) (ExistingFilePolicy, error) {
+	if alias, ok := existingFilePolicyAliases[policy]; ok {
+		return alias, nil
+	}
+	switch ExistingFilePolicy(policy) {
+	case SkipExisting, RenameExisting, OverwriteExisting, UpdateExisting, SkipIdentical, DedupeExisting:
+		return ExistingFilePolicy(policy), nil
+	}
+	return "", fmt.Errorf("invalid policy for existing files '%s', must be one of %s, %s, %s, %s, %s or %s", policy, SkipExisting, RenameExisting, OverwriteExisting, UpdateExisting, SkipIdentical, DedupeExisting)
+}
+
+type OverrideChecker interface {
+	DestinationFileExists(srcPath string, destPath string) bool
+}
+
+type NoOverrideChecker struct {
+}
+
+func (n *NoOverrideChecker) DestinationFileExists(srcPath string, destPath string) bool {
+	return false
+}
+
+type MemoryOverrideChecker struct {
+	SeenFiles map[string]struct{}
+	mu        sync.Mutex
+}
+
+func (m *MemoryOverrideChecker) DestinationFileExists(srcPath string, destPath string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, exists := m.SeenFiles[destPath]; exists {
+		return true
+	}
+	m.SeenFiles[destPath] = struct{}{}
+	return false
+}
+
+func (m *MemoryOverrideChecker) release(destPath string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.SeenFiles, destPath)
+}
+
+// FilesystemOverrideChecker reports destinations that exist on disk or were already used in this run
+type FilesystemOverrideChecker struct {
+	MemoryOverrideChecker
+}
+
+func (f *FilesystemOverrideChecker) DestinationFileExists(srcPath string, destPath string) bool {
+	if _, err := os.Lstat(destPath); err == nil {
+		return true
+	}
+	return f.MemoryOverrideChecker.DestinationFileExists(srcPath, destPath)
+}
+
+// UpToDateOverrideChecker reports destinations that exist and are at least as new as their source,
+// for incremental runs that only copy new and changed files
+type UpToDateOverrideChecker struct {
+}
+
+func (u *UpToDateOverrideChecker) DestinationFileExists(srcPath string, destPath string) bool {
+	destInfo, err := os.Stat(destPath)
+	if err != nil {
+		return false
+	}
+	srcInfo, err := os.Stat(srcPath)
+	if err != nil {
+		return false
+	}
+	return !destInfo.ModTime().Before(srcInfo.ModTime())
+}
+
+// HashOverrideChecker reports destinations that exist and have the same content as their source.
+// It compares the SHA-256 checksums of the files, files of different size are never identical.
+type HashOverrideChecker struct {
+}
+
+func (h *HashOverrideChecker) DestinationFileExists(srcPath string, destPath string) bool {
+	return identicalFile(srcPath, destPath)
+}
+
+// identicalFile returns true if the destination exists and has the same SHA-256 checksum as the source
+func identicalFile(srcPath string, destPath string) bool {
+	destInfo, err := os.Stat(destPath)
+	if err != nil {
+		return false
+	}
+	srcInfo, err := os.Stat(srcPath)
+	if err != nil || srcInfo.Size() != destInfo.Size() {
+		return false
+	}
+	srcSum, err := fileChecksum(srcPath)
+	if err != nil {
+		return false
+	}
+	destSum, err := fileChecksum(destPath)
+	return err == nil && bytes.Equal(srcSum, destSum)
+}
+
+// fileChecksum returns the SHA-256 checksum of a file, reading it in chunks
+func fileChecksum(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return nil, err
+	}
+	return hash.Sum(nil), nil
+}
+
+type FileExistsError struct {
+	srcPath  string
+	destPath string
+}
+
+func (err *FileExistsError) Error() string {
+	return fmt.Sprintf("File %s already exists, skipping %s", err.destPath, err.srcPath)
+}
+
+func (err *FileExistsError) Is(target error) bool {
+	return target == ErrCollision
+}
@@ -0,0 +1,122 @@
+package sorter
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestUpToDateOverrideChecker(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src.mp3")
+	dest := filepath.Join(dir, "dest.mp3")
+	for _, file := range []string{src, dest} {
+		if err := os.WriteFile(file, []byte{}, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	now := time.Now()
+	checker := &UpToDateOverrideChecker{}
+
+	tests := []struct {
+		description string
+		srcTime     time.Time
+		destTime    time.Time
+		destPath    string
+		expected    bool
+	}{
+		{"destination is newer", now.Add(-time.Hour), now, dest, true},
+		{"destination has same time", now, now, dest, true},
+		{"source is newer", now, now.Add(-time.Hour), dest, false},
+		{"destination does not exist", now, now, filepath.Join(dir, "missing.mp3"), false},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			if err := os.Chtimes(src, test.srcTime, test.srcTime); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chtimes(dest, test.destTime, test.destTime); err != nil {
+				t.Fatal(err)
+			}
+			if actual := checker.DestinationFileExists(src, test.destPath); actual != test.expected {
+				t.Errorf("DestinationFileExists() = %v; want %v", actual, test.expected)
+			}
+		})
+	}
+}
+
+func TestHashOverrideChecker(t *testing.T) {
+	dir := t.TempDir()
+	large := bytes.Repeat([]byte("music"), 30000)
+	files := map[string][]byte{
+		"src.mp3":       large,
+		"identical.mp3": large,
+		"different.mp3": append(bytes.Repeat([]byte("music"), 29999), []byte("noise")...),
+		"shorter.mp3":   large[:100],
+	}
+	writeSourceFiles(t, dir, files)
+	checker := &HashOverrideChecker{}
+
+	tests := []struct {
+		destName string
+		expected bool
+	}{
+		{"identical.mp3", true},
+		{"different.mp3", false},
+		{"shorter.mp3", false},
+		{"missing.mp3", false},
+	}
+	for _, test := range tests {
+		t.Run(test.destName, func(t *testing.T) {
+			actual := checker.DestinationFileExists(filepath.Join(dir, "src.mp3"), filepath.Join(dir, test.destName))
+			if actual != test.expected {
+				t.Errorf("DestinationFileExists() = %v; want %v", actual, test.expected)
+			}
+		})
+	}
+}
+
+func TestHashOverrideCheckerComparesContentAtSameDestination(t *testing.T) {
+	dir := t.TempDir()
+	srcPath := filepath.Join(dir, "src.mp3")
+	destPath := filepath.Join(dir, "dest.mp3")
+	checker := &HashOverrideChecker{}
+
+	tests := []struct {
+		description string
+		destContent []byte
+		expected    bool
+	}{
+		{"identical content", []byte("music"), true},
+		{"different content with the same size", []byte("noise"), false},
+	}
+	if err := os.WriteFile(srcPath, []byte("music"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			if err := os.WriteFile(destPath, test.destContent, 0644); err != nil {
+				t.Fatal(err)
+			}
+			if actual := checker.DestinationFileExists(srcPath, destPath); actual != test.expected {
+				t.Errorf("DestinationFileExists() = %v; want %v", actual, test.expected)
+			}
+		})
+	}
+}
+
+func TestParseExistingFilePolicy(t *testing.T) {
+	for _, policy := range []string{"skip", "rename", "overwrite", "update", "identical", "dedupe"} {
+		if _, err := ParseExistingFilePolicy(policy); err != nil {
+			t.Errorf("Expected '%s' to be valid: %v", policy, err)
+		}
+	}
+	if policy, _ := ParseExistingFilePolicy("override"); policy != OverwriteExisting {
+		t.Errorf("Expected 'override' to be the same as '%s', got '%s'", OverwriteExisting, policy)
+	}
+	if _, err := ParseExistingFilePolicy("merge"); err == nil {
+		t.Error("Expected error for invalid policy")
+	}
+}
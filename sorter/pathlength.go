@@ -0,0 +1,48 @@
+package sorter
+
+import (
+	"fmt"
+	"path/filepath"
+	"unicode/utf8"
+)
+
+type PathTooLongError struct {
+	srcPath   string
+	destPath  string
+	maxLength int
+}
+
+func (err *PathTooLongError) Error() string {
+	return fmt.Sprintf("Destination %s is longer than %d characters, skipping %s", err.destPath, err.maxLength, err.srcPath)
+}
+
+func (err *PathTooLongError) Is(target error) bool {
+	return target == ErrPathTooLong
+}
+
+// determineMaxPathLength returns the maximum length of destination paths, 0 means no limit
+func determineMaxPathLength(config *Config) int {
+	if config.MaxPathLength < 0 {
+		return 0
+	}
+	if config.MaxPathLength > 0 {
+		return config.MaxPathLength
+	}
+	return defaultMaxPathLength
+}
+
+// checkPathLength returns a PathTooLongError if the absolute destination path is longer than MaxPathLength.
+// It counts characters instead of bytes, like Windows does.
+func (m *MediaSorter) checkPathLength(srcPath string, destPath string) error {
+	if m.MaxPathLength == 0 {
+		return nil
+	}
+	absPath, err := filepath.Abs(destPath)
+	if err != nil {
+		absPath = destPath
+	}
+	if utf8.RuneCountInString(absPath) > m.MaxPathLength {
+		return &PathTooLongError{srcPath: srcPath, destPath: destPath, maxLength: m.MaxPathLength}
+	}
+	return nil
+}
@@ -0,0 +1,6 @@
+//go:build !windows
+
+package sorter
+
+// defaultMaxPathLength is 0, because Linux and macOS only limit the length of each path segment in practice
+const defaultMaxPathLength = 0
@@ -0,0 +1,91 @@
+package sorter
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunSkipsFilesWithTooLongDestinationPaths(t *testing.T) {
+	srcDir := t.TempDir()
+	destDir, err := filepath.Abs(filepath.Join(t.TempDir(), "sorted"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][]byte{
+		"short.flac": flacStream("TITLE=Short", "ARTIST=Artist", "ALBUM=Album", "TRACKNUMBER=1"),
+		"long.flac":  flacStream("TITLE="+strings.Repeat("Long", 20), "ARTIST=Artist", "ALBUM=Album", "TRACKNUMBER=2"),
+	}
+	writeSourceFiles(t, srcDir, files)
+	// Room for "/Artist/Album/01. Short.flac", but not for the long title
+	maxLength := len(destDir) + 40
+
+	var output bytes.Buffer
+	mediaSorter, err := New(&Config{DestDir: destDir, MaxPathLength: maxLength, ReportSkipsAsErrors: true, Output: &output})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	err = mediaSorter.Run(srcDir)
+	if err == nil || !strings.Contains(err.Error(), "1 path-too-long") {
+		t.Errorf("Expected skipped file error with reason path-too-long, got %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(destDir, "Artist", "Album", "01. Short.flac")); err != nil {
+		t.Errorf("Expected file with short destination: %v", err)
+	}
+	longPath := filepath.Join(destDir, "Artist", "Album", "02. "+strings.Repeat("Long", 20)+".flac")
+	if _, err := os.Stat(longPath); !os.IsNotExist(err) {
+		t.Errorf("Expected file with long destination to be skipped, got %v", err)
+	}
+	if !strings.Contains(output.String(), "is longer than ") {
+		t.Errorf("Expected warning about the path length, got %q", output.String())
+	}
+}
+
+func TestCheckPathLength(t *testing.T) {
+	destPath, err := filepath.Abs(filepath.Join("sorted", "Motörhead", "Album"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	length := len([]rune(destPath))
+	tests := []struct {
+		description   string
+		maxLength     int
+		expectTooLong bool
+	}{
+		{"no limit", 0, false},
+		{"counts characters, not bytes", length, false},
+		{"longer than limit", length - 1, true},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			mediaSorter := &MediaSorter{MaxPathLength: test.maxLength}
+			err := mediaSorter.checkPathLength("track.flac", destPath)
+			if errors.Is(err, ErrPathTooLong) != test.expectTooLong {
+				t.Errorf("Expected too long path %v, got %v", test.expectTooLong, err)
+			}
+		})
+	}
+}
+
+func TestDetermineMaxPathLength(t *testing.T) {
+	tests := []struct {
+		description string
+		maxLength   int
+		expected    int
+	}{
+		{"platform default", 0, defaultMaxPathLength},
+		{"explicit limit", 100, 100},
+		{"no limit", -1, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			if actual := determineMaxPathLength(&Config{MaxPathLength: test.maxLength}); actual != test.expected {
+				t.Errorf("Expected %d but got %d", test.expected, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,7 @@
+//go:build windows
+
+package sorter
+
+// defaultMaxPathLength is the path length that most Windows programs support,
+// MAX_PATH is 260 characters including the terminating null character
+const defaultMaxPathLength = 259
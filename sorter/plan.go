@@ -0,0 +1,294 @@
+package sorter
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// PlanVerification determines what happens when several source files would get the same destination
+type PlanVerification string
+
+const (
+	// Don't check the destinations before processing the files
+	NoPlanVerification PlanVerification = ""
+	// Show all collisions before processing the files
+	WarnOnCollisions PlanVerification = "warn"
+	// Show all collisions and stop without processing any files
+	AbortOnCollisions PlanVerification = "abort"
+)
+
+func ParsePlanVerification(verification string) (PlanVerification, error) {
+	switch PlanVerification(verification) {
+	case NoPlanVerification, WarnOnCollisions, AbortOnCollisions:
+		return PlanVerification(verification), nil
+	}
+	return "", fmt.Errorf("invalid plan verification '%s', must be %s or %s", verification, WarnOnCollisions, AbortOnCollisions)
+}
+
+// destination is the result of rendering the templates for a file group
+type destination struct {
+	// Metadata of the media file, and the metadata for the templates, with the defaults for empty fields
+	metadata      *Metadata
+	cleanMetadata *Metadata
+	origName      string
+	// Path of the media file and sidecar files relative to DestDir, without extension
+	pathStr  string
+	destPath string
+}
+
+// plannedDestination caches the result of planDestination
+type plannedDestination struct {
+	dest *destination
+	err  error
+}
+
+// planDestination returns the destination for the file group. It renders the destination only once,
+// to show the same destinations when verifying or confirming the plan and when processing the files.
+func (m *MediaSorter) planDestination(group *FileGroup) (*destination, error) {
+	m.mu.Lock()
+	planned, ok := m.destinations[group.MediaFile]
+	m.mu.Unlock()
+	if ok {
+		return planned.dest, planned.err
+	}
+
+	dest, err := m.renderDestination(group)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.destinations == nil {
+		m.destinations = make(map[MediaFile]plannedDestination)
+	}
+	m.destinations[group.MediaFile] = plannedDestination{dest: dest, err: err}
+	return dest, err
+}
+
+// plannedMetadata returns the metadata of a media file that has a planned destination, for the manifest
+func (m *MediaSorter) plannedMetadata(srcPath string) *Metadata {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	planned, ok := m.destinations[MediaFile(srcPath)]
+	if !ok || planned.dest == nil {
+		return nil
+	}
+	return planned.dest.metadata
+}
+
+// renderDestination reads the metadata of the media file and renders the destination path for the file group
+func (m *MediaSorter) renderDestination(group *FileGroup) (*destination, error) {
+	metadata, err := m.MetadataReader.ReadMetadata(group.MediaFile)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := m.checkMarker(group.MediaFile, metadata); err != nil {
+		return nil, err
+	}
+
+	m.fillAlbumArtist(group.MediaFile, metadata)
+
+	if m.NormalizePunctuation {
+		metadata = metadata.MapText(normalizePunctuation)
+	}
+	cleanMetadata := metadata.CleanForPaths()
+	// Filter by the values that the template sees, e.g. the genre without slashes
+	if err := m.checkFilters(group.MediaFile, cleanMetadata); err != nil {
+		return nil, err
+	}
+	origName := originalName(string(group.MediaFile))
+	if m.StrictTemplate {
+		empty, err := renderedEmptyFields(m.PathTemplate, cleanMetadata, origName)
+		if err != nil {
+			return nil, &TemplateError{srcPath: string(group.MediaFile), err: err}
+		}
+		if len(empty) > 0 {
+			return nil, &EmptyFieldError{srcPath: string(group.MediaFile), fields: empty}
+		}
+	}
+
+	// Generate the destination path and `destPath` for sidecar files, using the template
+	if m.MetadataDefaults != nil {
+		cleanMetadata = cleanMetadata.WithDefaults(*m.MetadataDefaults, origName)
+	}
+	renderedPath, err := executePathTemplate(m.PathTemplate, cleanMetadata, origName)
+	if err != nil {
+		return nil, &TemplateError{srcPath: string(group.MediaFile), err: err}
+	}
+	if m.Sanitizer.asciiOnly {
+		if dropped := unfoldableChars(renderedPath); len(dropped) > 0 {
+			m.OutputWriter.Warn(fmt.Sprintf("Dropping characters '%s' from the destination of %s, they have no ASCII equivalent", string(dropped), group.MediaFile))
+		}
+	}
+	pathStr := m.Sanitizer.cleanPath(renderedPath)
+	if m.FlattenIndexTemplate != nil {
+		index, err := executePathTemplate(m.FlattenIndexTemplate, cleanMetadata, origName)
+		if err != nil {
+			return nil, &TemplateError{srcPath: string(group.MediaFile), err: err}
+		}
+		pathStr = m.Sanitizer.flattenPath(pathStr, index)
+	}
+	if m.KeepOriginalName {
+		// Append the suffix after cleaning, the cleanup would replace its brackets and underscore
+		if cleanName := m.Sanitizer.cleanPathSegment(origName); cleanName != "" {
+			pathStr = m.Sanitizer.appendToName(pathStr, " [orig_"+cleanName+"]")
+		}
+	}
+	mediaExt := filepath.Ext(string(group.MediaFile))
+	if m.FixExtension {
+		if ext, corrected := correctExtension(mediaExt, metadata.FileType); corrected {
+			m.OutputWriter.Warn(fmt.Sprintf("File %s is a %s file, using the extension %s", group.MediaFile, metadata.FileType, ext))
+			mediaExt = ext
+		}
+	}
+	// Keep room for the extensions of the media file and its sidecar files, the file system limit includes them
+	extLength := len(mediaExt)
+	for _, file := range group.Files() {
+		extLength = max(extLength, len(filepath.Ext(file)))
+	}
+	pathStr = m.Sanitizer.shortenName(pathStr, extLength)
+	destPath := filepath.Join(m.DestDir, pathStr+mediaExt)
+	if err := checkInsideDir(m.DestDir, destPath); err != nil {
+		return nil, err
+	}
+
+	return &destination{
+		metadata:      metadata,
+		cleanMetadata: cleanMetadata,
+		origName:      origName,
+		pathStr:       pathStr,
+		destPath:      destPath,
+	}, nil
+}
+
+// confirmPlan shows the destinations of all media files and asks whether to process them.
+// Without a Confirm function, it processes the files without asking.
+func (m *MediaSorter) confirmPlan(mediaGroups map[string]*FileGroup) bool {
+	if m.Confirm == nil {
+		return true
+	}
+
+	groups := slices.Collect(maps.Values(mediaGroups))
+	slices.SortFunc(groups, func(a, b *FileGroup) int {
+		return strings.Compare(string(a.MediaFile), string(b.MediaFile))
+	})
+	for _, group := range groups {
+		dest, err := m.planDestination(group)
+		if err != nil {
+			m.OutputWriter.Warn(err.Error())
+			continue
+		}
+		message := fmt.Sprintf("%s -> %s", group.MediaFile, dest.destPath)
+		if len(group.SidecarFiles) > 0 {
+			message += fmt.Sprintf(" (and %d sidecar files)", len(group.SidecarFiles))
+		}
+		m.OutputWriter.Print(message)
+	}
+
+	if !m.Confirm("Apply?") {
+		m.OutputWriter.Print("No files were processed")
+		return false
+	}
+	return true
+}
+
+// renameIfExists adds a number to the destination file name, if the destination exists or was already used in this run.
+// With Dedupe, it stops at a destination with the same content as the source, for the override checker to skip it.
+// It compares the files without holding the lock, so it looks again if another job claimed the free destination meanwhile.
+func (m *MediaSorter) renameIfExists(srcPath string, dest *destination) {
+	ext := filepath.Ext(dest.destPath)
+	var pathStr string
+	for {
+		var used []string
+		used, pathStr = m.renameCandidates(dest.pathStr, ext)
+		free := pathStr
+		if m.Dedupe {
+			if i := slices.IndexFunc(used, func(candidate string) bool {
+				return identicalFile(srcPath, filepath.Join(m.DestDir, candidate+ext))
+			}); i >= 0 {
+				pathStr = used[i]
+			}
+		}
+		if m.claimDestination(filepath.Join(m.DestDir, pathStr+ext), pathStr == free) {
+			break
+		}
+	}
+	if pathStr != dest.pathStr {
+		renamedPath := filepath.Join(m.DestDir, pathStr+ext)
+		m.OutputWriter.Info(fmt.Sprintf("File %s already exists, using %s", dest.destPath, renamedPath))
+		dest.pathStr = pathStr
+		dest.destPath = renamedPath
+	}
+}
+
+// renameCandidates returns the numbered destinations that are already used, in order, and the first free one
+func (m *MediaSorter) renameCandidates(pathStr string, ext string) ([]string, string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var used []string
+	candidate := pathStr
+	for i := 2; m.destinationUsed(filepath.Join(m.DestDir, candidate+ext)); i++ {
+		used = append(used, candidate)
+		candidate = fmt.Sprintf("%s (%d)", pathStr, i)
+	}
+	return used, candidate
+}
+
+// claimDestination records the destination as used in this run. If free is true,
+// it only claims the destination if no other job used it since renameCandidates.
+func (m *MediaSorter) claimDestination(destPath string, free bool) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if free && m.destinationUsed(destPath) {
+		return false
+	}
+	m.usedDestinations[destPath] = struct{}{}
+	return true
+}
+
+func (m *MediaSorter) destinationUsed(destPath string) bool {
+	if _, used := m.usedDestinations[destPath]; used {
+		return true
+	}
+	_, err := os.Lstat(destPath)
+	return err == nil
+}
+
+// verifyPlan determines the destination of all media files and reports destinations
+// that more than one source file would be written to. Files that would be skipped don't count.
+func (m *MediaSorter) verifyPlan(mediaGroups map[string]*FileGroup) error {
+	sources := make(map[string][]string)
+	for _, group := range mediaGroups {
+		dest, err := m.planDestination(group)
+		if err != nil {
+			// Processing will report the error
+			continue
+		}
+		sources[dest.destPath] = append(sources[dest.destPath], string(group.MediaFile))
+	}
+
+	var collisions []string
+	for destPath, srcPaths := range sources {
+		if len(srcPaths) > 1 {
+			collisions = append(collisions, destPath)
+		}
+	}
+	if len(collisions) == 0 {
+		return nil
+	}
+
+	slices.Sort(collisions)
+	for _, destPath := range collisions {
+		srcPaths := sources[destPath]
+		slices.Sort(srcPaths)
+		m.OutputWriter.Warn(fmt.Sprintf("Files %s would all be written to %s", strings.Join(srcPaths, ", "), destPath))
+	}
+	if m.PlanVerification == AbortOnCollisions {
+		return fmt.Errorf("found %d destinations for more than one file, no files were processed", len(collisions))
+	}
+	return nil
+}
@@ -0,0 +1,307 @@
+package sorter
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeCollidingFiles(t *testing.T) string {
+	srcDir := t.TempDir()
+	for _, dir := range []string{"a", "b"} {
+		if err := os.MkdirAll(filepath.Join(srcDir, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+		content := flacStream("TITLE=Title", "ARTIST=Artist", "ALBUM=Album")
+		if err := os.WriteFile(filepath.Join(srcDir, dir, "track.flac"), content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return srcDir
+}
+
+func TestVerifyPlanAbortsOnCollisions(t *testing.T) {
+	srcDir := writeCollidingFiles(t)
+	destDir := filepath.Join(t.TempDir(), "sorted")
+	var output bytes.Buffer
+
+	mediaSorter, err := New(&Config{DestDir: destDir, Move: true, VerifyPlan: AbortOnCollisions, Output: &output})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	if err := mediaSorter.Run(srcDir); err == nil {
+		t.Fatal("Expected Run to return an error")
+	}
+
+	expectedMessage := "Files " + filepath.Join(srcDir, "a", "track.flac") + ", " + filepath.Join(srcDir, "b", "track.flac") + " would all be written to"
+	if !strings.Contains(output.String(), expectedMessage) {
+		t.Errorf("Expected output to contain '%s' but got '%s'", expectedMessage, output.String())
+	}
+	if _, err := os.Stat(destDir); !os.IsNotExist(err) {
+		t.Errorf("Expected no files to be moved, but %s exists", destDir)
+	}
+}
+
+func TestVerifyPlanWarnsOnCollisions(t *testing.T) {
+	srcDir := writeCollidingFiles(t)
+	destDir := filepath.Join(t.TempDir(), "sorted")
+	var output bytes.Buffer
+
+	mediaSorter, err := New(&Config{DestDir: destDir, VerifyPlan: WarnOnCollisions, Output: &output})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	if err := mediaSorter.Run(srcDir); err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+
+	if !strings.Contains(output.String(), "would all be written to") {
+		t.Errorf("Expected a collision warning but got '%s'", output.String())
+	}
+	if _, err := os.Stat(filepath.Join(destDir, "Artist", "Album", "Title.flac")); err != nil {
+		t.Errorf("Expected sorted file: %v", err)
+	}
+}
+
+func TestVerifyPlanReportsEveryCollision(t *testing.T) {
+	srcDir := t.TempDir()
+	files := map[string][]byte{
+		"a.flac":      flacStream("TITLE=First", "ARTIST=Artist", "ALBUM=Album"),
+		"b.flac":      flacStream("TITLE=First", "ARTIST=Artist", "ALBUM=Album"),
+		"c.flac":      flacStream("TITLE=Second", "ARTIST=Artist", "ALBUM=Album"),
+		"d.flac":      flacStream("TITLE=Second", "ARTIST=Artist", "ALBUM=Album"),
+		"e.flac":      flacStream("TITLE=Second", "ARTIST=Artist", "ALBUM=Album"),
+		"unique.flac": flacStream("TITLE=Unique", "ARTIST=Artist", "ALBUM=Album"),
+	}
+	writeSourceFiles(t, srcDir, files)
+	destDir := filepath.Join(t.TempDir(), "sorted")
+	var output bytes.Buffer
+
+	mediaSorter, err := New(&Config{DestDir: destDir, VerifyPlan: AbortOnCollisions, Output: io.Discard, ErrOutput: &output})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	err = mediaSorter.Run(srcDir)
+	if err == nil || !strings.Contains(err.Error(), "found 2 destinations for more than one file") {
+		t.Fatalf("Expected an error about 2 collisions, got %v", err)
+	}
+
+	expectedMessages := []string{
+		"Files " + filepath.Join(srcDir, "a.flac") + ", " + filepath.Join(srcDir, "b.flac") + " would all be written to " + filepath.Join(destDir, "Artist", "Album", "First.flac"),
+		"Files " + filepath.Join(srcDir, "c.flac") + ", " + filepath.Join(srcDir, "d.flac") + ", " + filepath.Join(srcDir, "e.flac") + " would all be written to " + filepath.Join(destDir, "Artist", "Album", "Second.flac"),
+	}
+	for _, expected := range expectedMessages {
+		if !strings.Contains(output.String(), expected) {
+			t.Errorf("Expected warnings to contain '%s' but got '%s'", expected, output.String())
+		}
+	}
+	if strings.Contains(output.String(), "unique.flac") {
+		t.Errorf("Expected no warning for the file with a unique destination, got '%s'", output.String())
+	}
+}
+
+func TestParsePlanVerification(t *testing.T) {
+	for _, verification := range []string{"", "warn", "abort"} {
+		if _, err := ParsePlanVerification(verification); err != nil {
+			t.Errorf("Expected '%s' to be valid: %v", verification, err)
+		}
+	}
+	if _, err := ParsePlanVerification("ignore"); err == nil {
+		t.Error("Expected error for invalid verification")
+	}
+}
+
+func TestRunRenamesExistingFiles(t *testing.T) {
+	srcDir := writeCollidingFiles(t)
+	if err := os.WriteFile(filepath.Join(srcDir, "a", "track.lrc"), []byte("lyrics"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	destDir := filepath.Join(t.TempDir(), "sorted")
+	albumDir := filepath.Join(destDir, "Artist", "Album")
+	if err := os.MkdirAll(albumDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(albumDir, "Title.flac"), []byte("existing"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	mediaSorter, err := New(&Config{DestDir: destDir, OnExists: RenameExisting, Output: io.Discard})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	if err := mediaSorter.Run(srcDir); err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+
+	for _, name := range []string{"Title.flac", "Title (2).flac", "Title (3).flac"} {
+		if _, err := os.Stat(filepath.Join(albumDir, name)); err != nil {
+			t.Errorf("Expected file %s: %v", name, err)
+		}
+	}
+	existing, _ := os.ReadFile(filepath.Join(albumDir, "Title.flac"))
+	if string(existing) != "existing" {
+		t.Errorf("Expected existing file to be kept, but got '%s'", existing)
+	}
+	matches, _ := filepath.Glob(filepath.Join(albumDir, "Title (?).lrc"))
+	if len(matches) != 1 {
+		t.Errorf("Expected the sidecar file to be renamed with its media file, got %v", matches)
+	}
+}
+
+func TestRunDedupesExistingFiles(t *testing.T) {
+	srcDir := t.TempDir()
+	files := map[string][]byte{
+		"same.flac":      flacStream("TITLE=Same", "ARTIST=Artist", "ALBUM=Album"),
+		"renamed.flac":   flacStream("TITLE=Renamed", "ARTIST=Artist", "ALBUM=Album"),
+		"different.flac": flacStream("TITLE=Different", "ARTIST=Artist", "ALBUM=Album"),
+	}
+	writeSourceFiles(t, srcDir, files)
+	destDir := filepath.Join(t.TempDir(), "sorted")
+	albumDir := filepath.Join(destDir, "Artist", "Album")
+	if err := os.MkdirAll(albumDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	// The destination of "renamed" has different content, but an earlier run renamed it to "Renamed (2)"
+	destFiles := map[string][]byte{
+		"Same.flac":        files["same.flac"],
+		"Renamed.flac":     []byte("existing"),
+		"Renamed (2).flac": files["renamed.flac"],
+		"Different.flac":   []byte("existing"),
+	}
+	for name, content := range destFiles {
+		if err := os.WriteFile(filepath.Join(albumDir, name), content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mediaSorter, err := New(&Config{DestDir: destDir, OnExists: DedupeExisting, Output: io.Discard})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	if err := mediaSorter.Run(srcDir); err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+
+	matches, _ := filepath.Glob(filepath.Join(albumDir, "*.flac"))
+	if len(matches) != 5 {
+		t.Errorf("Expected only a renamed copy of the different file, got %v", matches)
+	}
+	content, err := os.ReadFile(filepath.Join(albumDir, "Different (2).flac"))
+	if err != nil || string(content) != string(files["different.flac"]) {
+		t.Errorf("Expected the different file to be renamed, got %v", err)
+	}
+	existing, _ := os.ReadFile(filepath.Join(albumDir, "Different.flac"))
+	if string(existing) != "existing" {
+		t.Errorf("Expected existing file to be kept, but got '%s'", existing)
+	}
+}
+
+func TestRunWithOverrideKeepsFirstFileOfRun(t *testing.T) {
+	tests := []struct {
+		description       string
+		override          bool
+		expectedRemaining int
+	}{
+		{"overwrite", false, 0},
+		{"deprecated override", true, 1},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			srcDir := writeCollidingFiles(t)
+			destDir := t.TempDir()
+			writeSourceFiles(t, destDir, map[string][]byte{"Artist/Album/Title.flac": []byte("existing")})
+
+			mediaSorter, err := New(&Config{DestDir: destDir, Move: true, Override: test.override, Output: io.Discard, ErrOutput: io.Discard})
+			if err != nil {
+				t.Fatalf("New returned error: %v", err)
+			}
+			if err := mediaSorter.Run(srcDir); err != nil {
+				t.Fatalf("Run returned error: %v", err)
+			}
+
+			content, _ := os.ReadFile(filepath.Join(destDir, "Artist", "Album", "Title.flac"))
+			if string(content) == "existing" {
+				t.Errorf("Expected the file of an earlier run to be overwritten")
+			}
+			remaining, _ := filepath.Glob(filepath.Join(srcDir, "*", "track.flac"))
+			if len(remaining) != test.expectedRemaining {
+				t.Errorf("Expected %d source files with the same destination to be skipped, got %v", test.expectedRemaining, remaining)
+			}
+		})
+	}
+}
+
+func TestRunDedupesWithParallelJobs(t *testing.T) {
+	srcDir := t.TempDir()
+	sources := make(map[string][]byte)
+	for i := range 8 {
+		sources[fmt.Sprintf("%d/track.flac", i)] = flacStream("TITLE=Title", "ARTIST=Artist", "ALBUM=Album", fmt.Sprintf("COMMENT=%d", i))
+	}
+	writeSourceFiles(t, srcDir, sources)
+	destDir := t.TempDir()
+	writeSourceFiles(t, destDir, map[string][]byte{"Artist/Album/Title.flac": sources["0/track.flac"]})
+
+	mediaSorter, err := New(&Config{DestDir: destDir, OnExists: DedupeExisting, Jobs: 4, Output: io.Discard})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	if err := mediaSorter.Run(srcDir); err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+
+	matches, _ := filepath.Glob(filepath.Join(destDir, "Artist", "Album", "*.flac"))
+	contents := make(map[string]struct{})
+	for _, match := range matches {
+		content, err := os.ReadFile(match)
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents[string(content)] = struct{}{}
+	}
+	if len(matches) != len(sources) || len(contents) != len(sources) {
+		t.Errorf("Expected one file for each different source, got %v", matches)
+	}
+}
+
+func TestRunAsksForConfirmation(t *testing.T) {
+	for _, answer := range []bool{false, true} {
+		srcDir := t.TempDir()
+		destDir := filepath.Join(t.TempDir(), "sorted")
+		content := flacStream("TITLE=Title", "ARTIST=Artist", "ALBUM=Album")
+		if err := os.WriteFile(filepath.Join(srcDir, "track.flac"), content, 0644); err != nil {
+			t.Fatal(err)
+		}
+		var output bytes.Buffer
+		var questions []string
+
+		mediaSorter, err := New(&Config{
+			DestDir: destDir,
+			Output:  &output,
+			Confirm: func(question string) bool {
+				questions = append(questions, question)
+				return answer
+			},
+		})
+		if err != nil {
+			t.Fatalf("New returned error: %v", err)
+		}
+		if err := mediaSorter.Run(srcDir); err != nil {
+			t.Fatalf("Run returned error: %v", err)
+		}
+
+		destPath := filepath.Join(destDir, "Artist", "Album", "Title.flac")
+		if len(questions) != 1 {
+			t.Errorf("Expected one question but got %v", questions)
+		}
+		if !strings.Contains(output.String(), "track.flac -> "+destPath) {
+			t.Errorf("Expected the plan in the output but got '%s'", output.String())
+		}
+		if _, err := os.Stat(destPath); (err == nil) != answer {
+			t.Errorf("Expected file to be copied only after confirmation, answer was %t", answer)
+		}
+	}
+}
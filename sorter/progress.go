@@ -0,0 +1,21 @@
+package sorter
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// progress counts the processed file groups of a run, for showing a counter like "[12/340]" for each file.
+// A nil progress shows no counter.
+type progress struct {
+	total int
+	done  atomic.Int64
+}
+
+// next counts the next file group and returns its counter
+func (p *progress) next() string {
+	if p == nil {
+		return ""
+	}
+	return fmt.Sprintf("[%d/%d]", p.done.Add(1), p.total)
+}
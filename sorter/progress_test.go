@@ -0,0 +1,46 @@
+package sorter
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRunShowsProgressOfFileGroups(t *testing.T) {
+	srcDir := t.TempDir()
+	files := map[string][]byte{
+		"one.flac":   flacStream("TITLE=One", "ARTIST=Artist", "ALBUM=Album"),
+		"one.cue":    []byte("cue sheet"),
+		"two.flac":   flacStream("TITLE=Two", "ARTIST=Artist", "ALBUM=Album"),
+		"three.flac": flacStream("TITLE=Three", "ARTIST=Artist", "ALBUM=Album"),
+	}
+	writeSourceFiles(t, srcDir, files)
+
+	for _, jobs := range []int{1, 2} {
+		var output bytes.Buffer
+		mediaSorter, err := New(&Config{DestDir: t.TempDir(), Progress: true, Jobs: jobs, Verbosity: Quiet, Output: &output})
+		if err != nil {
+			t.Fatalf("New returned error: %v", err)
+		}
+		if err := mediaSorter.Run(srcDir); err != nil {
+			t.Fatalf("Run returned error: %v", err)
+		}
+
+		lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+		if len(lines) != 3 {
+			t.Fatalf("Expected a line for each of the 3 file groups with %d jobs, got %q", jobs, output.String())
+		}
+		for _, counter := range []string{"[1/3] Processing file", "[2/3] Processing file", "[3/3] Processing file"} {
+			if !strings.Contains(output.String(), counter) {
+				t.Errorf("Expected output with %d jobs to contain '%s' but got '%s'", jobs, counter, output.String())
+			}
+		}
+	}
+}
+
+func TestNilProgressShowsNoCounter(t *testing.T) {
+	var p *progress
+	if counter := p.next(); counter != "" {
+		t.Errorf("Expected no counter, got '%s'", counter)
+	}
+}
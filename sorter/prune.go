@@ -0,0 +1,134 @@
+package sorter
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Name of the trash directory in the source directory, when no trash directory is configured
+const DefaultTrashDirName = ".mediasorter-trash"
+
+// EmptyDirRemover removes an empty directory of the source directory
+type EmptyDirRemover func(srcDir string, dir string) error
+
+// DeleteEmptyDir removes the empty directory permanently
+func DeleteEmptyDir(srcDir string, dir string) error {
+	if err := os.Remove(dir); err != nil {
+		return fmt.Errorf("error removing empty directory %s: %w", dir, err)
+	}
+	return nil
+}
+
+// TrashEmptyDir returns an EmptyDirRemover that moves empty directories into the trash directory,
+// keeping their path relative to the source directory. An empty trashDir means DefaultTrashDirName in the source directory.
+func TrashEmptyDir(trashDir string) EmptyDirRemover {
+	return func(srcDir string, dir string) error {
+		relPath, err := filepath.Rel(srcDir, dir)
+		if err != nil {
+			return fmt.Errorf("error getting path of %s in %s: %w", dir, srcDir, err)
+		}
+		trashPath := filepath.Join(determineTrashDir(trashDir, srcDir), relPath)
+		// An emptied subdirectory is already in the trash, the trash has the directory as its parent
+		if _, err := os.Lstat(trashPath); err == nil {
+			return DeleteEmptyDir(srcDir, dir)
+		}
+		if err := os.MkdirAll(filepath.Dir(trashPath), 0755); err != nil {
+			return fmt.Errorf("error creating trash directory %s: %w", filepath.Dir(trashPath), err)
+		}
+		if err := os.Rename(dir, trashPath); err != nil {
+			return fmt.Errorf("error moving empty directory %s to %s: %w", dir, trashPath, err)
+		}
+		return nil
+	}
+}
+
+func determineTrashDir(trashDir string, srcDir string) string {
+	if trashDir == "" {
+		return filepath.Join(srcDir, DefaultTrashDirName)
+	}
+	return filepath.Clean(trashDir)
+}
+
+// movedFromDirs records the directories that the run moved files out of, for pruning only the directories that it emptied
+type movedFromDirs struct {
+	mu   sync.Mutex
+	dirs map[string]struct{}
+}
+
+// withMovedFromDirs wraps a FileProcessor to record the directory of each file that it moved
+func (d *movedFromDirs) withMovedFromDirs(fileProcessor FileProcessor) FileProcessor {
+	return func(srcPath string, destPath string) error {
+		if err := fileProcessor(srcPath, destPath); err != nil {
+			return err
+		}
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		d.dirs[filepath.Dir(srcPath)] = struct{}{}
+		return nil
+	}
+}
+
+// pruneCandidates returns the recorded directories and their parents inside the source directory,
+// without the source directory itself and the trash directory. It clears the recorded directories for the next run.
+func (d *movedFromDirs) pruneCandidates(srcDir string, trashDir string) ([]string, error) {
+	absSrcDir, err := filepath.Abs(srcDir)
+	if err != nil {
+		return nil, err
+	}
+	absTrashDir, err := filepath.Abs(trashDir)
+	if err != nil {
+		return nil, err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	candidates := make(map[string]struct{})
+	for dir := range d.dirs {
+		absDir, err := filepath.Abs(dir)
+		if err != nil {
+			return nil, err
+		}
+		for ; absDir != absSrcDir && isInsideDir(absSrcDir, absDir) && !isInsideDir(absTrashDir, absDir); absDir = filepath.Dir(absDir) {
+			candidates[absDir] = struct{}{}
+		}
+	}
+	clear(d.dirs)
+	return slices.Collect(maps.Keys(candidates)), nil
+}
+
+// pruneEmptyDirs removes the directories that the run moved files out of and that are empty now, and their
+// parent directories that are empty after that, subdirectories before their parents.
+// It keeps the source directory itself, the trash directory and directories that were empty before the run.
+func (m *MediaSorter) pruneEmptyDirs(srcDir string) error {
+	dirs, err := m.movedFromDirs.pruneCandidates(srcDir, determineTrashDir(m.TrashDir, srcDir))
+	if err != nil {
+		return err
+	}
+
+	// Subdirectories come after their parent directories in lexical order
+	slices.SortFunc(dirs, func(a, b string) int {
+		return strings.Compare(b, a)
+	})
+	absSrcDir, err := filepath.Abs(srcDir)
+	if err != nil {
+		return err
+	}
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return fmt.Errorf("error reading directory %s: %w", dir, err)
+		}
+		if len(entries) > 0 {
+			continue
+		}
+		m.OutputWriter.Info(fmt.Sprintf("Removing empty directory %s", dir))
+		if err := m.EmptyDirRemover(absSrcDir, dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package sorter
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunPrunesEmptySourceDirectories(t *testing.T) {
+	tests := []struct {
+		description     string
+		deleteEmpty     bool
+		expectedInTrash bool
+	}{
+		{"moves empty directories into the trash", false, true},
+		{"deletes empty directories", true, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			srcDir := t.TempDir()
+			files := map[string][]byte{
+				"Album/CD1/track.flac": flacStream("TITLE=Title", "ARTIST=Artist", "ALBUM=Album"),
+				"Other/notes.txt":      []byte("notes"),
+			}
+			writeSourceFiles(t, srcDir, files)
+			destDir := filepath.Join(t.TempDir(), "sorted")
+
+			mediaSorter, err := New(&Config{DestDir: destDir, Move: true, PruneEmpty: true, DeleteEmpty: test.deleteEmpty, Verbosity: Quiet, Output: io.Discard})
+			if err != nil {
+				t.Fatalf("New returned error: %v", err)
+			}
+			if err := mediaSorter.Run(srcDir); err != nil {
+				t.Fatalf("Run returned error: %v", err)
+			}
+
+			if _, err := os.Stat(filepath.Join(srcDir, "Album")); !os.IsNotExist(err) {
+				t.Errorf("Expected empty directory to be removed, got %v", err)
+			}
+			if _, err := os.Stat(filepath.Join(srcDir, "Other", "notes.txt")); err != nil {
+				t.Errorf("Expected directory with files to be kept: %v", err)
+			}
+			_, err = os.Stat(filepath.Join(srcDir, DefaultTrashDirName, "Album", "CD1"))
+			if test.expectedInTrash && err != nil {
+				t.Errorf("Expected empty directory in the trash: %v", err)
+			}
+			if !test.expectedInTrash && !os.IsNotExist(err) {
+				t.Errorf("Expected no trash directory, got %v", err)
+			}
+		})
+	}
+}
+
+func TestRunPruneKeepsSourceDirAndDirectoriesWithRemainingFiles(t *testing.T) {
+	srcDir := t.TempDir()
+	files := map[string][]byte{
+		"Artist/Album/CD1/track.flac": flacStream("TITLE=One", "ARTIST=Artist", "ALBUM=Album"),
+		"Artist/Album/CD2/track.flac": flacStream("TITLE=Two", "ARTIST=Artist", "ALBUM=Album"),
+		"Hidden/track.flac":           flacStream("TITLE=Three", "ARTIST=Artist", "ALBUM=Album"),
+		"Hidden/.DS_Store":            []byte("hidden"),
+		"Skipped/untagged.flac":       []byte("not a media file"),
+		"top.flac":                    flacStream("TITLE=Top", "ARTIST=Artist", "ALBUM=Album"),
+	}
+	writeSourceFiles(t, srcDir, files)
+	destDir := filepath.Join(t.TempDir(), "sorted")
+
+	mediaSorter, err := New(&Config{DestDir: destDir, Move: true, PruneEmpty: true, DeleteEmpty: true, Output: io.Discard})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	if err := mediaSorter.Run(srcDir); err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(srcDir, "Artist")); !os.IsNotExist(err) {
+		t.Errorf("Expected nested empty directories to be removed, got %v", err)
+	}
+	for _, kept := range []string{"Hidden/.DS_Store", "Skipped/untagged.flac"} {
+		if _, err := os.Stat(filepath.Join(srcDir, kept)); err != nil {
+			t.Errorf("Expected directory with remaining file %s to be kept: %v", kept, err)
+		}
+	}
+
+	// Without the remaining files, the source directory itself is empty
+	if err := os.RemoveAll(filepath.Join(srcDir, "Hidden")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.RemoveAll(filepath.Join(srcDir, "Skipped")); err != nil {
+		t.Fatal(err)
+	}
+	if err := mediaSorter.Run(srcDir); err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+	entries, err := os.ReadDir(srcDir)
+	if err != nil {
+		t.Fatalf("Expected source directory to be kept: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("Expected empty source directory, got %v", entries)
+	}
+}
+
+func TestRunPruneOnlyRemovesDirectoriesEmptiedByTheRun(t *testing.T) {
+	parentDir := t.TempDir()
+	srcDir := filepath.Join(parentDir, "unsorted")
+	writeSourceFiles(t, srcDir, map[string][]byte{
+		"Album/CD1/track.flac": flacStream("TITLE=Title", "ARTIST=Artist", "ALBUM=Album"),
+	})
+	for _, dir := range []string{"Empty", filepath.Join("trash", "Old")} {
+		if err := os.MkdirAll(filepath.Join(srcDir, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The trash directory is relative, the source directory is absolute
+	t.Chdir(parentDir)
+
+	mediaSorter, err := New(&Config{DestDir: filepath.Join(t.TempDir(), "sorted"), Move: true, PruneEmpty: true, TrashDir: filepath.Join("unsorted", "trash"), Output: io.Discard})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	if err := mediaSorter.Run(srcDir); err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(srcDir, "Album")); !os.IsNotExist(err) {
+		t.Errorf("Expected emptied directory to be removed, got %v", err)
+	}
+	for _, kept := range []string{"Empty", "trash/Old", "trash/Album/CD1"} {
+		if _, err := os.Stat(filepath.Join(srcDir, filepath.FromSlash(kept))); err != nil {
+			t.Errorf("Expected directory %s to be kept: %v", kept, err)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package sorter
+
+import (
+	"fmt"
+	"maps"
+	"math/rand/v2"
+	"slices"
+	"strings"
+)
+
+// selectSample returns n randomly selected file groups, or all file groups if there are no more than n
+func selectSample(mediaGroups map[string]*FileGroup, n int, random *rand.Rand) map[string]*FileGroup {
+	if len(mediaGroups) <= n {
+		return mediaGroups
+	}
+	// Sort the keys, to get the same sample for the same random numbers
+	basenames := slices.Sorted(maps.Keys(mediaGroups))
+	random.Shuffle(len(basenames), func(i, j int) {
+		basenames[i], basenames[j] = basenames[j], basenames[i]
+	})
+	sample := make(map[string]*FileGroup, n)
+	for _, basename := range basenames[:n] {
+		sample[basename] = mediaGroups[basename]
+	}
+	return sample
+}
+
+// checkSample renders the destinations of a random sample of the media files, without processing any files.
+// It reports the destinations, empty template fields, errors and destinations that several files of the sample would get.
+func (m *MediaSorter) checkSample(mediaGroups map[string]*FileGroup) error {
+	sample := selectSample(mediaGroups, m.Sample, rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64())))
+	groups := slices.Collect(maps.Values(sample))
+	slices.SortFunc(groups, func(a, b *FileGroup) int {
+		return strings.Compare(string(a.MediaFile), string(b.MediaFile))
+	})
+
+	sources := make(map[string][]string)
+	withEmptyFields, withErrors := 0, 0
+	for _, group := range groups {
+		dest, err := m.planDestination(group)
+		if err != nil {
+			m.OutputWriter.Warn(err.Error())
+			withErrors++
+			continue
+		}
+		m.OutputWriter.Print(fmt.Sprintf("%s -> %s", group.MediaFile, dest.destPath))
+		// The defaults fill the empty fields of the template metadata, so check the fields of the media file
+		empty, err := renderedEmptyFields(m.PathTemplate, dest.metadata.CleanForPaths(), dest.origName)
+		if err != nil {
+			m.OutputWriter.Warn(err.Error())
+			withErrors++
+			continue
+		}
+		if len(empty) > 0 {
+			m.OutputWriter.Warn(fmt.Sprintf("File %s has empty template fields: %s", group.MediaFile, strings.Join(empty, ", ")))
+			withEmptyFields++
+		}
+		sources[dest.destPath] = append(sources[dest.destPath], string(group.MediaFile))
+	}
+
+	collisions := 0
+	for _, destPath := range slices.Sorted(maps.Keys(sources)) {
+		if srcPaths := sources[destPath]; len(srcPaths) > 1 {
+			m.OutputWriter.Warn(fmt.Sprintf("Files %s would all be written to %s", strings.Join(srcPaths, ", "), destPath))
+			collisions++
+		}
+	}
+
+	m.OutputWriter.Print(fmt.Sprintf("Checked %d of %d media files: %d with empty template fields, %d with errors, %d destinations for more than one file. No files were processed",
+		len(groups), len(mediaGroups), withEmptyFields, withErrors, collisions))
+	return nil
+}
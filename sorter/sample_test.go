@@ -0,0 +1,64 @@
+package sorter
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSelectSample(t *testing.T) {
+	mediaGroups := make(map[string]*FileGroup)
+	for i := range 10 {
+		basename := fmt.Sprintf("track%d", i)
+		mediaGroups[basename] = &FileGroup{MediaFile: MediaFile(basename + ".mp3")}
+	}
+
+	sample := selectSample(mediaGroups, 3, rand.New(rand.NewPCG(1, 2)))
+	if len(sample) != 3 {
+		t.Errorf("Expected 3 files in the sample but got %d", len(sample))
+	}
+	for basename, group := range sample {
+		if mediaGroups[basename] != group {
+			t.Errorf("Expected sample to contain file groups of the media groups, got %s", basename)
+		}
+	}
+
+	sample = selectSample(mediaGroups, 20, rand.New(rand.NewPCG(1, 2)))
+	if len(sample) != 10 {
+		t.Errorf("Expected all 10 files in the sample but got %d", len(sample))
+	}
+}
+
+func TestRunChecksSampleWithoutProcessingFiles(t *testing.T) {
+	srcDir := writeCollidingFiles(t)
+	if err := os.WriteFile(filepath.Join(srcDir, "untitled.flac"), flacStream("ARTIST=Artist", "ALBUM=Album"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	templatePath := filepath.Join(t.TempDir(), "template.txt")
+	if err := os.WriteFile(templatePath, []byte("{{ .Artist }}/{{ .Album }}/{{ .Title }}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	destDir := filepath.Join(t.TempDir(), "sorted")
+	var output bytes.Buffer
+
+	mediaSorter, err := New(&Config{DestDir: destDir, Template: templatePath, Sample: 10, Verbosity: Quiet, Output: &output})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	if err := mediaSorter.Run(srcDir); err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+
+	if _, err := os.Stat(destDir); !os.IsNotExist(err) {
+		t.Errorf("Expected no files to be processed, got %v", err)
+	}
+	for _, expected := range []string{"would all be written to", "has empty template fields: Title", "Checked 3 of 3 media files: 1 with empty template fields, 0 with errors, 1 destinations for more than one file"} {
+		if !strings.Contains(output.String(), expected) {
+			t.Errorf("Expected output to contain '%s', got '%s'", expected, output.String())
+		}
+	}
+}
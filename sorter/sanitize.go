@@ -0,0 +1,140 @@
+package sorter
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// SanitizeLevel determines which characters and name lengths are allowed in generated file names,
+// depending on the file system of the destination
+type SanitizeLevel string
+
+const (
+	// Only remove path separators and control characters
+	MinimalSanitizing SanitizeLevel = "minimal"
+	// Characters that are safe in shells on Linux and macOS
+	PosixSanitizing SanitizeLevel = "posix"
+	// Characters that are safe on Windows, Linux and macOS
+	WindowsSanitizing SanitizeLevel = "windows"
+	// Characters and short names for FAT32 USB sticks and memory cards
+	FAT32Sanitizing SanitizeLevel = "fat32"
+)
+
+// DefaultSanitizeLevel creates file names that work on all common platforms
+const DefaultSanitizeLevel = WindowsSanitizing
+
+// Sanitizer cleans path segments generated from templates
+type Sanitizer struct {
+	// Characters that get replaced
+	forbiddenChars *regexp.Regexp
+	// Replace brackets and shell-awkward characters, and underscores with spaces
+	replaceSpecialChars bool
+	// Maximum length of a path segment in bytes
+	maxLength int
+	// Transliterate path segments to ASCII
+	asciiOnly bool
+	// Keep brackets instead of replacing them with dashes
+	keepBrackets bool
+	// Compose letters and combining marks to the NFC form of Unicode
+	normalizeUnicode bool
+}
+
+var sanitizers = map[SanitizeLevel]*Sanitizer{
+	MinimalSanitizing: {
+		forbiddenChars: regexp.MustCompile(`[/\x00-\x1F]`),
+		maxLength:      255,
+	},
+	PosixSanitizing: {
+		forbiddenChars:      regexp.MustCompile(`[/\\"'|?*\x00-\x1F]`),
+		replaceSpecialChars: true,
+		maxLength:           255,
+	},
+	WindowsSanitizing: {
+		forbiddenChars:      forbiddenCharPattern,
+		replaceSpecialChars: true,
+		maxLength:           255,
+	},
+	// FAT32 also forbids characters that are only invalid in 8.3 short names on some devices.
+	// Many devices limit the whole path to 260 characters, shorter segments keep nested paths below that.
+	FAT32Sanitizing: {
+		forbiddenChars:      regexp.MustCompile(`[<>:"'/\\|?*+,;=\x00-\x1F\x7F]`),
+		replaceSpecialChars: true,
+		maxLength:           80,
+	},
+}
+
+// SanitizeLevelNames returns the names of all sanitize levels, from least to most strict
+func SanitizeLevelNames() []string {
+	return []string{string(MinimalSanitizing), string(PosixSanitizing), string(WindowsSanitizing), string(FAT32Sanitizing)}
+}
+
+func ParseSanitizeLevel(level string) (SanitizeLevel, error) {
+	if _, ok := sanitizers[SanitizeLevel(level)]; ok {
+		return SanitizeLevel(level), nil
+	}
+	return "", fmt.Errorf("invalid sanitize level '%s', must be one of %s", level, strings.Join(SanitizeLevelNames(), ", "))
+}
+
+// FilesystemProfile names the file system of the destination, for choosing the sanitize level without knowing the rules
+type FilesystemProfile string
+
+const (
+	NTFSProfile  FilesystemProfile = "ntfs"
+	ExFATProfile FilesystemProfile = "exfat"
+	Ext4Profile  FilesystemProfile = "ext4"
+	// Names that work on every file system, including FAT32 devices
+	PortableProfile FilesystemProfile = "portable"
+)
+
+// filesystemProfiles maps the file system profiles to the sanitize levels with their rules.
+// NTFS and exFAT forbid the same characters and trailing dots and spaces, ext4 only forbids slashes and null bytes.
+var filesystemProfiles = map[FilesystemProfile]SanitizeLevel{
+	NTFSProfile:     WindowsSanitizing,
+	ExFATProfile:    WindowsSanitizing,
+	Ext4Profile:     MinimalSanitizing,
+	PortableProfile: FAT32Sanitizing,
+}
+
+// FilesystemProfileNames returns the names of all file system profiles
+func FilesystemProfileNames() []string {
+	return []string{string(NTFSProfile), string(ExFATProfile), string(Ext4Profile), string(PortableProfile)}
+}
+
+// ParseFilesystemProfile returns the sanitize level for the name of a file system profile
+func ParseFilesystemProfile(profile string) (SanitizeLevel, error) {
+	if level, ok := filesystemProfiles[FilesystemProfile(strings.ToLower(profile))]; ok {
+		return level, nil
+	}
+	return "", fmt.Errorf("invalid file system profile '%s', must be one of %s", profile, strings.Join(FilesystemProfileNames(), ", "))
+}
+
+// NewSanitizer returns a Sanitizer for a level and an output encoding.
+// An empty level means DefaultSanitizeLevel, an empty encoding means UTF8Encoding.
+func NewSanitizer(level SanitizeLevel, encoding OutputEncoding) (*Sanitizer, error) {
+	if level == "" {
+		level = DefaultSanitizeLevel
+	}
+	profile, ok := sanitizers[level]
+	if !ok {
+		_, err := ParseSanitizeLevel(string(level))
+		return nil, err
+	}
+	sanitizer := *profile
+	sanitizer.asciiOnly = encoding == ASCIIEncoding
+	return &sanitizer, nil
+}
+
+// truncate shortens the text to at most maxLength bytes, without splitting multibyte characters.
+// It trims the spaces, dots and dashes that the cut leaves at the end, like the cleanup does.
+func truncate(text string, maxLength int) string {
+	if len(text) <= maxLength {
+		return text
+	}
+	cut := maxLength
+	for cut > 0 && !utf8.RuneStart(text[cut]) {
+		cut--
+	}
+	return trimPathPattern.ReplaceAllString(text[:cut], "")
+}
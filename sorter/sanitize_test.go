@@ -0,0 +1,196 @@
+package sorter
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSanitizeLevels(t *testing.T) {
+	tests := []struct {
+		level    SanitizeLevel
+		input    string
+		expected string
+	}{
+		{MinimalSanitizing, "AC/DC: Live_Set (1991) & More?", "AC DC: Live_Set (1991) & More?"},
+		{PosixSanitizing, "AC/DC: Live_Set (1991) & More?", "AC DC: Live Set - 1991 - and More"},
+		{WindowsSanitizing, "AC/DC: Live_Set (1991) & More?", "AC DC Live Set - 1991 - and More"},
+		{FAT32Sanitizing, "Tom; Jerry + Friends, 1=2", "Tom Jerry Friends 1 2"},
+		{MinimalSanitizing, "..\\hidden", "\\hidden"},
+		{FAT32Sanitizing, strings.Repeat("a", 100), strings.Repeat("a", 80)},
+	}
+	for _, test := range tests {
+		t.Run(string(test.level), func(t *testing.T) {
+			result := sanitizers[test.level].cleanPathSegment(test.input)
+			if result != test.expected {
+				t.Errorf("Expected '%s' but got '%s'", test.expected, result)
+			}
+		})
+	}
+}
+
+func TestKeepBrackets(t *testing.T) {
+	tests := []struct {
+		keepBrackets bool
+		input        string
+		expected     string
+	}{
+		{false, "Song (Live)", "Song - Live"},
+		{true, "Song (Live)", "Song (Live)"},
+		{true, "[Album Title] {Remastered}", "[Album Title] {Remastered}"},
+		{true, "Song (Live): Tom & Jerry?", "Song (Live) Tom and Jerry"},
+	}
+	for _, test := range tests {
+		sanitizer, err := NewSanitizer(WindowsSanitizing, UTF8Encoding)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sanitizer.keepBrackets = test.keepBrackets
+		result := sanitizer.cleanPathSegment(test.input)
+		if result != test.expected {
+			t.Errorf("Expected '%s' but got '%s'", test.expected, result)
+		}
+	}
+}
+
+func TestMaxLengthKeepsValidUTF8(t *testing.T) {
+	// "ö" and "€" take two and three bytes, so some limits fall in the middle of a character
+	input := "Motörhead €uro Tour"
+	for maxLength := 1; maxLength <= len(input); maxLength++ {
+		sanitizer, err := NewSanitizer(MinimalSanitizing, UTF8Encoding)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sanitizer.maxLength = maxLength
+		result := sanitizer.cleanPathSegment(input)
+		if !utf8.ValidString(result) {
+			t.Errorf("Expected valid UTF-8 for max length %d but got '%q'", maxLength, result)
+		}
+		if len(result) > maxLength {
+			t.Errorf("Expected at most %d bytes but got '%s'", maxLength, result)
+		}
+		if !strings.HasPrefix(input, result) {
+			t.Errorf("Expected '%s' to start with '%s'", input, result)
+		}
+	}
+}
+
+func TestParseSanitizeLevel(t *testing.T) {
+	for _, name := range SanitizeLevelNames() {
+		if _, err := ParseSanitizeLevel(name); err != nil {
+			t.Errorf("Expected level '%s' to be valid: %v", name, err)
+		}
+	}
+	if _, err := ParseSanitizeLevel("ntfs"); err == nil {
+		t.Error("Expected error for unknown level")
+	}
+}
+
+func TestFilesystemProfiles(t *testing.T) {
+	tests := []struct {
+		profile  string
+		input    string
+		expected string
+	}{
+		{"ntfs", "Live: Part 1?", "Live Part 1"},
+		{"exfat", "Live: Part 1?", "Live Part 1"},
+		{"ext4", "Live: Part 1?", "Live: Part 1?"},
+		{"EXT4", "AC/DC", "AC DC"},
+		{"portable", "Tom; Jerry: 1=2", "Tom Jerry 1 2"},
+	}
+	for _, test := range tests {
+		t.Run(test.profile, func(t *testing.T) {
+			level, err := ParseFilesystemProfile(test.profile)
+			if err != nil {
+				t.Fatalf("ParseFilesystemProfile returned error: %v", err)
+			}
+			sanitizer, err := NewSanitizer(level, UTF8Encoding)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result := sanitizer.cleanPathSegment(test.input); result != test.expected {
+				t.Errorf("Expected '%s' but got '%s'", test.expected, result)
+			}
+		})
+	}
+	if _, err := ParseFilesystemProfile("windows"); err == nil {
+		t.Error("Expected error for unknown profile")
+	}
+}
+
+func TestTruncateKeepsMultibyteCharacters(t *testing.T) {
+	actual := truncate("Ünïcödé", 4)
+	if actual != "Ün" {
+		t.Errorf("Expected 'Ün' but got '%s'", actual)
+	}
+}
+
+func TestTruncateTrimsEndOfCut(t *testing.T) {
+	tests := []struct {
+		text      string
+		maxLength int
+		expected  string
+	}{
+		{"Title - Live", 8, "Title"},
+		{"Vol. 2", 5, "Vol"},
+		{"Title - Live", 20, "Title - Live"},
+	}
+	for _, test := range tests {
+		if actual := truncate(test.text, test.maxLength); actual != test.expected {
+			t.Errorf("truncate(%q, %d) = %q; want %q", test.text, test.maxLength, actual, test.expected)
+		}
+	}
+}
+
+func TestRunKeepsRoomForExtensions(t *testing.T) {
+	srcDir := t.TempDir()
+	writeSourceFiles(t, srcDir, map[string][]byte{
+		"track.flac": flacStream("TITLE=Hello World", "ARTIST=Artist", "ALBUM=Album"),
+		"track.cue":  []byte("cue sheet"),
+	})
+	templatePath := filepath.Join(t.TempDir(), "template.txt")
+	if err := os.WriteFile(templatePath, []byte("{{ .Artist }}/{{ .Album }}/{{ .Title }}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	destDir := filepath.Join(t.TempDir(), "sorted")
+
+	mediaSorter, err := New(&Config{DestDir: destDir, Template: templatePath, MaxSegmentLength: 11, Output: io.Discard})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	if err := mediaSorter.Run(srcDir); err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+
+	// "Hello World.flac" is 16 bytes, the name gets 6 bytes and loses the space at the end of the cut
+	for _, name := range []string{"Hello.flac", "Hello.cue"} {
+		if _, err := os.Stat(filepath.Join(destDir, "Artist", "Album", name)); err != nil {
+			t.Errorf("Expected shortened file name: %v", err)
+		}
+	}
+}
+
+func TestRunShortensPathSegmentsToMaxSegmentLength(t *testing.T) {
+	srcDir := t.TempDir()
+	destDir := filepath.Join(t.TempDir(), "sorted")
+	content := flacStream("TITLE=Title", "ARTIST=Motörhead", "ALBUM=Album", "TRACKNUMBER=3")
+	if err := os.WriteFile(filepath.Join(srcDir, "track.flac"), content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	mediaSorter, err := New(&Config{DestDir: destDir, MaxSegmentLength: 5, Output: io.Discard})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	if err := mediaSorter.Run(srcDir); err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+
+	// "Motör" would be 6 bytes, so the name ends before the "r"
+	if _, err := os.Stat(filepath.Join(destDir, "Motö", "Album")); err != nil {
+		t.Errorf("Expected shortened artist directory: %v", err)
+	}
+}
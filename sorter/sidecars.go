@@ -0,0 +1,186 @@
+package sorter
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/dhowden/tag"
+)
+
+// Suffixes that file managers and download tools add to duplicate file names, like "track (1)" or "track - Copy"
+var copySuffixPattern = regexp.MustCompile(`(?i)(\s*\(\d+\)|[\s_-]+copy)+$`)
+
+// fuzzySidecarKey normalizes a path without suffix for comparing it with other paths in the same directory.
+// The key is the directory and the lowercase letters and digits of the file name, without copy suffixes.
+func fuzzySidecarKey(basename string) string {
+	name := copySuffixPattern.ReplaceAllString(filepath.Base(basename), "")
+	var key strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			key.WriteRune(r)
+		}
+	}
+	if key.Len() == 0 {
+		return ""
+	}
+	return filepath.Join(filepath.Dir(basename), key.String())
+}
+
+// associateFuzzySidecars adds the files of non-media groups as sidecar files to the media group with a similar name.
+// To avoid grabbing unrelated files, it only associates files when there is exactly one media group with the same key.
+// Associated groups are removed from nonMediaGroups.
+func (m *MediaSorter) associateFuzzySidecars(mediaGroups map[string]*FileGroup, nonMediaGroups map[string][]string) {
+	mediaKeys := make(map[string][]*FileGroup)
+	for basename, group := range mediaGroups {
+		key := fuzzySidecarKey(basename)
+		if key != "" {
+			mediaKeys[key] = append(mediaKeys[key], group)
+		}
+	}
+
+	for basename, files := range nonMediaGroups {
+		candidates := mediaKeys[fuzzySidecarKey(basename)]
+		if len(candidates) != 1 {
+			continue
+		}
+		group := candidates[0]
+		for _, file := range files {
+			m.OutputWriter.Info(fmt.Sprintf("Using %s as sidecar file for %s", file, group.MediaFile))
+		}
+		group.SidecarFiles = append(group.SidecarFiles, files...)
+		delete(nonMediaGroups, basename)
+	}
+}
+
+// SidecarAction determines what happens with a sidecar file
+type SidecarAction string
+
+const (
+	CopySidecar  SidecarAction = "copy"
+	SkipSidecar  SidecarAction = "skip"
+	EmbedSidecar SidecarAction = "embed"
+)
+
+// Wildcard for sidecar policy rules that apply to all file types
+const anyFileType = "*"
+
+// SidecarPolicy maps file types of media files and extensions of sidecar files to actions.
+// Rules for a specific file type take precedence over rules for all file types.
+type SidecarPolicy map[string]map[string]SidecarAction
+
+// ParseSidecarPolicy parses rules in the form "FILETYPE:EXTENSION=ACTION", e.g. "mp3:lrc=embed" or "*:nfo=skip"
+func ParseSidecarPolicy(rules []string) (SidecarPolicy, error) {
+	policy := make(SidecarPolicy)
+	for _, rule := range rules {
+		selector, action, found := strings.Cut(rule, "=")
+		fileType, ext, hasExt := strings.Cut(selector, ":")
+		if !found || !hasExt || fileType == "" || ext == "" {
+			return nil, fmt.Errorf("invalid sidecar policy '%s', must have the form FILETYPE:EXTENSION=ACTION", rule)
+		}
+		switch SidecarAction(action) {
+		case CopySidecar, SkipSidecar, EmbedSidecar:
+		default:
+			return nil, fmt.Errorf("invalid sidecar action '%s' in '%s', must be one of %s, %s or %s", action, rule, CopySidecar, SkipSidecar, EmbedSidecar)
+		}
+		fileType = strings.ToUpper(fileType)
+		if policy[fileType] == nil {
+			policy[fileType] = make(map[string]SidecarAction)
+		}
+		policy[fileType][normalizeExtension(ext)] = SidecarAction(action)
+	}
+	return policy, nil
+}
+
+// Action returns the action for a sidecar file of a media file, copying is the default
+func (p SidecarPolicy) Action(fileType string, sidecarPath string) SidecarAction {
+	ext := normalizeExtension(filepath.Ext(sidecarPath))
+	if action, exists := p[strings.ToUpper(fileType)][ext]; exists {
+		return action
+	}
+	if action, exists := p[anyFileType][ext]; exists {
+		return action
+	}
+	return CopySidecar
+}
+
+// embeddedSidecarTags maps the extensions of text sidecar files that can be embedded to the tag for their content
+var embeddedSidecarTags = map[string]string{
+	"lrc": "LYRICS",
+}
+
+// SidecarEmbedder writes the content of a sidecar file into the tags of a media file
+type SidecarEmbedder func(sidecarPath string, fileType tag.FileType, destPath string) error
+
+func DryRunSidecarEmbedder(sidecarPath string, fileType tag.FileType, destPath string) error {
+	return checkSidecarEmbeddable(sidecarPath, fileType)
+}
+
+// EmbedSidecarTag writes the content of a text sidecar file into a tag of FLAC and MP3 files, e.g. .lrc files
+// into the LYRICS tag. For other sidecar files and file types, it returns an error that matches ErrTagWritingNotSupported.
+func EmbedSidecarTag(sidecarPath string, fileType tag.FileType, destPath string) error {
+	if err := checkSidecarEmbeddable(sidecarPath, fileType); err != nil {
+		return err
+	}
+	content, err := os.ReadFile(sidecarPath)
+	if err != nil {
+		return fmt.Errorf("error reading sidecar file %s: %w", sidecarPath, err)
+	}
+	text := strings.TrimPrefix(string(content), "\ufeff")
+	return writeTextTag(destPath, fileType, embeddedSidecarTags[normalizeExtension(filepath.Ext(sidecarPath))], text)
+}
+
+// checkSidecarEmbeddable returns an error that matches ErrTagWritingNotSupported if the sidecar file can't be embedded
+func checkSidecarEmbeddable(sidecarPath string, fileType tag.FileType) error {
+	ext := normalizeExtension(filepath.Ext(sidecarPath))
+	if _, exists := embeddedSidecarTags[ext]; !exists {
+		return fmt.Errorf("%w for .%s files", ErrTagWritingNotSupported, ext)
+	}
+	if fileType != tag.FLAC && fileType != tag.MP3 {
+		return fmt.Errorf("%w for %s files", ErrTagWritingNotSupported, fileType)
+	}
+	return nil
+}
+
+// embedSidecar writes the sidecar file into the tags of the processed media file.
+// It returns false when the sidecar file can't be embedded, so it gets copied instead.
+func (m *MediaSorter) embedSidecar(sidecarFile string, dest *destination) (bool, error) {
+	err := m.SidecarEmbedder(sidecarFile, dest.metadata.FileType, dest.destPath)
+	if errors.Is(err, ErrTagWritingNotSupported) {
+		m.OutputWriter.Warn(fmt.Sprintf("Could not embed %s into %s, copying it instead: %v", sidecarFile, dest.destPath, err))
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	m.OutputWriter.Info(fmt.Sprintf("Embedded sidecar file %s into %s", sidecarFile, dest.destPath))
+	return true, nil
+}
+
+// sidecarAllowed checks if the extension of the sidecar file is one of the SidecarExtensions
+func (m *MediaSorter) sidecarAllowed(sidecarPath string) bool {
+	return len(m.SidecarExtensions) == 0 || slices.Contains(m.SidecarExtensions, normalizeExtension(filepath.Ext(sidecarPath)))
+}
+
+func normalizeExtension(ext string) string {
+	return strings.ToLower(strings.TrimPrefix(ext, "."))
+}
+
+var imageExtensions = map[string]struct{}{
+	"jpg":  {},
+	"jpeg": {},
+	"png":  {},
+	"gif":  {},
+	"webp": {},
+	"bmp":  {},
+}
+
+func isImageFile(path string) bool {
+	_, isImage := imageExtensions[normalizeExtension(filepath.Ext(path))]
+	return isImage
+}
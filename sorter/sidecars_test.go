@@ -0,0 +1,244 @@
+package sorter
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFuzzySidecarKey(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"music/track", "music/track"},
+		{"music/Track (1)", "music/track"},
+		{"music/track (1) (2)", "music/track"},
+		{"music/track - Copy", "music/track"},
+		{"music/track_copy", "music/track"},
+		{"music/01. Some Track", "music/01sometrack"},
+		{"music/01 - Some_Track", "music/01sometrack"},
+		{"music/track 2", "music/track2"},
+		{"music/(1)", ""},
+	}
+	for _, test := range tests {
+		result := fuzzySidecarKey(test.input)
+		if result != test.expected {
+			t.Errorf("fuzzySidecarKey(%q) = %q; want %q", test.input, result, test.expected)
+		}
+	}
+}
+
+func TestAssociateFuzzySidecars(t *testing.T) {
+	sorter := &MediaSorter{OutputWriter: &OutputWriter{Verbosity: Quiet, Writer: io.Discard}}
+	track := &FileGroup{MediaFile: "music/track.flac"}
+	ambiguous1 := &FileGroup{MediaFile: "music/other.flac"}
+	ambiguous2 := &FileGroup{MediaFile: "music/Other.mp3"}
+	mediaGroups := map[string]*FileGroup{
+		"music/track": track,
+		"music/other": ambiguous1,
+		"music/Other": ambiguous2,
+	}
+	nonMediaGroups := map[string][]string{
+		"music/track (1)":   {"music/track (1).lrc"},
+		"other/track (1)":   {"other/track (1).lrc"},
+		"music/other (1)":   {"music/other (1).lrc"},
+		"music/unrelated":   {"music/unrelated.txt"},
+		"music/track - sub": {"music/track - sub.txt"},
+	}
+
+	sorter.associateFuzzySidecars(mediaGroups, nonMediaGroups)
+
+	if !reflect.DeepEqual(track.SidecarFiles, []string{"music/track (1).lrc"}) {
+		t.Errorf("Expected sidecar file for track, got %v", track.SidecarFiles)
+	}
+	if len(ambiguous1.SidecarFiles) > 0 || len(ambiguous2.SidecarFiles) > 0 {
+		t.Errorf("Expected no sidecar files for ambiguous matches, got %v and %v", ambiguous1.SidecarFiles, ambiguous2.SidecarFiles)
+	}
+	if len(nonMediaGroups) != 4 {
+		t.Errorf("Expected 4 remaining non-media groups, got %v", nonMediaGroups)
+	}
+}
+
+func TestSidecarPolicy(t *testing.T) {
+	policy, err := ParseSidecarPolicy([]string{"mp3:lrc=embed", "flac:.LRC=copy", "*:lrc=skip", "*:nfo=skip"})
+	if err != nil {
+		t.Fatalf("ParseSidecarPolicy returned error: %v", err)
+	}
+
+	tests := []struct {
+		fileType    string
+		sidecarPath string
+		expected    SidecarAction
+	}{
+		{"MP3", "music/track.lrc", EmbedSidecar},
+		{"FLAC", "music/track.lrc", CopySidecar},
+		{"OGG", "music/track.lrc", SkipSidecar},
+		{"MP3", "music/track.NFO", SkipSidecar},
+		{"MP3", "music/track.jpg", CopySidecar},
+	}
+	for _, test := range tests {
+		actual := policy.Action(test.fileType, test.sidecarPath)
+		if actual != test.expected {
+			t.Errorf("Action(%q, %q) = %q; want %q", test.fileType, test.sidecarPath, actual, test.expected)
+		}
+	}
+}
+
+func TestEmptySidecarPolicyCopies(t *testing.T) {
+	var policy SidecarPolicy
+	if action := policy.Action("MP3", "track.lrc"); action != CopySidecar {
+		t.Errorf("Expected copy action, got %q", action)
+	}
+}
+
+func TestParseSidecarPolicyRejectsInvalidRules(t *testing.T) {
+	for _, rule := range []string{"lrc=skip", "mp3:lrc", "mp3:lrc=delete", ":lrc=skip", "mp3:=skip"} {
+		if _, err := ParseSidecarPolicy([]string{rule}); err == nil {
+			t.Errorf("Expected error for rule %q", rule)
+		}
+	}
+}
+
+func TestIsImageFile(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"music/cover.jpg", true},
+		{"music/track.JPEG", true},
+		{"music/folder.png", true},
+		{"music/track.lrc", false},
+		{"music/jpg", false},
+	}
+	for _, test := range tests {
+		if result := isImageFile(test.input); result != test.expected {
+			t.Errorf("isImageFile(%q) = %v; want %v", test.input, result, test.expected)
+		}
+	}
+}
+
+func TestDryRunShowsSidecarFiles(t *testing.T) {
+	srcDir := t.TempDir()
+	files := map[string][]byte{
+		"track.flac": flacStream("TITLE=Title", "ARTIST=Artist", "ALBUM=Album"),
+		"track.cue":  []byte("cue sheet"),
+		"track.log":  []byte("rip log"),
+	}
+	writeSourceFiles(t, srcDir, files)
+	destDir := filepath.Join(t.TempDir(), "sorted")
+	var output bytes.Buffer
+
+	mediaSorter, err := New(&Config{DestDir: destDir, DryRun: true, Output: &output})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	if err := mediaSorter.Run(srcDir); err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+
+	albumDir := filepath.Join(destDir, "Artist", "Album")
+	expectedMessages := []string{
+		fmt.Sprintf("Processing file %s -> %s", filepath.Join(srcDir, "track.flac"), filepath.Join(albumDir, "Title.flac")),
+		fmt.Sprintf("Processing sidecar file %s -> %s", filepath.Join(srcDir, "track.cue"), filepath.Join(albumDir, "Title.cue")),
+		fmt.Sprintf("Processing sidecar file %s -> %s", filepath.Join(srcDir, "track.log"), filepath.Join(albumDir, "Title.log")),
+	}
+	for _, message := range expectedMessages {
+		if !strings.Contains(output.String(), message) {
+			t.Errorf("Expected output to contain '%s' but got '%s'", message, output.String())
+		}
+	}
+	if _, err := os.Stat(destDir); !os.IsNotExist(err) {
+		t.Errorf("Expected dry run not to create the destination, got %v", err)
+	}
+}
+
+func TestRunProcessesOnlyAllowedSidecarExtensions(t *testing.T) {
+	srcDir := t.TempDir()
+	files := map[string][]byte{
+		"track.flac": flacStream("TITLE=Title", "ARTIST=Artist", "ALBUM=Album"),
+		"track.cue":  []byte("cue sheet"),
+		"track.LOG":  []byte("rip log"),
+		"track.nfo":  []byte("release info"),
+		"track.m3u":  []byte("playlist"),
+	}
+	writeSourceFiles(t, srcDir, files)
+	destDir := filepath.Join(t.TempDir(), "sorted")
+	var output bytes.Buffer
+
+	mediaSorter, err := New(&Config{DestDir: destDir, SidecarExtensions: []string{"cue", ".log"}, Verbosity: Verbose, Output: &output})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	if err := mediaSorter.Run(srcDir); err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+
+	albumDir := filepath.Join(destDir, "Artist", "Album")
+	for _, name := range []string{"Title.flac", "Title.cue", "Title.LOG"} {
+		if _, err := os.Stat(filepath.Join(albumDir, name)); err != nil {
+			t.Errorf("Expected file %s: %v", name, err)
+		}
+	}
+	for _, name := range []string{"track.nfo", "track.m3u"} {
+		ext := filepath.Ext(name)
+		if _, err := os.Stat(filepath.Join(albumDir, "Title"+ext)); !os.IsNotExist(err) {
+			t.Errorf("Expected sidecar file %s to be skipped, got %v", name, err)
+		}
+		message := fmt.Sprintf("Skipping sidecar file %s, its extension is not one of the sidecar extensions", filepath.Join(srcDir, name))
+		if !strings.Contains(output.String(), message) {
+			t.Errorf("Expected output to contain '%s' but got '%s'", message, output.String())
+		}
+	}
+}
+
+func TestRunEmbedsSidecarFiles(t *testing.T) {
+	srcDir := t.TempDir()
+	writeSourceFiles(t, srcDir, map[string][]byte{
+		"track.flac": flacStream("TITLE=Title", "ARTIST=Artist", "ALBUM=Album"),
+		"track.lrc":  []byte("\ufeff[00:01.00]Hello world"),
+		"track.nfo":  []byte("info"),
+	})
+	templatePath := filepath.Join(t.TempDir(), "template.txt")
+	if err := os.WriteFile(templatePath, []byte("{{ .Artist }}/{{ .Album }}/{{ .Title }}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	policy, err := ParseSidecarPolicy([]string{"flac:lrc=embed", "flac:nfo=embed"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	destDir := filepath.Join(t.TempDir(), "sorted")
+
+	mediaSorter, err := New(&Config{DestDir: destDir, Template: templatePath, SidecarPolicy: policy, Verbosity: Quiet, Output: io.Discard, ErrOutput: io.Discard})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	if err := mediaSorter.Run(srcDir); err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+
+	albumDir := filepath.Join(destDir, "Artist", "Album")
+	file, err := os.Open(filepath.Join(albumDir, "Title.flac"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	rawMetadata, err := readTags(file)
+	if err != nil {
+		t.Fatalf("readTags returned error: %v", err)
+	}
+	if lyrics := readLyrics(rawMetadata); lyrics != "[00:01.00]Hello world" {
+		t.Errorf("Expected embedded lyrics, got %q", lyrics)
+	}
+	if _, err := os.Stat(filepath.Join(albumDir, "Title.lrc")); !os.IsNotExist(err) {
+		t.Errorf("Expected no copied lyrics file, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(albumDir, "Title.nfo")); err != nil {
+		t.Errorf("Expected sidecar file that can't be embedded to be copied: %v", err)
+	}
+}
@@ -0,0 +1,190 @@
+package sorter
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Sentinel errors for the reasons why a file was skipped.
+// The errors that Sort and ProcessFileGroup return for skipped files match them with errors.Is.
+var (
+	ErrNoTags        = errors.New("no tags found")
+	ErrNotAMediaFile = errors.New("not a media file")
+	ErrMissingField  = errors.New("template field is empty")
+	ErrFilteredOut   = errors.New("file was filtered out")
+	ErrCollision     = errors.New("destination file already exists")
+	ErrLocked        = errors.New("file is locked by another program")
+	ErrAlreadySorted = errors.New("file has the marker of sorted files")
+	ErrPathTooLong   = errors.New("destination path is too long")
+)
+
+// ErrTemplate matches the errors of templates that can't render the path of a file.
+// They are not a reason for skipping a file, they stop the run like other errors.
+var ErrTemplate = errors.New("template error")
+
+// SkipReason is a short name for the reason why a file was skipped, for grouping files in reports
+type SkipReason string
+
+const (
+	SkipNoTags        SkipReason = "no-tags"
+	SkipNotAMediaFile SkipReason = "not-a-media-file"
+	SkipMissingField  SkipReason = "missing-required-field"
+	SkipFilteredOut   SkipReason = "filtered-out"
+	SkipCollision     SkipReason = "collision"
+	SkipLocked        SkipReason = "locked"
+	SkipAlreadySorted SkipReason = "already-sorted"
+	SkipPathTooLong   SkipReason = "path-too-long"
+)
+
+var skipReasons = []struct {
+	err    error
+	reason SkipReason
+}{
+	{ErrNoTags, SkipNoTags},
+	{ErrNotAMediaFile, SkipNotAMediaFile},
+	{ErrMissingField, SkipMissingField},
+	{ErrFilteredOut, SkipFilteredOut},
+	{ErrCollision, SkipCollision},
+	{ErrLocked, SkipLocked},
+	{ErrAlreadySorted, SkipAlreadySorted},
+	{ErrPathTooLong, SkipPathTooLong},
+}
+
+// SkipReasonOf returns the reason for skipping a file, and false if the error does not skip a file
+func SkipReasonOf(err error) (SkipReason, bool) {
+	if err == nil {
+		return "", false
+	}
+	for _, skip := range skipReasons {
+		if errors.Is(err, skip.err) {
+			return skip.reason, true
+		}
+	}
+	return "", false
+}
+
+type NoTagsError struct {
+	srcPath string
+	err     error
+}
+
+func (err *NoTagsError) Error() string {
+	return fmt.Sprintf("No tags found in file %s, skipping", err.srcPath)
+}
+
+func (err *NoTagsError) Unwrap() error {
+	return err.err
+}
+
+func (err *NoTagsError) Is(target error) bool {
+	return target == ErrNoTags
+}
+
+type TemplateError struct {
+	srcPath string
+	err     error
+}
+
+func (err *TemplateError) Error() string {
+	return fmt.Sprintf("Could not create destination path for file %s: %v", err.srcPath, err.err)
+}
+
+func (err *TemplateError) Unwrap() error {
+	return err.err
+}
+
+func (err *TemplateError) Is(target error) bool {
+	return target == ErrTemplate
+}
+
+// SkippedFilesError reports the number of skipped files for each reason, when skipped files count as errors
+type SkippedFilesError struct {
+	counts map[SkipReason]int
+}
+
+func (err *SkippedFilesError) Error() string {
+	total := 0
+	var reasons []string
+	for _, skip := range skipReasons {
+		if count := err.counts[skip.reason]; count > 0 {
+			total += count
+			reasons = append(reasons, fmt.Sprintf("%d %s", count, skip.reason))
+		}
+	}
+	return fmt.Sprintf("skipped %d files (%s)", total, strings.Join(reasons, ", "))
+}
+
+// skipFile shows the reason for skipping a file, counts it and writes it to the manifest.
+// Files that don't match the filters are skipped on purpose, so they are only shown in verbose mode and not counted,
+// unless SkipsAsErrors reports all skipped files.
+func (m *MediaSorter) skipFile(srcPath string, err error) {
+	filteredOut := errors.Is(err, ErrFilteredOut) && !m.SkipsAsErrors
+	if filteredOut {
+		m.OutputWriter.Info(err.Error())
+	} else if m.SummarizeSkips && errors.Is(err, ErrNoTags) {
+		m.listSkippedFiles(SkipNoTags, srcPath)
+	} else {
+		m.OutputWriter.Warn(err.Error())
+	}
+	if m.Manifest != nil {
+		record := ManifestRecord{Action: "skip", Source: srcPath, Error: err.Error()}
+		record.setMetadata(m.plannedMetadata(srcPath))
+		var existsErr *FileExistsError
+		var tooLongErr *PathTooLongError
+		if errors.As(err, &existsErr) {
+			record.Destination = existsErr.destPath
+		} else if errors.As(err, &tooLongErr) {
+			record.Destination = tooLongErr.destPath
+		}
+		if manifestErr := m.Manifest.WriteRecord(record); manifestErr != nil {
+			m.OutputWriter.Warn(fmt.Sprintf("error writing manifest: %v", manifestErr))
+		}
+	}
+	if filteredOut {
+		return
+	}
+	reason, _ := SkipReasonOf(err)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.skipped == nil {
+		m.skipped = make(map[SkipReason]int)
+	}
+	m.skipped[reason]++
+}
+
+// skippedFileHeadings are the headings of the lists of skipped files at the end of the run, in the order of the lists
+var skippedFileHeadings = []struct {
+	reason  SkipReason
+	heading string
+}{
+	{SkipNoTags, "Skipped files without tags"},
+	{SkipNotAMediaFile, "Skipped files that are not media files"},
+}
+
+// listSkippedFiles adds files to the list of skipped files that printSkippedFiles shows at the end of the run
+func (m *MediaSorter) listSkippedFiles(reason SkipReason, files ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.skippedFiles == nil {
+		m.skippedFiles = make(map[SkipReason][]string)
+	}
+	m.skippedFiles[reason] = append(m.skippedFiles[reason], files...)
+}
+
+// printSkippedFiles shows the listed skipped files as one warning, grouped by reason
+func (m *MediaSorter) printSkippedFiles() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var groups []string
+	for _, skip := range skippedFileHeadings {
+		files := slices.Sorted(slices.Values(m.skippedFiles[skip.reason]))
+		if len(files) > 0 {
+			groups = append(groups, fmt.Sprintf("%s (%d):\n  %s", skip.heading, len(files), strings.Join(files, "\n  ")))
+		}
+	}
+	if len(groups) > 0 {
+		m.OutputWriter.Warn(strings.Join(groups, "\n"))
+	}
+}
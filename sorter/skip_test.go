@@ -0,0 +1,187 @@
+package sorter
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dhowden/tag"
+)
+
+func TestSkipReasonOf(t *testing.T) {
+	tests := []struct {
+		description string
+		err         error
+		expected    SkipReason
+		skipped     bool
+	}{
+		{"no error", nil, "", false},
+		{"other error", errors.New("disk full"), "", false},
+		{"no tags", &NoTagsError{srcPath: "a.mp3", err: tag.ErrNoTagsFound}, SkipNoTags, true},
+		{"not a media file", &NotAMediaFileError{srcPath: "a.txt"}, SkipNotAMediaFile, true},
+		{"empty field", &EmptyFieldError{srcPath: "a.mp3", fields: []string{"Album"}}, SkipMissingField, true},
+		{"template error", &TemplateError{srcPath: "a.mp3", err: errors.New("bad function")}, "", false},
+		{"collision", &FileExistsError{srcPath: "a.mp3", destPath: "b.mp3"}, SkipCollision, true},
+		{"locked file", &FileLockedError{srcPath: "a.mp3", err: errors.New("sharing violation")}, SkipLocked, true},
+		{"already sorted", &MarkedFileError{srcPath: "a.mp3", marker: "v1"}, SkipAlreadySorted, true},
+		{"wrapped error", fmt.Errorf("processing: %w", &FileExistsError{}), SkipCollision, true},
+		{"sentinel", ErrFilteredOut, SkipFilteredOut, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			reason, skipped := SkipReasonOf(test.err)
+			if reason != test.expected || skipped != test.skipped {
+				t.Errorf("SkipReasonOf(%v) = %q, %t; want %q, %t", test.err, reason, skipped, test.expected, test.skipped)
+			}
+		})
+	}
+}
+
+func TestNoTagsErrorUnwrapsTagError(t *testing.T) {
+	err := &NoTagsError{srcPath: "a.mp3", err: tag.ErrNoTagsFound}
+	if !errors.Is(err, tag.ErrNoTagsFound) {
+		t.Error("Expected NoTagsError to match tag.ErrNoTagsFound")
+	}
+}
+
+func TestRunReportsSkipsAsErrors(t *testing.T) {
+	srcDir := writeCollidingFiles(t)
+	destDir := filepath.Join(t.TempDir(), "sorted")
+
+	mediaSorter, err := New(&Config{DestDir: destDir, OnExists: SkipExisting, ReportSkipsAsErrors: true, Output: io.Discard})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	err = mediaSorter.Run(srcDir)
+	var skippedErr *SkippedFilesError
+	if !errors.As(err, &skippedErr) {
+		t.Fatalf("Expected SkippedFilesError but got %v", err)
+	}
+	if err.Error() != "skipped 1 files (1 collision)" {
+		t.Errorf("Expected 'skipped 1 files (1 collision)' but got '%s'", err.Error())
+	}
+	if _, err := os.Stat(filepath.Join(destDir, "Artist", "Album", "Title.flac")); err != nil {
+		t.Errorf("Expected the run to complete: %v", err)
+	}
+}
+
+func TestRunSkipsMarkedFiles(t *testing.T) {
+	srcDir := t.TempDir()
+	files := map[string][]byte{
+		"marked.flac":   flacStream("TITLE=Marked", "ARTIST=Artist", "ALBUM=Album", "MEDIASORTER=v1"),
+		"outdated.flac": flacStream("TITLE=Outdated", "ARTIST=Artist", "ALBUM=Album", "MEDIASORTER=v0"),
+		"new.flac":      flacStream("TITLE=New", "ARTIST=Artist", "ALBUM=Album"),
+	}
+	writeSourceFiles(t, srcDir, files)
+	destDir := filepath.Join(t.TempDir(), "sorted")
+
+	mediaSorter, err := New(&Config{DestDir: destDir, SkipMarker: "v1", ReportSkipsAsErrors: true, Output: io.Discard})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	err = mediaSorter.Run(srcDir)
+	if err == nil || err.Error() != "skipped 1 files (1 already-sorted)" {
+		t.Errorf("Expected 'skipped 1 files (1 already-sorted)' but got %v", err)
+	}
+
+	expected := map[string]bool{"Marked.flac": false, "Outdated.flac": true, "New.flac": true}
+	for name, exists := range expected {
+		_, err := os.Stat(filepath.Join(destDir, "Artist", "Album", name))
+		if exists && err != nil {
+			t.Errorf("Expected sorted file %s: %v", name, err)
+		}
+		if !exists && !os.IsNotExist(err) {
+			t.Errorf("Expected marked file %s to be skipped, got %v", name, err)
+		}
+	}
+}
+
+func TestRunSummarizesSkippedFiles(t *testing.T) {
+	srcDir := t.TempDir()
+	files := map[string][]byte{
+		"one.flac":      flacStream("TITLE=One", "ARTIST=Artist", "ALBUM=Album"),
+		"notes.txt":     []byte("notes"),
+		"playlist.m3u":  []byte("one.flac"),
+		"playlist.m3u8": []byte("one.flac"),
+	}
+	writeSourceFiles(t, srcDir, files)
+
+	var output bytes.Buffer
+	var errOutput bytes.Buffer
+	mediaSorter, err := New(&Config{DestDir: t.TempDir(), SummarizeSkips: true, Summary: true, Verbosity: Quiet, Output: &output, ErrOutput: &errOutput})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	if err := mediaSorter.Run(srcDir); err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+
+	expected := fmt.Sprintf("Skipped files that are not media files (3):\n  %s\n  %s\n  %s\n",
+		filepath.Join(srcDir, "notes.txt"), filepath.Join(srcDir, "playlist.m3u"), filepath.Join(srcDir, "playlist.m3u8"))
+	if errOutput.String() != expected {
+		t.Errorf("Expected warnings '%s' but got '%s'", expected, errOutput.String())
+	}
+	if summary := "Summary: 1 files processed, 0 skipped, 3 non-media, 0 errors"; !strings.HasPrefix(output.String(), summary) {
+		t.Errorf("Expected output starting with '%s' but got '%s'", summary, output.String())
+	}
+}
+
+func TestSummarizeSkipsListsFilesWithoutTags(t *testing.T) {
+	var errOutput bytes.Buffer
+	mediaSorter, err := New(&Config{DestDir: t.TempDir(), SummarizeSkips: true, Output: io.Discard, ErrOutput: &errOutput})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	mediaSorter.skipFile("b.mp3", &NoTagsError{srcPath: "b.mp3", err: tag.ErrNoTagsFound})
+	mediaSorter.skipFile("a.mp3", &NoTagsError{srcPath: "a.mp3", err: tag.ErrNoTagsFound})
+	mediaSorter.listSkippedFiles(SkipNotAMediaFile, "notes.txt")
+	if errOutput.Len() > 0 {
+		t.Errorf("Expected no warnings before the end of the run, got '%s'", errOutput.String())
+	}
+
+	mediaSorter.printSkippedFiles()
+	expected := "Skipped files without tags (2):\n  a.mp3\n  b.mp3\nSkipped files that are not media files (1):\n  notes.txt\n"
+	if errOutput.String() != expected {
+		t.Errorf("Expected warnings '%s' but got '%s'", expected, errOutput.String())
+	}
+	if mediaSorter.skipped[SkipNoTags] != 2 {
+		t.Errorf("Expected 2 skipped files without tags, got %d", mediaSorter.skipped[SkipNoTags])
+	}
+}
+
+func TestRunStopsAtTemplateErrors(t *testing.T) {
+	for _, keepUnsorted := range []bool{false, true} {
+		t.Run(fmt.Sprintf("keep unsorted %t", keepUnsorted), func(t *testing.T) {
+			srcDir := t.TempDir()
+			writeSourceFiles(t, srcDir, map[string][]byte{
+				"broken.flac": flacStream("TITLE=Title", "ARTIST=Artist", "ALBUM=Album", "GENRE=Broken"),
+			})
+			templatePath := filepath.Join(t.TempDir(), "template.txt")
+			if err := os.WriteFile(templatePath, []byte(`{{ if eq .Genre "Broken" }}{{ index .Title 99 }}{{ end }}{{ .Title }}`), 0644); err != nil {
+				t.Fatal(err)
+			}
+			destDir := filepath.Join(t.TempDir(), "sorted")
+
+			mediaSorter, err := New(&Config{DestDir: destDir, Template: templatePath, KeepUnsorted: keepUnsorted, Output: io.Discard, ErrOutput: io.Discard})
+			if err != nil {
+				t.Fatalf("New returned error: %v", err)
+			}
+			err = mediaSorter.Run(srcDir)
+			if !errors.Is(err, ErrTemplate) {
+				t.Errorf("Expected a template error, got %v", err)
+			}
+			if len(mediaSorter.skipped) > 0 {
+				t.Errorf("Expected no skipped files, got %v", mediaSorter.skipped)
+			}
+			if _, err := os.Stat(destDir); !os.IsNotExist(err) {
+				t.Errorf("Expected no files in the destination, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,1403 @@
+// Package sorter copies or moves media files into subdirectories, based on their metadata and a path template.
+//
+// Create a MediaSorter from a Config with New, then call Run with a source directory or file:
+//
+//	mediaSorter, err := sorter.New(&sorter.Config{DestDir: "sorted"})
+//	if err != nil {
+//		return err
+//	}
+//	defer mediaSorter.Close()
+//	err = mediaSorter.Run("unsorted")
+package sorter
+
+import (
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/dhowden/tag"
+)
+
+// defaultPathTemplate is used when there is no template file, InitTemplate writes it into a file for customizing it
+var defaultPathTemplate = `
+	{{- or .AlbumArtist .Artist -}}
+	{{- pathSep -}}
+	{{- .Album -}}
+	{{- pathSep -}}
+	{{- if .HasTrack }}{{ printf "%02d" .Track }}. {{ end -}}
+	{{- .Title -}}
+`
+
+// DefaultFlattenIndex is the disc and track number, e.g. "1-03", for keeping flattened file names in album order
+var DefaultFlattenIndex = `{{ if .HasTrack }}{{ with .Disc }}{{ . }}-{{ end }}{{ printf "%02d" .Track }}{{ end }}`
+
+// DefaultArtworkTemplate puts all artwork into one directory, with one image per album
+var DefaultArtworkTemplate = `Artwork/{{ or .AlbumArtist .Artist }} - {{ .Album }}`
+
+// ErrTooManyFiles means that the source has more files than MaxFiles, and Force is not set
+var ErrTooManyFiles = errors.New("too many files")
+
+// ErrEmptyTemplate means that the path template renders an empty path, even when all metadata fields are filled
+var ErrEmptyTemplate = errors.New("template renders an empty path")
+
+// exampleMetadata has all fields filled, for checking that a template renders a path
+var exampleMetadata = &Metadata{
+	Title:          "Title",
+	Artist:         "Artist",
+	AlbumArtist:    "Album Artist",
+	Album:          "Album",
+	Format:         tag.VORBIS,
+	FileType:       tag.FLAC,
+	Genre:          "Genre",
+	Composer:       "Composer",
+	Comment:        "Comment",
+	Year:           2000,
+	Track:          1,
+	TrackTotal:     1,
+	Disc:           1,
+	DiscTotal:      1,
+	HasTrack:       true,
+	Work:           "Work",
+	Movement:       "Movement",
+	MovementNumber: 1,
+	Encoder:        "Encoder",
+	SampleRate:     44100,
+	BitDepth:       16,
+}
+
+// Config contains all options for creating a MediaSorter.
+// The zero value copies files into the current directory, using the default template.
+type Config struct {
+	SrcDir  string
+	DestDir string
+	DryRun  bool
+	Move    bool
+	// Deprecated: Like OnExists with OverwriteExisting, but the first file wins when files of one run have the same destination
+	Override  bool
+	Template  string
+	Verbosity Verbosity
+	// Destination for messages, nil means os.Stdout
+	Output io.Writer
+	// Destination for warnings, nil means Output if it's set and os.Stderr otherwise
+	ErrOutput io.Writer
+	// Only show warnings and results, even in dry-run mode, which is verbose otherwise
+	Quiet bool
+
+	KeepOriginalName bool
+	StrictTemplate   bool
+	MaxFiles         int
+	Force            bool
+	FuzzySidecars    bool
+	KeepUnsorted     bool
+	UnsortedPrefix   string
+	OnLocked         LockedFilePolicy
+
+	NormalizePunctuation bool
+	Manifest             string
+	ManifestFormat       string
+	CheckWritable        bool
+	SidecarPolicy        SidecarPolicy
+	FlattenSidecars      bool
+	ArtworkTemplate      string
+	Ledger               string
+	MediaPriority        []string
+	MediaSelection       MediaSelection
+	Migrate              bool
+	Flatten              bool
+	FlattenIndex         string
+	// Same as OnExists with UpdateExisting
+	SkipUpToDate bool
+
+	AlbumArtistFromTracks bool
+	CopyNewerSidecarsOnly bool
+	// Characters and name lengths allowed in destination paths, empty means DefaultSanitizeLevel
+	Sanitize SanitizeLevel
+	// Check all destinations for collisions before processing any files
+	VerifyPlan PlanVerification
+	// Return an error after processing all files, if any files were skipped
+	ReportSkipsAsErrors bool
+	// Use both artists of split albums as album artist
+	DetectSplits bool
+	// Separator for the artists of split albums, empty means DefaultSplitSeparator
+	SplitSeparator string
+	// Keep track number 0 for files with a track number tag, instead of treating it as a missing track number
+	NormalizeTrackZero bool
+	// Characters allowed in destination file names, empty means UTF8Encoding
+	OutputEncoding OutputEncoding
+	// Keep brackets in destination file names instead of replacing them with dashes
+	KeepBrackets bool
+	// Maximum length of each part of destination paths in bytes, 0 means the length of the Sanitize level
+	MaxSegmentLength int
+	// Maximum length of absolute destination paths in characters, 0 means 259 on Windows and no limit on other platforms.
+	// A negative value means no limit on all platforms.
+	MaxPathLength int
+	// Values for empty artist and album fields in destination paths, empty means DefaultUnknownArtist and DefaultUnknownAlbum
+	UnknownArtist string
+	UnknownAlbum  string
+	// Value for empty title fields in destination paths, empty means the name of the source file
+	UnknownTitle string
+	// Leave empty artist, album and title fields empty, instead of using the values for empty fields
+	NoMetadataDefaults bool
+	// What to do when the destination of a file already exists, empty means OverwriteExisting
+	OnExists ExistingFilePolicy
+	// Correct the extension of media files to match their detected file type
+	FixExtension bool
+	// Optional function that asks whether to process the files, after showing their destinations
+	Confirm func(question string) bool
+	// Write embedded lyrics into .lrc files next to the media files
+	ExtractLyrics bool
+	// Write the embedded picture of the first media file with a picture into a cover file in each album directory
+	ExtractArt bool
+	// Only check the destinations of this many randomly selected media files, without processing any files
+	Sample int
+	// Remove source directories that are empty after moving the files
+	PruneEmpty bool
+	// Delete empty source directories permanently instead of moving them into the trash directory
+	DeleteEmpty bool
+	// Directory for empty source directories, empty means DefaultTrashDirName in the source directory
+	TrashDir string
+	// Skip media files where the MEDIASORTER tag has this value
+	SkipMarker string
+	// Write this value into the MEDIASORTER tag of the processed media files, empty means not writing the tag
+	WriteMarker string
+	// Number of file groups to process at the same time, 0 means 1
+	Jobs int
+	// Show a counter of the processed files and their total number, even without verbose output
+	Progress bool
+	// Show a summary line with the results at the end of the run, even in quiet mode
+	Summary bool
+	// Also write all messages into this file, adding them to the end of an existing file
+	LogFile string
+	// Only process media files of these types, empty means all types
+	FileTypes []tag.FileType
+	// Only process media files from this range of years, 0 means no limit
+	MinYear int
+	MaxYear int
+	// Only process media files where the genre contains this text, ignoring case
+	Genre string
+	// Glob patterns for the names of source files. Empty Include means all files, Exclude wins over Include.
+	Include []string
+	Exclude []string
+	// Only process sidecar files with these extensions, e.g. "cue" or ".log", empty means all sidecar files
+	SidecarExtensions []string
+	// Only descend MaxDepth levels of subdirectories into the source directory, 0 means only the source directory itself
+	LimitDepth bool
+	MaxDepth   int
+	// Descend into symbolic links to directories in the source directory
+	FollowSymlinks bool
+	// Continue with the other files after an error, and return all errors at the end
+	KeepGoing bool
+	// Compose letters and combining marks in destination paths, e.g. from macOS file names, to the NFC form of Unicode
+	NormalizeUnicode bool
+	// Undo the files of a file group when processing one of its files fails
+	AtomicGroup bool
+	// Read copied files again and compare their checksum with the source
+	Verify bool
+	// Text of the pathSep template function, empty means "/"
+	Separator string
+	// Only process media files of this size in bytes, 0 means no limit
+	MinSize int64
+	MaxSize int64
+	// Show files without tags and non-media files in one list at the end, instead of a warning for each file
+	SummarizeSkips bool
+}
+
+type MediaSorter struct {
+	DestDir          string
+	PathTemplate     *template.Template
+	MetadataReader   *MetaDataReader
+	FileProcessor    FileProcessor
+	OverrideChecker  OverrideChecker
+	OutputWriter     *OutputWriter
+	KeepOriginalName bool
+	StrictTemplate   bool
+	// Maximum number of files that Sort will process, 0 means no limit
+	MaxFiles      int
+	FuzzySidecars bool
+	// Directory for files that can't be sorted by the template, empty string means skipping them
+	UnsortedDir          string
+	NormalizePunctuation bool
+	// Optional writer for a manifest of all file actions
+	Manifest ManifestWriter
+	// Optional checker for destination directories in dry-run mode
+	WritableChecker *WritableChecker
+	SidecarPolicy   SidecarPolicy
+	// Only process sidecar files with these extensions, without dot and in lowercase, empty means all sidecar files
+	SidecarExtensions []string
+	// Maximum depth of subdirectories of the source directory, 0 means only the source directory, negative means no limit
+	MaxDepth int
+	// Descend into symbolic links to directories in the source directory
+	FollowSymlinks bool
+	// Continue with the other file groups after an error, and return all errors at the end
+	KeepGoing bool
+	// Remove the files that processing a file group created, or move them back, when processing the group fails
+	AtomicGroup bool
+	// Sort the source directory into itself, DestDir is the source directory
+	InPlace bool
+	// Optional template for the sort index of flattened file names, flattening is off when it's nil
+	FlattenIndexTemplate *template.Template
+	// Fill missing album artists with the artist of all tracks of the album
+	AlbumArtistFromTracks bool
+	// Join the artists of split albums with this separator and use them as album artist, empty means no split detection
+	SplitSeparator string
+	// Album artists determined from the tracks, by album key
+	albumArtists map[string]string
+	// Optional template for image sidecar files, to put artwork in a separate place
+	ArtworkTemplate *template.Template
+	// Artwork files that were already processed, to process only one image per album
+	artworkDestinations map[string]struct{}
+	// Optional checker for sidecar files. When it's set, sidecar files are processed independently
+	// of their media file, and skipped when the checker reports an existing destination.
+	SidecarOverrideChecker OverrideChecker
+	// Cleans destination paths for the file system of the destination
+	Sanitizer *Sanitizer
+	// Maximum length of absolute destination paths in characters, 0 means no limit
+	MaxPathLength int
+	// Values for empty metadata fields in destination paths, nil leaves the fields empty
+	MetadataDefaults *MetadataDefaults
+	// Check all destinations for collisions before processing any files
+	PlanVerification PlanVerification
+	// Make Run return an error when it skipped files
+	SkipsAsErrors bool
+	// Number of skipped files by reason
+	skipped map[SkipReason]int
+	// Show files without tags and non-media files in one list at the end of the run, instead of a warning for each file
+	SummarizeSkips bool
+	// Files for the list at the end of the run, by reason
+	skippedFiles map[SkipReason][]string
+	// Add a number to file names when their destination exists
+	RenameExisting bool
+	// When renaming, use the first destination that has the same content as the source, instead of adding a copy
+	Dedupe bool
+	// Destinations of this run, for renaming files with the same destination
+	usedDestinations map[string]struct{}
+	// Use the extension of the detected file type when it doesn't match the extension of the media file
+	FixExtension bool
+	// Optional function that asks whether to process the files, after showing their destinations
+	Confirm func(question string) bool
+	// Destinations of the media files, by media file
+	destinations map[MediaFile]plannedDestination
+	// Optional writer for embedded lyrics, extracting lyrics is off when it's nil
+	LyricsWriter LyricsWriter
+	// Optional writer for the marker of WriteMarker, writing markers is off when it's nil
+	MarkerWriter MarkerWriter
+	// Writer for sidecar files with the embed action
+	SidecarEmbedder SidecarEmbedder
+	// Optional writer for embedded pictures, extracting artwork is off when it's nil
+	CoverWriter CoverWriter
+	// Number of randomly selected media files to check instead of processing all files, 0 means processing all files
+	Sample int
+	// Optional remover for source directories that are empty after sorting, pruning is off when it's nil
+	EmptyDirRemover EmptyDirRemover
+	// Directory for empty source directories, empty means DefaultTrashDirName in the source directory
+	TrashDir string
+	// Directories that the run moved files out of, for pruning them with the EmptyDirRemover
+	movedFromDirs *movedFromDirs
+	// Skip media files where the MEDIASORTER tag has this value, empty means not checking the tag
+	SkipMarker string
+	// Write this value into the MEDIASORTER tag of the processed media files, empty means not writing the tag
+	WriteMarker string
+	// Number of file groups to process at the same time
+	Jobs int
+	// Show a counter of the processed file groups, even without verbose output
+	Progress bool
+	// Counter of the processed file groups of the run, nil without Progress
+	progress *progress
+	// Results of the run for the summary at the end, nil shows no summary
+	summary *runSummary
+	// File that gets a copy of all messages, nil without a log file
+	logFile *os.File
+	// Only process media files of these types, empty means all types
+	FileTypes []tag.FileType
+	// Only process media files from this range of years, 0 means no limit
+	MinYear int
+	MaxYear int
+	// Only process media files where the genre contains this text, ignoring case, empty means all genres
+	Genre string
+	// Glob patterns for the names of source files. Empty Include means all files, Exclude wins over Include.
+	Include []string
+	Exclude []string
+	// Only process media files of this size in bytes, 0 means no limit
+	MinSize int64
+	MaxSize int64
+	// Protects the maps of the run from parallel jobs
+	mu sync.Mutex
+	// Locks for destinations that are being processed
+	destinationLocks keyedMutex
+}
+
+// Close finishes the manifest and closes the override checker and the log file, if they need it
+func (m *MediaSorter) Close() error {
+	var err error
+	if m.Manifest != nil {
+		err = m.Manifest.Close()
+	}
+	if closer, ok := m.OverrideChecker.(io.Closer); ok {
+		if closeErr := closer.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	if m.logFile != nil {
+		if closeErr := m.logFile.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("error closing log file %s: %w", m.logFile.Name(), closeErr)
+		}
+	}
+	return err
+}
+
+// executePathTemplate renders a path template for a media file, without cleaning the path
+func executePathTemplate(pathTemplate *template.Template, metadata *Metadata, origName string) (string, error) {
+	pathTemplate, metadata, err := preparePathTemplate(pathTemplate, metadata, origName)
+	if err != nil {
+		return "", err
+	}
+	var pathBuffer bytes.Buffer
+	if err := pathTemplate.Execute(&pathBuffer, metadata); err != nil {
+		return "", fmt.Errorf("error executing template: %v", err)
+	}
+	return pathBuffer.String(), nil
+}
+
+// preparePathTemplate returns a copy of the path template with the origName function of the file,
+// and the metadata that the template sees
+func preparePathTemplate(pathTemplate *template.Template, metadata *Metadata, origName string) (*template.Template, *Metadata, error) {
+	// Replace the function on a copy, parallel jobs render the template for different files at the same time
+	pathTemplate, err := pathTemplate.Clone()
+	if err != nil {
+		return nil, nil, fmt.Errorf("error copying template: %v", err)
+	}
+	pathTemplate.Funcs(template.FuncMap{
+		"origName": func() string { return origName },
+	})
+	if metadata.Track != 0 && !metadata.HasTrack {
+		// Metadata that doesn't come from the tag reader may only set the track number
+		withTrack := *metadata
+		withTrack.HasTrack = true
+		metadata = &withTrack
+	}
+	return pathTemplate, metadata, nil
+}
+
+// originalName returns the base name of a file without its extension
+func originalName(path string) string {
+	base := filepath.Base(path)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+func (m *MediaSorter) ProcessFileGroup(group *FileGroup) error {
+	return m.processFileGroup(group, "")
+}
+
+// processFileGroup processes the file group, showing the counter of the group before the destination of the media file.
+// With AtomicGroup, it undoes the files it created when processing the group fails.
+func (m *MediaSorter) processFileGroup(group *FileGroup, counter string) error {
+	if !m.AtomicGroup {
+		return m.processGroupFiles(group, counter, nil)
+	}
+	tx := &groupTransaction{}
+	err := m.processGroupFiles(group, counter, tx)
+	var existsErr *FileExistsError
+	if err != nil && !errors.As(err, &existsErr) {
+		if len(tx.files)+len(tx.dirs) > 0 {
+			m.OutputWriter.Warn(fmt.Sprintf("Processing %s failed, undoing the %d files that were already processed", group.MediaFile, len(tx.files)))
+			tx.rollback(m.OutputWriter)
+		}
+		m.releaseClaims(tx)
+	}
+	return err
+}
+
+// processGroupFiles processes the media file and the sidecar files of the group.
+// The transaction records the created files, it's nil without AtomicGroup.
+func (m *MediaSorter) processGroupFiles(group *FileGroup, counter string, tx *groupTransaction) error {
+	fileProcessor := m.FileProcessor
+	if tx != nil {
+		fileProcessor = tx.track(fileProcessor)
+	}
+	dest, err := m.planDestination(group)
+	if err != nil {
+		re, ok := err.(*NotAMediaFileError)
+		if ok {
+			m.OutputWriter.Info(re.Error())
+			return nil
+		}
+		return err
+	}
+
+	if string(group.MediaFile) == dest.destPath {
+		m.OutputWriter.Info(fmt.Sprintf("File %s is already at its destination, skipping", dest.destPath))
+		return nil
+	}
+
+	if m.RenameExisting {
+		m.renameIfExists(string(group.MediaFile), dest)
+	}
+
+	// Check the length before creating any directories, most programs can't open files with longer paths
+	if err := m.checkPathLength(string(group.MediaFile), dest.destPath); err != nil {
+		return err
+	}
+
+	// Files with the same destination must not be processed at the same time by parallel jobs
+	unlock := m.destinationLocks.lock(dest.destPath)
+	defer unlock()
+
+	message := fmt.Sprintf("Processing file %s -> %s", group.MediaFile, dest.destPath)
+	if counter != "" {
+		// The counter is for following the progress, so it's shown without verbose mode
+		m.OutputWriter.Print(counter + " " + message)
+	} else {
+		m.OutputWriter.Info(message)
+	}
+
+	// Read the picture while the media file is still at its source path
+	var cover *tag.Picture
+	if m.CoverWriter != nil {
+		cover = m.readCover(group, dest)
+	}
+
+	var skipErr error
+	if m.OverrideChecker.DestinationFileExists(string(group.MediaFile), dest.destPath) {
+		skipErr = &FileExistsError{srcPath: string(group.MediaFile), destPath: dest.destPath}
+		if m.SidecarOverrideChecker == nil {
+			return skipErr
+		}
+	} else {
+		if err := fileProcessor(string(group.MediaFile), dest.destPath); err != nil {
+			return err
+		}
+		if m.MarkerWriter != nil {
+			if err := m.writeMarker(dest); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Process sidecar files
+	for _, sidecarFile := range group.SidecarFiles {
+		if !m.sidecarAllowed(sidecarFile) {
+			m.OutputWriter.Info(fmt.Sprintf("Skipping sidecar file %s, its extension is not one of the sidecar extensions", sidecarFile))
+			continue
+		}
+		switch m.SidecarPolicy.Action(string(dest.metadata.FileType), sidecarFile) {
+		case SkipSidecar:
+			m.OutputWriter.Info(fmt.Sprintf("Skipping sidecar file %s", sidecarFile))
+			continue
+		case EmbedSidecar:
+			// Existing media files stay unchanged, so their sidecar files get copied
+			if skipErr == nil {
+				embedded, err := m.embedSidecar(sidecarFile, dest)
+				if err != nil {
+					return err
+				}
+				if embedded {
+					continue
+				}
+			}
+		}
+
+		sidecarExt := filepath.Ext(sidecarFile)
+		sidecarDestPath := filepath.Join(m.DestDir, dest.pathStr+sidecarExt)
+
+		if m.ArtworkTemplate != nil && isImageFile(sidecarFile) {
+			artworkPath, err := executePathTemplate(m.ArtworkTemplate, dest.cleanMetadata, dest.origName)
+			if err != nil {
+				return &TemplateError{srcPath: sidecarFile, err: err}
+			}
+			sidecarDestPath = filepath.Join(m.DestDir, m.Sanitizer.cleanPath(artworkPath)+sidecarExt)
+			if err := checkInsideDir(m.DestDir, sidecarDestPath); err != nil {
+				return err
+			}
+			if !m.claimArtwork(tx, sidecarDestPath) {
+				m.OutputWriter.Info(fmt.Sprintf("Artwork %s already exists, skipping %s", sidecarDestPath, sidecarFile))
+				continue
+			}
+			m.OutputWriter.Info(fmt.Sprintf("Processing artwork %s -> %s", sidecarFile, sidecarDestPath))
+		} else {
+			m.OutputWriter.Info(fmt.Sprintf("Processing sidecar file %s -> %s", sidecarFile, sidecarDestPath))
+		}
+
+		if err := m.checkPathLength(sidecarFile, sidecarDestPath); err != nil {
+			m.OutputWriter.Warn(err.Error())
+			continue
+		}
+
+		if m.SidecarOverrideChecker != nil && m.SidecarOverrideChecker.DestinationFileExists(sidecarFile, sidecarDestPath) {
+			m.OutputWriter.Info(fmt.Sprintf("Sidecar file %s is up to date, skipping %s", sidecarDestPath, sidecarFile))
+			continue
+		}
+
+		err := fileProcessor(sidecarFile, sidecarDestPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	if m.LyricsWriter != nil {
+		if err := m.extractLyrics(group, dest, tx); err != nil {
+			return err
+		}
+	}
+
+	if cover != nil {
+		if err := m.extractCover(group, dest, cover, tx); err != nil {
+			return err
+		}
+	}
+
+	return skipErr
+}
+
+// isUnsortable returns true if the error means that the template can't sort the file
+func isUnsortable(err error) bool {
+	switch reason, _ := SkipReasonOf(err); reason {
+	case SkipNoTags, SkipNotAMediaFile, SkipMissingField:
+		return true
+	}
+	return false
+}
+
+// ProcessUnsorted copies or moves files into the directory for unsorted files,
+// preserving their path relative to the source directory
+func (m *MediaSorter) ProcessUnsorted(srcDir string, files []string) error {
+	for _, file := range files {
+		relPath, err := filepath.Rel(srcDir, file)
+		if err != nil {
+			return fmt.Errorf("error determining relative path for %s: %w", file, err)
+		}
+		destPath := filepath.Join(m.UnsortedDir, relPath)
+
+		m.OutputWriter.Info(fmt.Sprintf("Processing unsorted file %s -> %s", file, destPath))
+
+		if m.OverrideChecker.DestinationFileExists(file, destPath) {
+			m.skipFile(file, &FileExistsError{srcPath: file, destPath: destPath})
+			continue
+		}
+
+		err = m.FileProcessor(file, destPath)
+		if errors.Is(err, ErrLocked) {
+			m.skipFile(file, err)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sortPlan contains the file groups of a source directory
+type sortPlan struct {
+	mediaGroups    map[string]*FileGroup
+	nonMediaGroups map[string][]string
+}
+
+func (m *MediaSorter) Sort(srcDir string) error {
+	plan, err := m.collect(srcDir)
+	if err != nil {
+		return err
+	}
+	if m.Sample > 0 {
+		return m.checkSample(plan.mediaGroups)
+	}
+	if !m.confirmPlan(plan.mediaGroups) {
+		return nil
+	}
+	if err := m.execute(srcDir, plan); err != nil {
+		return err
+	}
+	if m.EmptyDirRemover != nil {
+		return m.pruneEmptyDirs(srcDir)
+	}
+	return nil
+}
+
+// collect groups the files of the source directory and reads the metadata that the templates need from all files
+func (m *MediaSorter) collect(srcDir string) (*sortPlan, error) {
+	// First pass: collect all files and group by path without suffix
+	fileGroups := make(map[string][]string)
+	fileCount := 0
+	var visited *visitedDirs
+	if m.FollowSymlinks {
+		visited = newVisitedDirs()
+	}
+	// Walk recursively through the source directory
+	var walk fs.WalkDirFunc
+	walk = func(path string, info fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		// We don't do anything with directories, filepath.WalkDir will recursively walk them anyway
+		if info.IsDir() {
+			if m.MaxDepth >= 0 && directoryDepth(srcDir, path) > m.MaxDepth {
+				m.OutputWriter.Debug(fmt.Sprintf("Directory %s is deeper than %d levels, ignoring it", path, m.MaxDepth))
+				return fs.SkipDir
+			}
+			if visited != nil {
+				first, err := visited.visit(path)
+				if err != nil {
+					return err
+				}
+				if !first {
+					m.OutputWriter.Debug(fmt.Sprintf("Directory %s was already processed through another link, ignoring it", path))
+					return fs.SkipDir
+				}
+			}
+			return nil
+		}
+
+		// filepath.WalkDir doesn't follow links, a trailing separator makes it walk the directory the link points to
+		if visited != nil && info.Type()&fs.ModeSymlink != 0 {
+			if target, err := os.Stat(path); err == nil && target.IsDir() {
+				return filepath.WalkDir(path+string(filepath.Separator), walk)
+			}
+		}
+
+		hidden, err := isHidden(path, info)
+		if err != nil {
+			return err
+		}
+		if hidden || !m.matchesPatterns(path) {
+			return nil
+		}
+
+		basename := strings.TrimSuffix(path, filepath.Ext(path))
+		fileGroups[basename] = append(fileGroups[basename], path)
+		fileCount++
+
+		return nil
+	}
+	err := filepath.WalkDir(srcDir, walk)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Checking a sample doesn't process any files
+	if m.MaxFiles > 0 && fileCount > m.MaxFiles && m.Sample == 0 {
+		return nil, fmt.Errorf("%w: found %d files in %s, which is more than the maximum of %d files", ErrTooManyFiles, fileCount, srcDir, m.MaxFiles)
+	}
+
+	return m.planGroups(fileGroups)
+}
+
+// planGroups finds the media file in each group of files with the same path without suffix,
+// and reads the metadata that the templates need from all media files
+func (m *MediaSorter) planGroups(fileGroups map[string][]string) (*sortPlan, error) {
+	// Second pass: find the media file in each group
+	mediaGroups := make(map[string]*FileGroup)
+	nonMediaGroups := make(map[string][]string)
+	for basename, files := range fileGroups {
+		groups, err := m.MetadataReader.GetFileGroups(files)
+		if err != nil {
+			nonMediaGroups[basename] = files
+			continue
+		}
+		for i, group := range groups {
+			// Files of the wrong size are skipped with their sidecar files, before reading their tags
+			if !m.matchesSize(group.MediaFile) {
+				continue
+			}
+			key := basename
+			if i > 0 {
+				// Other tracks with the same name use their own path as key
+				key = string(group.MediaFile)
+			}
+			mediaGroups[key] = group
+		}
+	}
+
+	if m.FuzzySidecars {
+		m.associateFuzzySidecars(mediaGroups, nonMediaGroups)
+	}
+
+	if m.AlbumArtistFromTracks || m.SplitSeparator != "" {
+		m.collectAlbumArtists(mediaGroups)
+	}
+
+	// Checking a sample reports its own collisions
+	if m.PlanVerification != NoPlanVerification && m.Sample == 0 {
+		if err := m.verifyPlan(mediaGroups); err != nil {
+			return nil, err
+		}
+	}
+
+	return &sortPlan{mediaGroups: mediaGroups, nonMediaGroups: nonMediaGroups}, nil
+}
+
+// execute processes all files of the plan
+func (m *MediaSorter) execute(srcDir string, plan *sortPlan) error {
+	mediaGroups, nonMediaGroups := plan.mediaGroups, plan.nonMediaGroups
+	defer m.printSummary()
+	defer m.printSkippedFiles()
+
+	var errs []error
+	for basename, files := range nonMediaGroups {
+		m.summary.countNonMedia(len(files))
+		if m.UnsortedDir != "" {
+			if err := m.ProcessUnsorted(srcDir, files); err != nil {
+				if !m.KeepGoing {
+					return err
+				}
+				errs = append(errs, err)
+			}
+			continue
+		}
+		if m.SummarizeSkips {
+			m.listSkippedFiles(SkipNotAMediaFile, files...)
+			continue
+		}
+		switch len(files) {
+		case 0:
+			m.OutputWriter.Warn(fmt.Sprintf("Strange error: No files found in group '%s'. This should never happen. Please contact program author", basename))
+		case 1:
+			m.OutputWriter.Warn(fmt.Sprintf("%s is not a media file, skipping", files[0]))
+		default:
+			m.OutputWriter.Warn(fmt.Sprintf("No media file found for %d files starting with %s, skipping", len(files), basename))
+		}
+	}
+
+	// Third pass: process each group
+	if err := m.processGroups(srcDir, slices.Collect(maps.Values(mediaGroups))); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// processGroup processes a file group of the source directory. It handles unsortable and skipped files
+// and returns only errors that stop the run.
+func (m *MediaSorter) processGroup(srcDir string, group *FileGroup) error {
+	err := m.processFileGroup(group, m.progress.next())
+
+	if m.UnsortedDir != "" && isUnsortable(err) {
+		m.OutputWriter.Info(fmt.Sprintf("Can't sort %s: %v", group.MediaFile, err))
+		err = m.ProcessUnsorted(srcDir, group.Files())
+		m.summary.countResult(err)
+		return err
+	}
+
+	if _, skipped := SkipReasonOf(err); skipped {
+		m.skipFile(string(group.MediaFile), err)
+		return nil
+	}
+	m.summary.countResult(err)
+	return err
+}
+
+func createOutputWriter(config *Config) (*OutputWriter, *os.File, error) {
+	outputWriter := &OutputWriter{Verbosity: Quiet, Writer: config.Output, ErrWriter: config.ErrOutput}
+	if config.Verbosity == Verbose {
+		outputWriter.Verbosity = Verbose
+	} else if config.Verbosity >= Debug {
+		outputWriter.Verbosity = Debug
+	}
+	if config.LogFile == "" {
+		return outputWriter, nil, nil
+	}
+
+	// Later runs add their messages to the log, to keep a record of all runs
+	logFile, err := os.OpenFile(config.LogFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error opening log file %s: %w", config.LogFile, err)
+	}
+	output := config.Output
+	if output == nil {
+		output = os.Stdout
+	}
+	errOutput := config.ErrOutput
+	if errOutput == nil && config.Output != nil {
+		errOutput = config.Output
+	}
+	if errOutput == nil {
+		errOutput = os.Stderr
+	}
+	outputWriter.Writer = io.MultiWriter(output, logFile)
+	outputWriter.ErrWriter = io.MultiWriter(errOutput, logFile)
+	return outputWriter, logFile, nil
+}
+
+func determineFileProcessor(config *Config, outputWriter *OutputWriter) FileProcessor {
+	var copier FileProcessor = CopyFile
+	if config.Verify {
+		copier = VerifiedCopyFile
+	}
+	var fileProcessor = copier
+	if config.Move {
+		if config.DryRun && !config.Migrate {
+			outputWriter.Warn("Dry run mode is not compatible with move operation, no files will be moved")
+		}
+		// Moving within a file system only renames the file, only the copy to another file system needs verification
+		fileProcessor = withCopyFallback(MoveFile, copier, outputWriter)
+	}
+	if config.DryRun {
+		fileProcessor = DryRunFileProcessor
+		// Dry run mode should always be verbose to show what would happen, unless explicitly quiet
+		if config.Verbosity < Verbose && !config.Quiet {
+			outputWriter.Verbosity = Verbose
+		}
+		return fileProcessor
+	}
+	if config.Force {
+		fileProcessor = withConflictingFilesMovedAside(fileProcessor, outputWriter)
+	}
+	return withLockedFilePolicy(fileProcessor, config.OnLocked, outputWriter)
+}
+
+// determineFileAction returns the name of the file action for the manifest
+func determineFileAction(config *Config) string {
+	if config.DryRun {
+		return "dry-run"
+	}
+	if config.Move {
+		return "move"
+	}
+	return "copy"
+}
+
+func determineOverrideChecker(config *Config, outputWriter *OutputWriter) (OverrideChecker, error) {
+	checker := determinePolicyOverrideChecker(config)
+	if config.Ledger != "" {
+		ledger, err := NewLedgerOverrideChecker(config.Ledger, checker, outputWriter)
+		if err != nil {
+			return nil, err
+		}
+		// Dry runs don't write files, so they must not claim destinations
+		ledger.ReadOnly = config.DryRun
+		return ledger, nil
+	}
+	return checker, nil
+}
+
+// determinePolicyOverrideChecker returns the checker for the policy for existing files
+func determinePolicyOverrideChecker(config *Config) OverrideChecker {
+	if config.Migrate {
+		// Files in the library must never overwrite each other
+		return &FilesystemOverrideChecker{MemoryOverrideChecker{SeenFiles: make(map[string]struct{})}}
+	}
+	switch determineExistingFilePolicy(config) {
+	case OverwriteExisting:
+		if config.Override {
+			// The deprecated flag only overwrites files of earlier runs
+			return &MemoryOverrideChecker{SeenFiles: make(map[string]struct{})}
+		}
+	case SkipExisting:
+		return &FilesystemOverrideChecker{MemoryOverrideChecker{SeenFiles: make(map[string]struct{})}}
+	case UpdateExisting:
+		return &UpToDateOverrideChecker{}
+	case SkipIdentical, DedupeExisting:
+		return &HashOverrideChecker{}
+	}
+	// Renaming happens in ProcessFileGroup, before writing to the renamed destination
+	return &NoOverrideChecker{}
+}
+
+func determineExistingFilePolicy(config *Config) ExistingFilePolicy {
+	if config.SkipUpToDate {
+		return UpdateExisting
+	}
+	if config.OnExists == "" {
+		return OverwriteExisting
+	}
+	return config.OnExists
+}
+
+func determineSidecarOverrideChecker(config *Config) OverrideChecker {
+	if config.CopyNewerSidecarsOnly {
+		return &UpToDateOverrideChecker{}
+	}
+	return nil
+}
+
+func determineLyricsWriter(config *Config) LyricsWriter {
+	if !config.ExtractLyrics {
+		return nil
+	}
+	if config.DryRun {
+		return DryRunLyricsWriter
+	}
+	return WriteLyricsFile
+}
+
+func determineSidecarEmbedder(config *Config) SidecarEmbedder {
+	if config.DryRun {
+		return DryRunSidecarEmbedder
+	}
+	return EmbedSidecarTag
+}
+
+func determineMarkerWriter(config *Config) MarkerWriter {
+	if config.WriteMarker == "" {
+		return nil
+	}
+	if config.DryRun {
+		return DryRunMarkerWriter
+	}
+	return WriteMarkerTag
+}
+
+func determineCoverWriter(config *Config) CoverWriter {
+	if !config.ExtractArt {
+		return nil
+	}
+	if config.DryRun {
+		return DryRunCoverWriter
+	}
+	return WriteCoverFile
+}
+
+func determineEmptyDirRemover(config *Config) EmptyDirRemover {
+	// Copying files and dry runs don't empty any directories
+	if !config.PruneEmpty || !config.Move || config.DryRun {
+		return nil
+	}
+	if config.DeleteEmpty {
+		return DeleteEmptyDir
+	}
+	return TrashEmptyDir(config.TrashDir)
+}
+
+func determineMaxDepth(config *Config) int {
+	if !config.LimitDepth {
+		return -1
+	}
+	return config.MaxDepth
+}
+
+func determineSidecarExtensions(config *Config) []string {
+	var extensions []string
+	for _, ext := range config.SidecarExtensions {
+		if ext = normalizeExtension(strings.TrimSpace(ext)); ext != "" {
+			extensions = append(extensions, ext)
+		}
+	}
+	return extensions
+}
+
+func determineMetadataDefaults(config *Config) *MetadataDefaults {
+	if config.NoMetadataDefaults {
+		return nil
+	}
+	// The values go into the destination path like metadata
+	defaults := (&Metadata{
+		Artist: cmp.Or(config.UnknownArtist, DefaultUnknownArtist),
+		Album:  cmp.Or(config.UnknownAlbum, DefaultUnknownAlbum),
+		Title:  config.UnknownTitle,
+	}).CleanForPaths()
+	return &MetadataDefaults{
+		Artist: defaults.Artist,
+		Album:  defaults.Album,
+		Title:  defaults.Title,
+	}
+}
+
+func determineSplitSeparator(config *Config) string {
+	if !config.DetectSplits {
+		return ""
+	}
+	if config.SplitSeparator == "" {
+		return DefaultSplitSeparator
+	}
+	return config.SplitSeparator
+}
+
+func determineMaxFiles(config *Config) int {
+	if config.Force {
+		return 0
+	}
+	return config.MaxFiles
+}
+
+func determineUnsortedDir(config *Config) string {
+	if !config.KeepUnsorted {
+		return ""
+	}
+	return filepath.Join(config.DestDir, config.UnsortedPrefix)
+}
+
+// createPathTemplate parses the template file, or the default template if templatePath is empty.
+// A separator that is not empty replaces the "/" of the pathSep function, slashes in the template still create directories.
+func createPathTemplate(templatePath string, separator string, sanitizer *Sanitizer) (*template.Template, error) {
+	var templateStr = defaultPathTemplate
+	if templatePath != "" {
+		templateFileContents, err := os.ReadFile(templatePath)
+		if err != nil {
+			return nil, fmt.Errorf("error reading template file %s: %v", templatePath, err)
+		}
+		templateStr = string(templateFileContents)
+	}
+
+	pathTemplate, err := parsePathTemplate("path", templateStr, separator)
+	if err != nil {
+		return nil, err
+	}
+	// A template that renders nothing for a file with all fields would put every file into DestDir, with the same name
+	examplePath, err := executePathTemplate(pathTemplate, exampleMetadata, "example")
+	if err != nil {
+		return nil, err
+	}
+	if sanitizer.cleanPath(examplePath) == "" {
+		if templatePath == "" {
+			return nil, ErrEmptyTemplate
+		}
+		return nil, fmt.Errorf("%w: %s", ErrEmptyTemplate, templatePath)
+	}
+	return pathTemplate, nil
+}
+
+// InitTemplate writes the default template into a file, as a starting point for a custom template.
+// It doesn't overwrite an existing file unless override is true, the error then matches fs.ErrExist.
+func InitTemplate(path string, override bool) error {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if !override {
+		flags |= os.O_EXCL
+	}
+	file, err := os.OpenFile(path, flags, 0644)
+	if err != nil {
+		return fmt.Errorf("error creating template file %s: %w", path, err)
+	}
+	_, err = io.WriteString(file, strings.TrimPrefix(defaultPathTemplate, "\n"))
+	if closeErr := file.Close(); closeErr != nil && err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("error writing template file %s: %w", path, err)
+	}
+	return nil
+}
+
+// parsePathTemplate parses a template for destination paths. A separator that is not empty replaces the "/" of the pathSep function.
+func parsePathTemplate(name string, templateStr string, separator string) (*template.Template, error) {
+	pathSep := cmp.Or(separator, "/")
+	pathTemplate, err := template.New(name).Funcs(template.FuncMap{
+		// Path separator function to make the separator more visible in templates than a simple "/"
+		"pathSep":           func() string { return pathSep },
+		"replaceInBrackets": ReplaceInBrackets,
+		"removeBrackets":    RemoveBrackets,
+		"bucket":            Bucket,
+		"sep":               Sep,
+		"wrap":              Wrap,
+		"year":              Year,
+		"side":              Side,
+		"lower":             strings.ToLower,
+		"upper":             strings.ToUpper,
+		"title":             Title,
+		"snake":             snakeForPaths,
+		"ascii":             asciiFold,
+		"firstLetter":       FirstLetter,
+		"stripArticle":      StripArticle,
+		"truncate":          Truncate,
+		"pad":               Pad,
+		// Placeholder, ProcessFileGroup replaces it with a function returning the name of the current file
+		"origName": func() string { return "" },
+		// TODO add more custom functions for normalizing names
+	}).Parse(templateStr)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing template: %v", err)
+	}
+	if unknown := unknownFields(templateFields(pathTemplate)); len(unknown) > 0 {
+		return nil, fmt.Errorf("template uses unknown fields %s, see the placeholders in the README", strings.Join(unknown, ", "))
+	}
+	// Check if template is valid by executing it with a dummy Metadata struct
+	if err := pathTemplate.Execute(io.Discard, &Metadata{}); err != nil {
+		return nil, fmt.Errorf("error executing template: %v", err)
+	}
+
+	return pathTemplate, nil
+}
+
+// New creates a MediaSorter from the configuration
+func New(config *Config) (_ *MediaSorter, err error) {
+	// Files that New opened, they are closed when a later step fails
+	var closers []io.Closer
+	defer func() {
+		if err != nil {
+			for _, closer := range slices.Backward(closers) {
+				closer.Close()
+			}
+		}
+	}()
+
+	outputWriter, logFile, err := createOutputWriter(config)
+	if err != nil {
+		return nil, err
+	}
+	if logFile != nil {
+		closers = append(closers, logFile)
+	}
+	fileProcessor := determineFileProcessor(config, outputWriter)
+	sanitizer, err := NewSanitizer(config.Sanitize, config.OutputEncoding)
+	if err != nil {
+		return nil, err
+	}
+	sanitizer.keepBrackets = config.KeepBrackets
+	sanitizer.normalizeUnicode = config.NormalizeUnicode
+	if config.MaxSegmentLength > 0 {
+		sanitizer.maxLength = config.MaxSegmentLength
+	}
+	pathTemplate, err := createPathTemplate(config.Template, config.Separator, sanitizer)
+	if err != nil {
+		return nil, err
+	}
+
+	overrideChecker, err := determineOverrideChecker(config, outputWriter)
+	if err != nil {
+		return nil, err
+	}
+	if closer, ok := overrideChecker.(io.Closer); ok {
+		closers = append(closers, closer)
+	}
+
+	var artworkTemplate *template.Template
+	if config.FlattenSidecars {
+		artworkTemplate, err = parsePathTemplate("artwork", config.ArtworkTemplate, config.Separator)
+		if err != nil {
+			return nil, fmt.Errorf("error in artwork template: %w", err)
+		}
+	}
+
+	var flattenIndexTemplate *template.Template
+	if config.Flatten {
+		flattenIndexTemplate, err = parsePathTemplate("flatten-index", config.FlattenIndex, config.Separator)
+		if err != nil {
+			return nil, fmt.Errorf("error in flatten index template: %w", err)
+		}
+	}
+
+	var writableChecker *WritableChecker
+	if config.CheckWritable {
+		writableChecker = NewWritableChecker()
+		fileProcessor = writableChecker.FileProcessor
+	}
+
+	var manifest ManifestWriter
+	if config.Manifest != "" {
+		manifestFile, err := CreateManifestFile(config.Manifest, config.ManifestFormat)
+		if err != nil {
+			return nil, err
+		}
+		manifest = &syncManifestWriter{ManifestWriter: manifestFile}
+		closers = append(closers, manifest)
+	}
+
+	metadataReader := &MetaDataReader{
+		OutputWriter:   outputWriter,
+		MediaPriority:  config.MediaPriority,
+		MediaSelection: config.MediaSelection,
+		KeepTrackZero:  config.NormalizeTrackZero,
+	}
+
+	mediaSorter := &MediaSorter{
+		DestDir:          config.DestDir,
+		PathTemplate:     pathTemplate,
+		FileProcessor:    fileProcessor,
+		MetadataReader:   metadataReader,
+		OverrideChecker:  overrideChecker,
+		OutputWriter:     outputWriter,
+		KeepOriginalName: config.KeepOriginalName,
+		StrictTemplate:   config.StrictTemplate,
+		MaxFiles:         determineMaxFiles(config),
+		FuzzySidecars:    config.FuzzySidecars,
+		UnsortedDir:      determineUnsortedDir(config),
+
+		NormalizePunctuation: config.NormalizePunctuation,
+		Manifest:             manifest,
+		WritableChecker:      writableChecker,
+		SidecarPolicy:        config.SidecarPolicy,
+		SidecarExtensions:    determineSidecarExtensions(config),
+		MaxDepth:             determineMaxDepth(config),
+		FollowSymlinks:       config.FollowSymlinks,
+		KeepGoing:            config.KeepGoing,
+		AtomicGroup:          config.AtomicGroup,
+		InPlace:              config.Migrate,
+		FlattenIndexTemplate: flattenIndexTemplate,
+
+		AlbumArtistFromTracks: config.AlbumArtistFromTracks,
+		ArtworkTemplate:       artworkTemplate,
+		artworkDestinations:   make(map[string]struct{}),
+
+		SidecarOverrideChecker: determineSidecarOverrideChecker(config),
+		Sanitizer:              sanitizer,
+		MaxPathLength:          determineMaxPathLength(config),
+		MetadataDefaults:       determineMetadataDefaults(config),
+		PlanVerification:       config.VerifyPlan,
+		SkipsAsErrors:          config.ReportSkipsAsErrors,
+		SummarizeSkips:         config.SummarizeSkips,
+		SplitSeparator:         determineSplitSeparator(config),
+		RenameExisting:         !config.Migrate && slices.Contains([]ExistingFilePolicy{RenameExisting, DedupeExisting}, determineExistingFilePolicy(config)),
+		Dedupe:                 !config.Migrate && determineExistingFilePolicy(config) == DedupeExisting,
+		usedDestinations:       make(map[string]struct{}),
+		FixExtension:           config.FixExtension,
+		Confirm:                config.Confirm,
+		LyricsWriter:           determineLyricsWriter(config),
+		CoverWriter:            determineCoverWriter(config),
+		Sample:                 config.Sample,
+		EmptyDirRemover:        determineEmptyDirRemover(config),
+		TrashDir:               config.TrashDir,
+		SkipMarker:             config.SkipMarker,
+		WriteMarker:            config.WriteMarker,
+		MarkerWriter:           determineMarkerWriter(config),
+		SidecarEmbedder:        determineSidecarEmbedder(config),
+		Jobs:                   max(config.Jobs, 1),
+		Progress:               config.Progress,
+		logFile:                logFile,
+		FileTypes:              config.FileTypes,
+		MinYear:                config.MinYear,
+		MaxYear:                config.MaxYear,
+		Genre:                  config.Genre,
+		Include:                config.Include,
+		Exclude:                config.Exclude,
+		MinSize:                config.MinSize,
+		MaxSize:                config.MaxSize,
+		summary:                determineSummary(config),
+	}
+	if manifest != nil {
+		mediaSorter.FileProcessor = withManifest(fileProcessor, determineFileAction(config), manifest, mediaSorter.plannedMetadata)
+	}
+	// Dry runs don't write files, so they only read the ledger
+	if ledger, ok := overrideChecker.(*LedgerOverrideChecker); ok && !config.DryRun {
+		mediaSorter.FileProcessor = withLedger(mediaSorter.FileProcessor, ledger)
+	}
+	if mediaSorter.summary != nil {
+		mediaSorter.FileProcessor = mediaSorter.summary.withByteCount(mediaSorter.FileProcessor)
+	}
+	if mediaSorter.EmptyDirRemover != nil {
+		mediaSorter.movedFromDirs = &movedFromDirs{dirs: make(map[string]struct{})}
+		mediaSorter.FileProcessor = mediaSorter.movedFromDirs.withMovedFromDirs(mediaSorter.FileProcessor)
+	}
+	return mediaSorter, nil
+}
+
+func validatePaths(srcPath, destPath string) error {
+	// Check source exists and get its info
+	fi, err := os.Stat(srcPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("source directory %s does not exist", srcPath)
+		}
+		return fmt.Errorf("error getting file system information for source directory %s: %w", srcPath, err)
+	}
+
+	// Determine source directory path for comparison
+	var srcDirPath string
+	if fi.IsDir() {
+		srcDirPath = srcPath
+	} else {
+		srcDirPath = filepath.Dir(srcPath)
+	}
+
+	// Check path relationships
+	absSrcDir, err := filepath.Abs(srcDirPath)
+	if err != nil {
+		return fmt.Errorf("error resolving absolute path for source directory %s: %w", srcDirPath, err)
+	}
+	absDestDir, err := filepath.Abs(destPath)
+	if err != nil {
+		return fmt.Errorf("error resolving absolute path for destination directory %s: %w", destPath, err)
+	}
+
+	rel, err := filepath.Rel(absSrcDir, absDestDir)
+	if err != nil {
+		return fmt.Errorf("error determining relative path from source to destination: %w", err)
+	}
+	if rel == "." {
+		return fmt.Errorf("source and destination directories are the same: %s", absSrcDir)
+	}
+	if !strings.HasPrefix(rel, "..") {
+		return fmt.Errorf("destination directory %s is inside source directory %s", absDestDir, absSrcDir)
+	}
+
+	// Check if destination directory exists and is a directory
+	destFi, err := os.Stat(destPath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return fmt.Errorf("error getting file system information for destination directory %s: %w", destPath, err)
+		}
+		// Destination doesn't exist, which is fine - it will be created
+	} else if !destFi.IsDir() {
+		return fmt.Errorf("destination %s is not a directory", destPath)
+	}
+
+	return nil
+}
+
+// Run sorts a source directory or a single media file. In dry-run mode with a WritableChecker,
+// it returns an error if there were destination directories that are not writable.
+func (m *MediaSorter) Run(srcPath string) error {
+	return m.finishRun(m.processInput(srcPath))
+}
+
+// finishRun reports the results of a run that ended with err, and returns the error of the run
+func (m *MediaSorter) finishRun(err error) error {
+	if err == nil && m.WritableChecker != nil {
+		err = m.WritableChecker.Report(m.OutputWriter)
+	}
+	if err == nil && m.SkipsAsErrors && len(m.skipped) > 0 {
+		err = &SkippedFilesError{counts: m.skipped}
+	}
+	return err
+}
+
+func (m *MediaSorter) processInput(srcDir string) error {
+	if m.InPlace {
+		return m.processInPlace(srcDir)
+	}
+
+	if err := validatePaths(srcDir, m.DestDir); err != nil {
+		return err
+	}
+
+	fi, err := os.Stat(srcDir)
+	if err != nil {
+		return err // Should not happen after validatePaths, but we have to handle errors
+	}
+
+	if fi.IsDir() {
+		return m.Sort(srcDir)
+	}
+
+	// Process single file
+	fg, err := m.MetadataReader.GetFileGroup([]string{srcDir})
+	if err != nil {
+		defer m.printSummary()
+		m.summary.countNonMedia(1)
+		if m.UnsortedDir != "" {
+			return m.ProcessUnsorted(filepath.Dir(srcDir), []string{srcDir})
+		}
+		return err
+	}
+	if m.Sample > 0 {
+		return m.checkSample(map[string]*FileGroup{srcDir: fg})
+	}
+	if !m.confirmPlan(map[string]*FileGroup{srcDir: fg}) {
+		return nil
+	}
+	// Like the files of a directory, so the summary counts the file and the reports show skipped files
+	defer m.printSummary()
+	return m.processGroup(filepath.Dir(srcDir), fg)
+}
+
+// processInPlace sorts a library directory into itself, e.g. after changing the template
+func (m *MediaSorter) processInPlace(srcDir string) error {
+	fi, err := os.Stat(srcDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("source directory %s does not exist", srcDir)
+		}
+		return fmt.Errorf("error getting file system information for source directory %s: %w", srcDir, err)
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("%s is not a directory, migration needs a library directory", srcDir)
+	}
+	return m.Sort(srcDir)
+}
@@ -0,0 +1,789 @@
+package sorter
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeSourceFiles writes the files into the directory, the names can contain subdirectories separated by "/"
+func writeSourceFiles(t *testing.T, dir string, files map[string][]byte) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRunSortsFilesByTemplate(t *testing.T) {
+	srcDir := t.TempDir()
+	destDir := filepath.Join(t.TempDir(), "sorted")
+	files := map[string][]byte{
+		"track.flac": flacStream("TITLE=Title", "ARTIST=Artist", "ALBUM=Album", "TRACKNUMBER=3"),
+		"track.lrc":  []byte("[00:00.00] lyrics"),
+	}
+	writeSourceFiles(t, srcDir, files)
+
+	mediaSorter, err := New(&Config{DestDir: destDir})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	if err := mediaSorter.Run(srcDir); err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+	if err := mediaSorter.Close(); err != nil {
+		t.Fatalf("Close returned error: %v", err)
+	}
+
+	for _, name := range []string{"03. Title.flac", "03. Title.lrc"} {
+		if _, err := os.Stat(filepath.Join(destDir, "Artist", "Album", name)); err != nil {
+			t.Errorf("Expected sorted file %s: %v", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(srcDir, "track.flac")); err != nil {
+		t.Errorf("Expected source file to be copied, not moved: %v", err)
+	}
+}
+
+func TestRunCopiesNewerSidecarsOnly(t *testing.T) {
+	srcDir := t.TempDir()
+	destDir := filepath.Join(t.TempDir(), "sorted")
+	files := map[string][]byte{
+		"track.flac": flacStream("TITLE=Title", "ARTIST=Artist", "ALBUM=Album"),
+		"track.lrc":  []byte("[00:00.00] new lyrics"),
+		"track.txt":  []byte("new notes"),
+	}
+	writeSourceFiles(t, srcDir, files)
+
+	// The media file and the text file are up to date, the lyrics are outdated
+	albumDir := filepath.Join(destDir, "Artist", "Album")
+	if err := os.MkdirAll(albumDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	destFiles := map[string][]byte{
+		"Title.flac": []byte("existing"),
+		"Title.lrc":  []byte("old lyrics"),
+		"Title.txt":  []byte("existing notes"),
+	}
+	for name, content := range destFiles {
+		if err := os.WriteFile(filepath.Join(albumDir, name), content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(albumDir, "Title.lrc"), past, past); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"Title.flac", "Title.txt"} {
+		if err := os.Chtimes(filepath.Join(albumDir, name), future, future); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mediaSorter, err := New(&Config{DestDir: destDir, SkipUpToDate: true, CopyNewerSidecarsOnly: true, Verbosity: Quiet, Output: io.Discard})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	if err := mediaSorter.Run(srcDir); err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+
+	expected := map[string]string{
+		"Title.flac": "existing",
+		"Title.lrc":  "[00:00.00] new lyrics",
+		"Title.txt":  "existing notes",
+	}
+	for name, content := range expected {
+		actual, err := os.ReadFile(filepath.Join(albumDir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(actual) != content {
+			t.Errorf("Expected '%s' in %s but got '%s'", content, name, actual)
+		}
+	}
+}
+
+func TestCreatePathTemplateRejectsEmptyTemplates(t *testing.T) {
+	tests := []struct {
+		description string
+		template    string
+		expectedErr bool
+	}{
+		{"empty file", "", true},
+		{"whitespace only", "  \n", true},
+		{"only separators", "{{ pathSep }}{{ pathSep }}", true},
+		{"only characters that cleanup removes", "`", true},
+		{"template with fields", "{{ .Artist }}/{{ .Title }}", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			templatePath := filepath.Join(t.TempDir(), "template.txt")
+			if err := os.WriteFile(templatePath, []byte(test.template), 0644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := createPathTemplate(templatePath, "", sanitizers[DefaultSanitizeLevel])
+			if test.expectedErr && !errors.Is(err, ErrEmptyTemplate) {
+				t.Errorf("Expected ErrEmptyTemplate but got %v", err)
+			}
+			if !test.expectedErr && err != nil {
+				t.Errorf("Expected no error but got %v", err)
+			}
+		})
+	}
+}
+
+func TestRunExtractsLyrics(t *testing.T) {
+	srcDir := t.TempDir()
+	destDir := filepath.Join(t.TempDir(), "sorted")
+	files := map[string][]byte{
+		"lyrics.flac":       flacStream("TITLE=Lyrics", "ARTIST=Artist", "ALBUM=Album", "LYRICS=Hello world"),
+		"instrumental.flac": flacStream("TITLE=Instrumental", "ARTIST=Artist", "ALBUM=Album"),
+		"existing.flac":     flacStream("TITLE=Existing", "ARTIST=Artist", "ALBUM=Album", "LYRICS=New lyrics"),
+	}
+	writeSourceFiles(t, srcDir, files)
+	albumDir := filepath.Join(destDir, "Artist", "Album")
+	if err := os.MkdirAll(albumDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(albumDir, "Existing.lrc"), []byte("Old lyrics"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	mediaSorter, err := New(&Config{DestDir: destDir, ExtractLyrics: true, Verbosity: Quiet, Output: io.Discard})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	if err := mediaSorter.Run(srcDir); err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+
+	expected := map[string]string{
+		"Lyrics.lrc":   "Hello world",
+		"Existing.lrc": "Old lyrics",
+	}
+	for name, content := range expected {
+		actual, err := os.ReadFile(filepath.Join(albumDir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(actual) != content {
+			t.Errorf("Expected '%s' in %s but got '%s'", content, name, actual)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(albumDir, "Instrumental.lrc")); !os.IsNotExist(err) {
+		t.Errorf("Expected no lyrics file for a file without lyrics, got %v", err)
+	}
+}
+
+func TestRunExtractsLyricsWithoutClaimingTheirDestination(t *testing.T) {
+	srcDir := t.TempDir()
+	writeSourceFiles(t, srcDir, map[string][]byte{
+		"lyrics.flac": flacStream("TITLE=Lyrics", "ARTIST=Artist", "ALBUM=Album", "LYRICS=Hello world"),
+	})
+	destDir := filepath.Join(t.TempDir(), "sorted")
+	checker := &MemoryOverrideChecker{SeenFiles: make(map[string]struct{})}
+
+	mediaSorter, err := New(&Config{DestDir: destDir, ExtractLyrics: true, Verbosity: Quiet, Output: io.Discard})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	mediaSorter.OverrideChecker = checker
+	if err := mediaSorter.Run(srcDir); err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+
+	lyricsPath := filepath.Join(destDir, "Artist", "Album", "Lyrics.lrc")
+	if _, err := os.Stat(lyricsPath); err != nil {
+		t.Errorf("Expected lyrics file: %v", err)
+	}
+	if _, seen := checker.SeenFiles[lyricsPath]; seen {
+		t.Errorf("Expected checking for existing lyrics not to claim %s in the override checker", lyricsPath)
+	}
+}
+
+func TestRunSortsByComposer(t *testing.T) {
+	srcDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(srcDir, "track.flac"), flacStream("TITLE=Title", "ALBUM=Album", "COMPOSER=Bach/Busoni"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	templatePath := filepath.Join(t.TempDir(), "template.txt")
+	if err := os.WriteFile(templatePath, []byte("{{ .Composer }}/{{ .Album }}/{{ .Title }}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	destDir := filepath.Join(t.TempDir(), "sorted")
+
+	mediaSorter, err := New(&Config{DestDir: destDir, Template: templatePath, Verbosity: Quiet, Output: io.Discard})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	if err := mediaSorter.Run(srcDir); err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(destDir, "BachBusoni", "Album", "Title.flac")); err != nil {
+		t.Errorf("Expected file sorted by composer: %v", err)
+	}
+}
+
+func TestRunKeepsOriginalName(t *testing.T) {
+	tests := []struct {
+		description string
+		config      Config
+		expected    string
+	}{
+		{"nested path", Config{}, "Artist/Album/Title [orig_rip 01 - v2].flac"},
+		{"minimal sanitizing", Config{Sanitize: MinimalSanitizing}, "Artist/Album/Title [orig_rip_01 (v2)].flac"},
+		{"flat path", Config{Flatten: true}, "Artist - Album - Title [orig_rip 01 - v2].flac"},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			srcDir := t.TempDir()
+			writeSourceFiles(t, srcDir, map[string][]byte{
+				"rip_01 (v2).flac": flacStream("TITLE=Title", "ARTIST=Artist", "ALBUM=Album"),
+			})
+			destDir := filepath.Join(t.TempDir(), "sorted")
+			config := test.config
+			config.DestDir = destDir
+			config.KeepOriginalName = true
+			config.Output = io.Discard
+
+			mediaSorter, err := New(&config)
+			if err != nil {
+				t.Fatalf("New returned error: %v", err)
+			}
+			if err := mediaSorter.Run(srcDir); err != nil {
+				t.Fatalf("Run returned error: %v", err)
+			}
+			if _, err := os.Stat(filepath.Join(destDir, filepath.FromSlash(test.expected))); err != nil {
+				t.Errorf("Expected file with original name: %v", err)
+			}
+		})
+	}
+}
+
+func TestRunKeepsUnsortedFiles(t *testing.T) {
+	tests := []struct {
+		description    string
+		unsortedPrefix string
+		expectedDir    string
+	}{
+		{"default prefix", "_unsorted", "_unsorted"},
+		{"custom prefix", "lost+found", "lost+found"},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			srcDir := t.TempDir()
+			writeSourceFiles(t, srcDir, map[string][]byte{
+				"album/track.flac":    flacStream("TITLE=Title", "ARTIST=Artist", "ALBUM=Album"),
+				"album/notes.txt":     []byte("notes"),
+				"album/untagged.mp3":  []byte("not really audio"),
+				"other/no-album.flac": flacStream("TITLE=No Album", "ARTIST=Artist"),
+				"other/no-album.cue":  []byte("cue sheet"),
+			})
+			templatePath := filepath.Join(t.TempDir(), "template.txt")
+			if err := os.WriteFile(templatePath, []byte("{{ .Artist }}/{{ .Album }}/{{ .Title }}"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			destDir := filepath.Join(t.TempDir(), "sorted")
+
+			mediaSorter, err := New(&Config{
+				DestDir:            destDir,
+				Template:           templatePath,
+				KeepUnsorted:       true,
+				UnsortedPrefix:     test.unsortedPrefix,
+				NoMetadataDefaults: true,
+				StrictTemplate:     true,
+				Output:             io.Discard,
+				ErrOutput:          io.Discard,
+			})
+			if err != nil {
+				t.Fatalf("New returned error: %v", err)
+			}
+			if err := mediaSorter.Run(srcDir); err != nil {
+				t.Fatalf("Run returned error: %v", err)
+			}
+
+			expectedFiles := []string{
+				"Artist/Album/Title.flac",
+				test.expectedDir + "/album/notes.txt",
+				test.expectedDir + "/album/untagged.mp3",
+				test.expectedDir + "/other/no-album.flac",
+				test.expectedDir + "/other/no-album.cue",
+			}
+			for _, expected := range expectedFiles {
+				if _, err := os.Stat(filepath.Join(destDir, filepath.FromSlash(expected))); err != nil {
+					t.Errorf("Expected file %s: %v", expected, err)
+				}
+			}
+			if _, err := os.Stat(filepath.Join(destDir, test.expectedDir, "album", "track.flac")); !os.IsNotExist(err) {
+				t.Errorf("Expected sorted file not to be in the unsorted directory, got %v", err)
+			}
+		})
+	}
+}
+
+func TestRunFlattensPathsWithIndex(t *testing.T) {
+	tests := []struct {
+		description  string
+		flattenIndex string
+		expected     []string
+	}{
+		{"default index", DefaultFlattenIndex, []string{"Artist - Album - 1-03 - Third.flac", "Artist - Album - 12 - Twelfth.flac", "Artist - Album - Untracked.flac"}},
+		{"custom index", "{{ .Year }}", []string{"Artist - Album - 1999 - Third.flac", "Artist - Album - 1999 - Twelfth.flac", "Artist - Album - 1999 - Untracked.flac"}},
+		{"no index", "", []string{"Artist - Album - Third.flac", "Artist - Album - Twelfth.flac", "Artist - Album - Untracked.flac"}},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			srcDir := t.TempDir()
+			writeSourceFiles(t, srcDir, map[string][]byte{
+				"third.flac":     flacStream("TITLE=Third", "ARTIST=Artist", "ALBUM=Album", "DATE=1999", "TRACKNUMBER=3", "DISCNUMBER=1"),
+				"twelfth.flac":   flacStream("TITLE=Twelfth", "ARTIST=Artist", "ALBUM=Album", "DATE=1999", "TRACKNUMBER=12"),
+				"untracked.flac": flacStream("TITLE=Untracked", "ARTIST=Artist", "ALBUM=Album", "DATE=1999"),
+			})
+			templatePath := filepath.Join(t.TempDir(), "template.txt")
+			if err := os.WriteFile(templatePath, []byte("{{ .Artist }}/{{ .Album }}/{{ .Title }}"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			destDir := filepath.Join(t.TempDir(), "sorted")
+
+			mediaSorter, err := New(&Config{DestDir: destDir, Template: templatePath, Flatten: true, FlattenIndex: test.flattenIndex, Output: io.Discard})
+			if err != nil {
+				t.Fatalf("New returned error: %v", err)
+			}
+			if err := mediaSorter.Run(srcDir); err != nil {
+				t.Fatalf("Run returned error: %v", err)
+			}
+
+			entries, err := os.ReadDir(destDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var actual []string
+			for _, entry := range entries {
+				actual = append(actual, entry.Name())
+			}
+			if !slices.Equal(actual, test.expected) {
+				t.Errorf("Expected files %v but got %v", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestRunSortsByFirstLetter(t *testing.T) {
+	for _, level := range SanitizeLevelNames() {
+		t.Run(level, func(t *testing.T) {
+			srcDir := t.TempDir()
+			writeSourceFiles(t, srcDir, map[string][]byte{
+				"one.flac": flacStream("TITLE=One", "ARTIST=2Pac"),
+				"two.flac": flacStream("TITLE=Two", "ARTIST=E\u0301lan"),
+			})
+			templatePath := filepath.Join(t.TempDir(), "template.txt")
+			if err := os.WriteFile(templatePath, []byte("{{ firstLetter .Artist }}/{{ .Title }}"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			destDir := filepath.Join(t.TempDir(), "sorted")
+
+			mediaSorter, err := New(&Config{DestDir: destDir, Template: templatePath, Sanitize: SanitizeLevel(level), Output: io.Discard})
+			if err != nil {
+				t.Fatalf("New returned error: %v", err)
+			}
+			if err := mediaSorter.Run(srcDir); err != nil {
+				t.Fatalf("Run returned error: %v", err)
+			}
+			for _, path := range []string{filepath.Join("#", "One.flac"), filepath.Join("É", "Two.flac")} {
+				if _, err := os.Stat(filepath.Join(destDir, path)); err != nil {
+					t.Errorf("Expected file in index directory: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestRunStopsAtMaxFiles(t *testing.T) {
+	tests := []struct {
+		description string
+		config      Config
+		expectedErr bool
+	}{
+		{"more files than the maximum", Config{MaxFiles: 2}, true},
+		{"as many files as the maximum", Config{MaxFiles: 3}, false},
+		{"no maximum", Config{MaxFiles: 0}, false},
+		{"force", Config{MaxFiles: 2, Force: true}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			srcDir := t.TempDir()
+			writeSourceFiles(t, srcDir, map[string][]byte{
+				"one.flac":  flacStream("TITLE=One", "ARTIST=Artist", "ALBUM=Album"),
+				"one.cue":   []byte("cue sheet"),
+				"notes.txt": []byte("notes"),
+			})
+			destDir := filepath.Join(t.TempDir(), "sorted")
+			config := test.config
+			config.DestDir = destDir
+			config.Output = io.Discard
+			config.ErrOutput = io.Discard
+
+			mediaSorter, err := New(&config)
+			if err != nil {
+				t.Fatalf("New returned error: %v", err)
+			}
+			err = mediaSorter.Run(srcDir)
+			if test.expectedErr != (err != nil) {
+				t.Fatalf("Expected error: %v, got %v", test.expectedErr, err)
+			}
+			_, statErr := os.Stat(filepath.Join(destDir, "Artist", "Album", "One.flac"))
+			if test.expectedErr {
+				if !errors.Is(err, ErrTooManyFiles) || !strings.Contains(err.Error(), "found 3 files") || strings.Contains(err.Error(), "--force") || !os.IsNotExist(statErr) {
+					t.Errorf("Expected the run to stop before processing files, got %v and %v", err, statErr)
+				}
+			} else if statErr != nil {
+				t.Errorf("Expected the file to be sorted: %v", statErr)
+			}
+		})
+	}
+}
+
+func TestRunMigratesLibraryInPlace(t *testing.T) {
+	tests := []struct {
+		description string
+		dryRun      bool
+		expected    []string
+		notExpected []string
+	}{
+		{
+			"apply",
+			false,
+			[]string{"Album/Title.flac", "Album/Title.cue", "Album/Done.flac", "Album/Taken.flac", "Old/Taken.flac"},
+			[]string{"Artist/Album/Title.flac", "Artist/Album/Title.cue"},
+		},
+		{
+			"dry run",
+			true,
+			[]string{"Artist/Album/Title.flac", "Artist/Album/Title.cue", "Album/Done.flac", "Album/Taken.flac", "Old/Taken.flac"},
+			[]string{"Album/Title.flac", "Album/Title.cue"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			libraryDir := t.TempDir()
+			takenContent := flacStream("TITLE=Taken", "ARTIST=Other Artist", "ALBUM=Album")
+			writeSourceFiles(t, libraryDir, map[string][]byte{
+				"Artist/Album/Title.flac": flacStream("TITLE=Title", "ARTIST=Artist", "ALBUM=Album"),
+				"Artist/Album/Title.cue":  []byte("cue sheet"),
+				"Album/Done.flac":         flacStream("TITLE=Done", "ARTIST=Artist", "ALBUM=Album"),
+				"Album/Taken.flac":        takenContent,
+				"Old/Taken.flac":          flacStream("TITLE=Taken", "ARTIST=Artist", "ALBUM=Album"),
+			})
+			templatePath := filepath.Join(t.TempDir(), "template.txt")
+			if err := os.WriteFile(templatePath, []byte("{{ .Album }}/{{ .Title }}"), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			mediaSorter, err := New(&Config{
+				DestDir:   libraryDir,
+				Template:  templatePath,
+				Migrate:   true,
+				Move:      true,
+				DryRun:    test.dryRun,
+				Output:    io.Discard,
+				ErrOutput: io.Discard,
+			})
+			if err != nil {
+				t.Fatalf("New returned error: %v", err)
+			}
+			if err := mediaSorter.Run(libraryDir); err != nil {
+				t.Fatalf("Run returned error: %v", err)
+			}
+
+			for _, expected := range test.expected {
+				if _, err := os.Stat(filepath.Join(libraryDir, filepath.FromSlash(expected))); err != nil {
+					t.Errorf("Expected file %s: %v", expected, err)
+				}
+			}
+			for _, notExpected := range test.notExpected {
+				if _, err := os.Stat(filepath.Join(libraryDir, filepath.FromSlash(notExpected))); !os.IsNotExist(err) {
+					t.Errorf("Expected file %s not to exist, got %v", notExpected, err)
+				}
+			}
+			content, err := os.ReadFile(filepath.Join(libraryDir, "Album", "Taken.flac"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(content, takenContent) {
+				t.Errorf("Expected migration not to overwrite files in the library")
+			}
+		})
+	}
+}
+
+func TestExecutePathTemplateDerivesHasTrack(t *testing.T) {
+	pathTemplate, err := createPathTemplate("", "", sanitizers[DefaultSanitizeLevel])
+	if err != nil {
+		t.Fatalf("createPathTemplate returned error: %v", err)
+	}
+	tests := []struct {
+		description string
+		metadata    *Metadata
+		expected    string
+	}{
+		{"track number without HasTrack", &Metadata{Artist: "Artist", Album: "Album", Title: "Title", Track: 3}, "Artist/Album/03. Title"},
+		{"no track number", &Metadata{Artist: "Artist", Album: "Album", Title: "Title"}, "Artist/Album/Title"},
+		{"track zero with HasTrack", &Metadata{Artist: "Artist", Album: "Album", Title: "Title", HasTrack: true}, "Artist/Album/00. Title"},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			rendered, err := executePathTemplate(pathTemplate, test.metadata, "track")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if actual := sanitizers[DefaultSanitizeLevel].cleanPath(rendered); actual != test.expected {
+				t.Errorf("Expected '%s' but got '%s'", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestRunRendersTrackTotals(t *testing.T) {
+	srcDir := t.TempDir()
+	files := map[string][]byte{
+		"with-total.flac":    flacStream("TITLE=With Total", "TRACKNUMBER=3/12"),
+		"without-total.flac": flacStream("TITLE=Without Total", "TRACKNUMBER=4"),
+	}
+	writeSourceFiles(t, srcDir, files)
+	templatePath := filepath.Join(t.TempDir(), "template.txt")
+	template := `{{ printf "%02d" .Track }}{{ if .TrackTotal }} of {{ printf "%02d" .TrackTotal }}{{ end }} - {{ .Title }}`
+	if err := os.WriteFile(templatePath, []byte(template), 0644); err != nil {
+		t.Fatal(err)
+	}
+	destDir := filepath.Join(t.TempDir(), "sorted")
+
+	mediaSorter, err := New(&Config{DestDir: destDir, Template: templatePath, Verbosity: Quiet, Output: io.Discard})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	if err := mediaSorter.Run(srcDir); err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+
+	for _, name := range []string{"03 of 12 - With Total.flac", "04 - Without Total.flac"} {
+		if _, err := os.Stat(filepath.Join(destDir, name)); err != nil {
+			t.Errorf("Expected sorted file %s: %v", name, err)
+		}
+	}
+}
+
+func TestRunProcessesFilesWithParallelJobs(t *testing.T) {
+	srcDir := t.TempDir()
+	destDir := filepath.Join(t.TempDir(), "sorted")
+	const fileCount = 40
+	for i := range fileCount {
+		name := fmt.Sprintf("track%02d", i)
+		content := flacStream("TITLE="+name, "ARTIST=Artist", fmt.Sprintf("ALBUM=Album %d", i%4))
+		if err := os.WriteFile(filepath.Join(srcDir, name+".flac"), content, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(srcDir, name+".lrc"), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mediaSorter, err := New(&Config{DestDir: destDir, Move: true, Jobs: 4, Verbosity: Verbose, Output: io.Discard})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	if err := mediaSorter.Run(srcDir); err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+
+	for i := range fileCount {
+		name := fmt.Sprintf("track%02d", i)
+		for _, ext := range []string{".flac", ".lrc"} {
+			path := filepath.Join(destDir, "Artist", fmt.Sprintf("Album %d", i%4), name+ext)
+			if _, err := os.Stat(path); err != nil {
+				t.Errorf("Expected sorted file %s: %v", path, err)
+			}
+		}
+	}
+}
+
+func TestInitTemplateWritesDefaultTemplate(t *testing.T) {
+	templatePath := filepath.Join(t.TempDir(), "template.tmpl")
+	if err := InitTemplate(templatePath, false); err != nil {
+		t.Fatalf("InitTemplate returned error: %v", err)
+	}
+
+	pathTemplate, err := createPathTemplate(templatePath, "", sanitizers[DefaultSanitizeLevel])
+	if err != nil {
+		t.Fatalf("createPathTemplate returned error for initialized template: %v", err)
+	}
+	defaultTemplate, _ := createPathTemplate("", "", sanitizers[DefaultSanitizeLevel])
+	expected, _ := executePathTemplate(defaultTemplate, exampleMetadata, "example")
+	actual, err := executePathTemplate(pathTemplate, exampleMetadata, "example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual != expected {
+		t.Errorf("Expected initialized template to render '%s' like the default template, got '%s'", expected, actual)
+	}
+
+	if err := InitTemplate(templatePath, false); !errors.Is(err, fs.ErrExist) {
+		t.Errorf("Expected fs.ErrExist for existing template file, got %v", err)
+	}
+	if err := os.WriteFile(templatePath, []byte("{{ .Title }}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitTemplate(templatePath, true); err != nil {
+		t.Fatalf("InitTemplate with override returned error: %v", err)
+	}
+	content, _ := os.ReadFile(templatePath)
+	if string(content) == "{{ .Title }}" {
+		t.Error("Expected InitTemplate with override to overwrite the existing file")
+	}
+}
+
+func TestCreatePathTemplateWithSeparator(t *testing.T) {
+	tests := []struct {
+		description string
+		template    string
+		separator   string
+		expected    string
+	}{
+		{"default separator", "", "", "Artist/Album/03. Title"},
+		{"custom separator", "", " - ", "Artist - Album - 03. Title"},
+		{"slashes still create directories", "{{ .Artist }}/{{ .Album }}{{ pathSep }}{{ .Title }}", " - ", "Artist/Album - Title"},
+		{"separator with forbidden characters", "{{ .Artist }}{{ pathSep }}{{ .Title }}", " :: ", "Artist Title"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			templatePath := ""
+			if test.template != "" {
+				templatePath = filepath.Join(t.TempDir(), "template.txt")
+				if err := os.WriteFile(templatePath, []byte(test.template), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			pathTemplate, err := createPathTemplate(templatePath, test.separator, sanitizers[DefaultSanitizeLevel])
+			if err != nil {
+				t.Fatalf("createPathTemplate returned error: %v", err)
+			}
+			metadata := &Metadata{Artist: "Artist", Album: "Album", Title: "Title", Track: 3, HasTrack: true}
+			rendered, err := executePathTemplate(pathTemplate, metadata, "track")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if actual := sanitizers[DefaultSanitizeLevel].cleanPath(rendered); actual != test.expected {
+				t.Errorf("Expected '%s' but got '%s'", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestRunUsesSeparatorInAllTemplates(t *testing.T) {
+	srcDir := t.TempDir()
+	writeSourceFiles(t, srcDir, map[string][]byte{
+		"track.flac": flacStream("TITLE=Title", "ARTIST=Artist", "ALBUM=Album", "DATE=1999", "TRACKNUMBER=3"),
+		"track.jpg":  []byte("image"),
+	})
+	templatePath := filepath.Join(t.TempDir(), "template.txt")
+	if err := os.WriteFile(templatePath, []byte("{{ .Artist }}/{{ .Album }}/{{ .Title }}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	destDir := filepath.Join(t.TempDir(), "sorted")
+
+	mediaSorter, err := New(&Config{
+		DestDir:         destDir,
+		Template:        templatePath,
+		Separator:       " - ",
+		Flatten:         true,
+		FlattenIndex:    "{{ .Year }}{{ pathSep }}{{ .Track }}",
+		FlattenSidecars: true,
+		ArtworkTemplate: "Artwork/{{ .Artist }}{{ pathSep }}{{ .Album }}",
+		Output:          io.Discard,
+	})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	if err := mediaSorter.Run(srcDir); err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+
+	for _, expected := range []string{"Artist - Album - 1999 - 3 - Title.flac", "Artwork/Artist - Album.jpg"} {
+		if _, err := os.Stat(filepath.Join(destDir, filepath.FromSlash(expected))); err != nil {
+			t.Errorf("Expected file %s: %v", expected, err)
+		}
+	}
+}
+
+func TestCreatePathTemplateRejectsUnknownFields(t *testing.T) {
+	tests := []struct {
+		description string
+		template    string
+		expectedErr string
+	}{
+		{"misspelled field", "{{ .Albm }}/{{ .Title }}", ".Albm"},
+		{"field in branch that examples don't execute", `{{ if eq .Genre "Jazz" }}{{ .Artst }}/{{ end }}{{ .Title }}`, ".Artst"},
+		{"several fields", "{{ .Albm }}/{{ .Titel }}", ".Albm, .Titel"},
+		{"known fields", `{{ if eq .Genre "Jazz" }}{{ .Artist }}/{{ end }}{{ .Title }}`, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			templatePath := filepath.Join(t.TempDir(), "template.txt")
+			if err := os.WriteFile(templatePath, []byte(test.template), 0644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := createPathTemplate(templatePath, "", sanitizers[DefaultSanitizeLevel])
+			if test.expectedErr == "" {
+				if err != nil {
+					t.Errorf("Expected no error but got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), "unknown fields "+test.expectedErr) {
+				t.Errorf("Expected error naming %s but got %v", test.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestProcessFileGroupUsesFileNameForMissingTitle(t *testing.T) {
+	srcDir := t.TempDir()
+	destDir := filepath.Join(t.TempDir(), "sorted")
+	srcPath := filepath.Join(srcDir, "05 - Intro (live.2003).flac")
+	if err := os.WriteFile(srcPath, flacStream("ARTIST=Artist", "ALBUM=Album", "TRACKNUMBER=5"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	mediaSorter, err := New(&Config{DestDir: destDir, Output: io.Discard})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	if err := mediaSorter.ProcessFileGroup(&FileGroup{MediaFile: MediaFile(srcPath)}); err != nil {
+		t.Fatalf("ProcessFileGroup returned error: %v", err)
+	}
+
+	// Only the extension is removed from the file name, the sanitizer replaces the brackets
+	expected := filepath.Join(destDir, "Artist", "Album", "05. 05 - Intro - live.2003.flac")
+	if _, err := os.Stat(expected); err != nil {
+		t.Errorf("Expected file named after the source file: %v", err)
+	}
+}
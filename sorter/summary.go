@@ -0,0 +1,109 @@
+package sorter
+
+import (
+	"fmt"
+	"os"
+	"sync/atomic"
+)
+
+// runSummary counts the results of a run, for the line that Run shows at the end.
+// A nil summary counts nothing.
+type runSummary struct {
+	// Past tense of the file action, like "copied"
+	action    string
+	processed atomic.Int64
+	nonMedia  atomic.Int64
+	errors    atomic.Int64
+	bytes     atomic.Int64
+}
+
+func determineSummary(config *Config) *runSummary {
+	if !config.Summary {
+		return nil
+	}
+	return &runSummary{action: determineSummaryAction(config)}
+}
+
+// determineSummaryAction returns the file action of the run for the summary
+func determineSummaryAction(config *Config) string {
+	switch {
+	case config.DryRun && config.Move:
+		return "to move"
+	case config.DryRun:
+		return "to copy"
+	case config.Move:
+		return "moved"
+	default:
+		return "copied"
+	}
+}
+
+// countResult counts a processed file group, or an error if processing it failed
+func (s *runSummary) countResult(err error) {
+	if s == nil {
+		return
+	}
+	if err != nil {
+		s.errors.Add(1)
+	} else {
+		s.processed.Add(1)
+	}
+}
+
+func (s *runSummary) countNonMedia(files int) {
+	if s == nil {
+		return
+	}
+	s.nonMedia.Add(int64(files))
+}
+
+// withByteCount wraps a FileProcessor to add the size of each processed file to the summary.
+// It reads the size before processing the file, because moving it removes the source.
+func (s *runSummary) withByteCount(fileProcessor FileProcessor) FileProcessor {
+	return func(srcPath string, destPath string) error {
+		fi, statErr := os.Stat(srcPath)
+		if err := fileProcessor(srcPath, destPath); err != nil {
+			return err
+		}
+		if statErr == nil {
+			s.bytes.Add(fi.Size())
+		}
+		return nil
+	}
+}
+
+// message returns the summary line, with the number of skipped files of the run
+func (s *runSummary) message(skipped int) string {
+	return fmt.Sprintf("Summary: %d files processed, %d skipped, %d non-media, %d errors, %s %s",
+		s.processed.Load(), skipped, s.nonMedia.Load(), s.errors.Load(), formatBytes(s.bytes.Load()), s.action)
+}
+
+// printSummary shows the results of the run, even in quiet mode
+func (m *MediaSorter) printSummary() {
+	if m.summary == nil {
+		return
+	}
+	m.mu.Lock()
+	skipped := 0
+	for _, count := range m.skipped {
+		skipped += count
+	}
+	m.mu.Unlock()
+	m.OutputWriter.Print(m.summary.message(skipped))
+}
+
+// formatBytes formats a number of bytes with binary units, like "1.5 MiB"
+func formatBytes(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	value := float64(bytes) / unit
+	units := []string{"KiB", "MiB", "GiB", "TiB"}
+	i := 0
+	for value >= unit && i < len(units)-1 {
+		value /= unit
+		i++
+	}
+	return fmt.Sprintf("%.1f %s", value, units[i])
+}
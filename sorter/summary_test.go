@@ -0,0 +1,103 @@
+package sorter
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunShowsSummaryInQuietMode(t *testing.T) {
+	srcDir := t.TempDir()
+	destDir := t.TempDir()
+	one := flacStream("TITLE=One", "ARTIST=Artist", "ALBUM=Album")
+	files := map[string][]byte{
+		"one.flac":  one,
+		"one.cue":   []byte("cue sheet"),
+		"two.flac":  flacStream("TITLE=Two", "ARTIST=Artist", "ALBUM=Album"),
+		"notes.txt": []byte("notes"),
+		"cover.jpg": []byte("image"),
+	}
+	writeSourceFiles(t, srcDir, files)
+	existing := filepath.Join(destDir, "Artist", "Album", "Two.flac")
+	if err := os.MkdirAll(filepath.Dir(existing), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(existing, []byte("existing"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var output bytes.Buffer
+	var errOutput bytes.Buffer
+	mediaSorter, err := New(&Config{DestDir: destDir, OnExists: SkipExisting, Summary: true, Verbosity: Quiet, Output: &output, ErrOutput: &errOutput})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	if err := mediaSorter.Run(srcDir); err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+
+	copiedBytes := len(one) + len("cue sheet")
+	expected := fmt.Sprintf("Summary: 1 files processed, 1 skipped, 2 non-media, 0 errors, %d B copied\n", copiedBytes)
+	if output.String() != expected {
+		t.Errorf("Expected output '%s' but got '%s'", expected, output.String())
+	}
+	if strings.Contains(errOutput.String(), "Summary:") {
+		t.Errorf("Expected the summary only in the output, got warnings '%s'", errOutput.String())
+	}
+}
+
+func TestRunShowsSummaryForSingleFile(t *testing.T) {
+	srcDir := t.TempDir()
+	track := flacStream("TITLE=Track", "ARTIST=Artist", "ALBUM=Album")
+	writeSourceFiles(t, srcDir, map[string][]byte{
+		"track.flac": track,
+		"notes.txt":  []byte("notes"),
+	})
+
+	tests := []struct {
+		description string
+		file        string
+		expected    string
+	}{
+		{"media file", "track.flac", fmt.Sprintf("Summary: 1 files processed, 0 skipped, 0 non-media, 0 errors, %d B copied\n", len(track))},
+		{"non-media file", "notes.txt", "Summary: 0 files processed, 0 skipped, 1 non-media, 0 errors, 0 B copied\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			var output bytes.Buffer
+			mediaSorter, err := New(&Config{DestDir: t.TempDir(), Summary: true, Verbosity: Quiet, Output: &output, ErrOutput: io.Discard})
+			if err != nil {
+				t.Fatalf("New returned error: %v", err)
+			}
+			_ = mediaSorter.Run(filepath.Join(srcDir, test.file))
+			if output.String() != test.expected {
+				t.Errorf("Expected output '%s' but got '%s'", test.expected, output.String())
+			}
+		})
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		bytes    int64
+		expected string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1024, "1.0 KiB"},
+		{1536, "1.5 KiB"},
+		{5 * 1024 * 1024, "5.0 MiB"},
+		{3 * 1024 * 1024 * 1024 * 1024 * 1024, "3072.0 TiB"},
+	}
+	for _, test := range tests {
+		t.Run(test.expected, func(t *testing.T) {
+			if actual := formatBytes(test.bytes); actual != test.expected {
+				t.Errorf("Expected '%s' but got '%s'", test.expected, actual)
+			}
+		})
+	}
+}
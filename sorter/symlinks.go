@@ -0,0 +1,40 @@
+package sorter
+
+import (
+	"os"
+)
+
+// visitedDirs remembers the directories of a walk that follows symbolic links,
+// so that links to a parent directory don't lead into an endless loop
+type visitedDirs struct {
+	ids map[fileID]bool
+	// Directories on platforms without file IDs, compared with os.SameFile
+	infos []os.FileInfo
+}
+
+func newVisitedDirs() *visitedDirs {
+	return &visitedDirs{ids: make(map[fileID]bool)}
+}
+
+// visit marks the directory as visited. It returns false if the walk already visited the directory,
+// through another link or its real path.
+func (v *visitedDirs) visit(path string) (bool, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+	if id, ok := fileIDOf(info); ok {
+		if v.ids[id] {
+			return false, nil
+		}
+		v.ids[id] = true
+		return true, nil
+	}
+	for _, visited := range v.infos {
+		if os.SameFile(visited, info) {
+			return false, nil
+		}
+	}
+	v.infos = append(v.infos, info)
+	return true, nil
+}
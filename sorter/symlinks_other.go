@@ -0,0 +1,22 @@
+//go:build !windows
+
+package sorter
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileID identifies a file by its device and inode number
+type fileID struct {
+	dev uint64
+	ino uint64
+}
+
+func fileIDOf(info os.FileInfo) (fileID, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fileID{}, false
+	}
+	return fileID{dev: uint64(stat.Dev), ino: uint64(stat.Ino)}, true
+}
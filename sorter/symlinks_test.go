@@ -0,0 +1,71 @@
+package sorter
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunFollowsSymlinkedDirectoriesOnlyWithFlag(t *testing.T) {
+	srcDir := t.TempDir()
+	externalDir := t.TempDir()
+	writeSourceFiles(t, srcDir, map[string][]byte{"Album/local.flac": flacStream("TITLE=Local", "ARTIST=Artist", "ALBUM=Album")})
+	writeSourceFiles(t, externalDir, map[string][]byte{"Disk/linked.flac": flacStream("TITLE=Linked", "ARTIST=Artist", "ALBUM=Album")})
+	if err := os.Symlink(filepath.Join(externalDir, "Disk"), filepath.Join(srcDir, "Linked")); err != nil {
+		t.Skipf("Can't create symbolic links: %v", err)
+	}
+	// A link to the source directory would lead into an endless loop
+	if err := os.Symlink(srcDir, filepath.Join(srcDir, "Album", "Loop")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		description    string
+		followSymlinks bool
+		expectLinked   bool
+	}{
+		{"ignores linked directories by default", false, false},
+		{"follows linked directories", true, true},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			destDir := t.TempDir()
+			mediaSorter, err := New(&Config{DestDir: destDir, FollowSymlinks: test.followSymlinks, Output: io.Discard})
+			if err != nil {
+				t.Fatalf("New returned error: %v", err)
+			}
+			if err := mediaSorter.Run(srcDir); err != nil {
+				t.Fatalf("Run returned error: %v", err)
+			}
+
+			albumDir := filepath.Join(destDir, "Artist", "Album")
+			if _, err := os.Stat(filepath.Join(albumDir, "Local.flac")); err != nil {
+				t.Errorf("Expected file from the source directory: %v", err)
+			}
+			_, err = os.Stat(filepath.Join(albumDir, "Linked.flac"))
+			if test.expectLinked && err != nil {
+				t.Errorf("Expected file from the linked directory: %v", err)
+			}
+			if !test.expectLinked && !os.IsNotExist(err) {
+				t.Errorf("Expected linked directory to be ignored, got %v", err)
+			}
+		})
+	}
+}
+
+func TestVisitedDirsDetectsLinksToVisitedDirectories(t *testing.T) {
+	dir := t.TempDir()
+	link := filepath.Join(t.TempDir(), "link")
+	if err := os.Symlink(dir, link); err != nil {
+		t.Skipf("Can't create symbolic links: %v", err)
+	}
+
+	visited := newVisitedDirs()
+	if first, err := visited.visit(dir); err != nil || !first {
+		t.Errorf("Expected first visit of %s, got %v, %v", dir, first, err)
+	}
+	if first, err := visited.visit(link + string(filepath.Separator)); err != nil || first {
+		t.Errorf("Expected link to be detected as visited directory, got %v, %v", first, err)
+	}
+}
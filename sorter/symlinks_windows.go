@@ -0,0 +1,12 @@
+//go:build windows
+
+package sorter
+
+import "os"
+
+// fileID is empty on Windows, because os.Stat doesn't return the file index. visitedDirs uses os.SameFile instead.
+type fileID struct{}
+
+func fileIDOf(info os.FileInfo) (fileID, bool) {
+	return fileID{}, false
+}
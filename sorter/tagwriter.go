@@ -0,0 +1,380 @@
+package sorter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/dhowden/tag"
+)
+
+// ErrTagWritingNotSupported occurs when the tool can't write tags into a file type or tag version
+var ErrTagWritingNotSupported = errors.New("writing tags is not supported")
+
+// writeTextTag sets a custom text tag of a media file, replacing the tags with the same name.
+// FLAC files get a Vorbis comment, MP3 files a user defined ID3 text frame (TXXX).
+func writeTextTag(path string, fileType tag.FileType, name string, value string) error {
+	switch fileType {
+	case tag.FLAC:
+		return rewriteFile(path, func(r io.ReadSeeker, w io.Writer) error {
+			return writeFLACComment(r, w, name, value)
+		})
+	case tag.MP3:
+		return rewriteFile(path, func(r io.ReadSeeker, w io.Writer) error {
+			return writeID3UserText(r, w, name, value)
+		})
+	}
+	return fmt.Errorf("%w for %s files", ErrTagWritingNotSupported, fileType)
+}
+
+// rewriteFile writes a changed copy of the file next to it and replaces the file with the copy,
+// so the file stays complete when writing fails
+func rewriteFile(path string, rewrite func(r io.ReadSeeker, w io.Writer) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("error opening file %s: %w", path, err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("error reading file information of %s: %w", path, err)
+	}
+
+	tmpFile, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("error creating temporary file for %s: %w", path, err)
+	}
+	tmpPath := tmpFile.Name()
+	err = rewrite(f, tmpFile)
+	if err == nil {
+		err = tmpFile.Chmod(info.Mode().Perm())
+	}
+	if err == nil {
+		err = tmpFile.Sync()
+	}
+	if closeErr := tmpFile.Close(); closeErr != nil && err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("error writing tags of %s: %w", path, err)
+	}
+	return nil
+}
+
+// flacBlock is a metadata block of a FLAC stream
+type flacBlock struct {
+	blockType byte
+	data      []byte
+}
+
+// Types of FLAC metadata blocks
+const (
+	flacStreamInfoBlock    = 0
+	flacVorbisCommentBlock = 4
+)
+
+// writeFLACComment copies a FLAC stream, with the comment name=value instead of the comments with the same name.
+// It keeps an ID3 tag before the stream.
+func writeFLACComment(r io.ReadSeeker, w io.Writer, name string, value string) error {
+	offset, err := findFLACAfterID3(r)
+	if err != nil {
+		return err
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	// The ID3 tag before the stream and the marker
+	prefix := make([]byte, offset+4)
+	if _, err := io.ReadFull(r, prefix); err != nil || string(prefix[offset:]) != "fLaC" {
+		return errors.New("not a FLAC stream")
+	}
+
+	var blocks []flacBlock
+	for last := false; !last; {
+		header := make([]byte, 4)
+		if _, err := io.ReadFull(r, header); err != nil {
+			return fmt.Errorf("error reading FLAC metadata: %w", err)
+		}
+		last = header[0]&0x80 != 0
+		block := flacBlock{blockType: header[0] & 0x7f, data: make([]byte, int(header[1])<<16|int(header[2])<<8|int(header[3]))}
+		if _, err := io.ReadFull(r, block.data); err != nil {
+			return fmt.Errorf("error reading FLAC metadata: %w", err)
+		}
+		blocks = append(blocks, block)
+	}
+
+	commentIndex := -1
+	for i, block := range blocks {
+		if block.blockType == flacVorbisCommentBlock {
+			commentIndex = i
+			break
+		}
+	}
+	var comments []byte
+	if commentIndex == -1 {
+		comments, err = setVorbisComment(nil, name, value)
+		// The STREAMINFO block must stay the first block
+		commentIndex = min(1, len(blocks))
+		blocks = slices.Insert(blocks, commentIndex, flacBlock{})
+	} else {
+		comments, err = setVorbisComment(blocks[commentIndex].data, name, value)
+	}
+	if err != nil {
+		return err
+	}
+	if len(comments) >= 1<<24 {
+		return errors.New("FLAC comments are too long")
+	}
+	blocks[commentIndex] = flacBlock{blockType: flacVorbisCommentBlock, data: comments}
+
+	var buf bytes.Buffer
+	buf.Write(prefix)
+	for i, block := range blocks {
+		header := block.blockType
+		if i == len(blocks)-1 {
+			header |= 0x80
+		}
+		size := len(block.data)
+		buf.Write([]byte{header, byte(size >> 16), byte(size >> 8), byte(size)})
+		buf.Write(block.data)
+	}
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	// The audio frames follow the metadata blocks
+	_, err = io.Copy(w, r)
+	return err
+}
+
+// setVorbisComment returns the Vorbis comment block with name=value instead of the comments with the same name.
+// An empty block gets the vendor "mediasorter".
+func setVorbisComment(block []byte, name string, value string) ([]byte, error) {
+	vendor := "mediasorter"
+	var comments []string
+	if block != nil {
+		reader := bytes.NewReader(block)
+		readString := func() (string, error) {
+			var length uint32
+			if err := binary.Read(reader, binary.LittleEndian, &length); err != nil {
+				return "", err
+			}
+			if int64(length) > int64(reader.Len()) {
+				return "", io.ErrUnexpectedEOF
+			}
+			text := make([]byte, length)
+			_, err := io.ReadFull(reader, text)
+			return string(text), err
+		}
+		var err error
+		if vendor, err = readString(); err != nil {
+			return nil, fmt.Errorf("error reading Vorbis comments: %w", err)
+		}
+		var count uint32
+		if err := binary.Read(reader, binary.LittleEndian, &count); err != nil {
+			return nil, fmt.Errorf("error reading Vorbis comments: %w", err)
+		}
+		for range count {
+			comment, err := readString()
+			if err != nil {
+				return nil, fmt.Errorf("error reading Vorbis comments: %w", err)
+			}
+			commentName, _, _ := strings.Cut(comment, "=")
+			if !strings.EqualFold(commentName, name) {
+				comments = append(comments, comment)
+			}
+		}
+	}
+	comments = append(comments, name+"="+value)
+
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, uint32(len(vendor)))
+	buf.WriteString(vendor)
+	binary.Write(&buf, binary.LittleEndian, uint32(len(comments)))
+	for _, comment := range comments {
+		binary.Write(&buf, binary.LittleEndian, uint32(len(comment)))
+		buf.WriteString(comment)
+	}
+	return buf.Bytes(), nil
+}
+
+// ID3v2 header flags that change how the frames are stored
+const (
+	id3Unsynchronisation = 0x80
+	id3ExtendedHeader    = 0x40
+	id3Footer            = 0x10
+)
+
+// writeID3UserText copies an MP3 file, with a user defined text frame (TXXX) with the description and value
+// instead of the frames with the same description. Files without ID3v2 tag get an ID3v2.4 tag.
+// It only writes ID3v2.3 and ID3v2.4 tags without unsynchronisation and extended header.
+func writeID3UserText(r io.ReadSeeker, w io.Writer, description string, value string) error {
+	header := make([]byte, id3v2HeaderSize)
+	_, err := io.ReadFull(r, header)
+	hasTag := err == nil && string(header[0:3]) == "ID3"
+	var frames []byte
+	version := byte(4)
+	if hasTag {
+		version = header[3]
+		if version != 3 && version != 4 {
+			return fmt.Errorf("%w for ID3v2.%d tags", ErrTagWritingNotSupported, version)
+		}
+		if header[5]&(id3Unsynchronisation|id3ExtendedHeader|id3Footer) != 0 {
+			return fmt.Errorf("%w for ID3 tags with unsynchronisation, extended header or footer", ErrTagWritingNotSupported)
+		}
+		body := make([]byte, synchsafe(header[6:10]))
+		if _, err := io.ReadFull(r, body); err != nil {
+			return fmt.Errorf("error reading ID3 tag: %w", err)
+		}
+		if frames, err = removeID3UserText(body, version, description); err != nil {
+			return err
+		}
+	} else if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	frame := id3UserTextFrame(version, description, value)
+	frames = append(frames, frame...)
+	var buf bytes.Buffer
+	buf.WriteString("ID3")
+	buf.Write([]byte{version, 0, 0})
+	buf.Write(synchsafeBytes(len(frames)))
+	buf.Write(frames)
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	// The audio frames and an ID3v1 tag follow the ID3v2 tag
+	_, err = io.Copy(w, r)
+	return err
+}
+
+// removeID3UserText returns the frames of the tag body without padding and without the TXXX frames with the description
+func removeID3UserText(body []byte, version byte, description string) ([]byte, error) {
+	var frames []byte
+	for pos := 0; pos+10 <= len(body) && body[pos] != 0; {
+		size := int(binary.BigEndian.Uint32(body[pos+4 : pos+8]))
+		if version == 4 {
+			size = synchsafe(body[pos+4 : pos+8])
+		}
+		end := pos + 10 + size
+		if end > len(body) {
+			return nil, errors.New("error reading ID3 tag: frame is longer than the tag")
+		}
+		frame := body[pos:end]
+		if string(frame[0:4]) != "TXXX" || !strings.EqualFold(id3UserTextDescription(frame[10:]), description) {
+			frames = append(frames, frame...)
+		}
+		pos = end
+	}
+	return frames, nil
+}
+
+// id3UserTextDescription returns the description of the content of a TXXX frame
+func id3UserTextDescription(content []byte) string {
+	if len(content) == 0 {
+		return ""
+	}
+	encoding, text := content[0], content[1:]
+	switch encoding {
+	case 1, 2:
+		var units []uint16
+		order := binary.ByteOrder(binary.BigEndian)
+		for i := 0; i+1 < len(text); i += 2 {
+			unit := binary.BigEndian.Uint16(text[i:])
+			if i == 0 && encoding == 1 && (unit == 0xfffe || unit == 0xfeff) {
+				if unit == 0xfffe {
+					order = binary.LittleEndian
+				}
+				continue
+			}
+			unit = order.Uint16(text[i:])
+			if unit == 0 {
+				break
+			}
+			units = append(units, unit)
+		}
+		return string(utf16.Decode(units))
+	case 3:
+		description, _, _ := bytes.Cut(text, []byte{0})
+		return string(description)
+	}
+	description, _, _ := bytes.Cut(text, []byte{0})
+	runes := make([]rune, len(description))
+	for i, b := range description {
+		runes[i] = rune(b)
+	}
+	return string(runes)
+}
+
+// id3UserTextFrame returns a TXXX frame. ID3v2.4 frames use UTF-8, ID3v2.3 frames use ISO-8859-1
+// for text that fits and UTF-16 for other text.
+func id3UserTextFrame(version byte, description string, value string) []byte {
+	var content bytes.Buffer
+	switch {
+	case version == 4:
+		content.WriteByte(3)
+		content.WriteString(description)
+		content.WriteByte(0)
+		content.WriteString(value)
+	case isLatin1(description + value):
+		content.WriteByte(0)
+		for _, r := range description {
+			content.WriteByte(byte(r))
+		}
+		content.WriteByte(0)
+		for _, r := range value {
+			content.WriteByte(byte(r))
+		}
+	default:
+		content.WriteByte(1)
+		for i, text := range []string{description, value} {
+			if i > 0 {
+				content.Write([]byte{0, 0})
+			}
+			content.Write([]byte{0xff, 0xfe})
+			for _, unit := range utf16.Encode([]rune(text)) {
+				binary.Write(&content, binary.LittleEndian, unit)
+			}
+		}
+	}
+
+	var frame bytes.Buffer
+	frame.WriteString("TXXX")
+	if version == 4 {
+		frame.Write(synchsafeBytes(content.Len()))
+	} else {
+		binary.Write(&frame, binary.BigEndian, uint32(content.Len()))
+	}
+	frame.Write([]byte{0, 0})
+	frame.Write(content.Bytes())
+	return frame.Bytes()
+}
+
+func isLatin1(text string) bool {
+	for _, r := range text {
+		if r > 0xff || r == utf8.RuneError {
+			return false
+		}
+	}
+	return true
+}
+
+// synchsafe decodes an integer that uses only 7 bits of each byte
+func synchsafe(b []byte) int {
+	return int(b[0]&0x7f)<<21 | int(b[1]&0x7f)<<14 | int(b[2]&0x7f)<<7 | int(b[3]&0x7f)
+}
+
+func synchsafeBytes(size int) []byte {
+	return []byte{byte(size >> 21 & 0x7f), byte(size >> 14 & 0x7f), byte(size >> 7 & 0x7f), byte(size & 0x7f)}
+}
@@ -0,0 +1,161 @@
+package sorter
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dhowden/tag"
+)
+
+func TestWriteTextTag(t *testing.T) {
+	audio := []byte("audio frames")
+	streamInfoOnly := append([]byte("fLaC\x80\x00\x00\x22"), make([]byte, 34)...)
+	tests := []struct {
+		description string
+		fileType    tag.FileType
+		data        []byte
+		title       string
+	}{
+		{"FLAC", tag.FLAC, flacStreamWithInfo(44100, 16, "TITLE=Title", "MEDIASORTER=v0"), "Title"},
+		{"FLAC without comments", tag.FLAC, streamInfoOnly, ""},
+		{"FLAC with prepended ID3 tag", tag.FLAC, append(id3Tag("ID3 Title"), flacStream("TITLE=Title")...), "Title"},
+		{"MP3 with ID3v2.3 tag", tag.MP3, id3Tag("Title"), "Title"},
+		{"MP3 without ID3v2 tag", tag.MP3, []byte{0xff, 0xfb, 0x90, 0x00}, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "track")
+			if err := os.WriteFile(path, append(test.data, audio...), 0640); err != nil {
+				t.Fatal(err)
+			}
+			// Writing twice replaces the first tag
+			for _, marker := range []string{"v1", "v2"} {
+				if err := writeTextTag(path, test.fileType, "MEDIASORTER", marker); err != nil {
+					t.Fatalf("writeTextTag returned error: %v", err)
+				}
+			}
+
+			reader := &MetaDataReader{OutputWriter: &OutputWriter{Verbosity: Quiet, Writer: io.Discard}}
+			metadata, err := reader.ReadMetadata(MediaFile(path))
+			if err != nil {
+				t.Fatalf("ReadMetadata returned error: %v", err)
+			}
+			if metadata.Marker != "v2" || metadata.Title != test.title || metadata.FileType != test.fileType {
+				t.Errorf("Expected marker 'v2', title '%s' and type %s, got '%s', '%s' and %s", test.title, test.fileType, metadata.Marker, metadata.Title, metadata.FileType)
+			}
+			content, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.HasSuffix(content, audio) {
+				t.Error("Expected the audio frames to stay at the end of the file")
+			}
+			if count := bytes.Count(content, []byte("MEDIASORTER")); count != 1 {
+				t.Errorf("Expected one marker tag, got %d", count)
+			}
+			if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0640 {
+				t.Errorf("Expected the permissions of the file to be kept, got %v", info.Mode())
+			}
+		})
+	}
+}
+
+func TestWriteTextTagKeepsStreamInfo(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "track.flac")
+	if err := os.WriteFile(path, flacStreamWithInfo(96000, 24, "TITLE=Title"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeTextTag(path, tag.FLAC, "MEDIASORTER", "v1"); err != nil {
+		t.Fatalf("writeTextTag returned error: %v", err)
+	}
+	reader := &MetaDataReader{OutputWriter: &OutputWriter{Verbosity: Quiet, Writer: io.Discard}}
+	metadata, err := reader.ReadMetadata(MediaFile(path))
+	if err != nil {
+		t.Fatalf("ReadMetadata returned error: %v", err)
+	}
+	if metadata.SampleRate != 96000 || metadata.BitDepth != 24 {
+		t.Errorf("Expected the STREAMINFO block to stay first, got %d Hz and %d bits", metadata.SampleRate, metadata.BitDepth)
+	}
+}
+
+func TestWriteTextTagRejectsOtherFileTypes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "track.ogg")
+	if err := os.WriteFile(path, []byte("OggS"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeTextTag(path, tag.OGG, "MEDIASORTER", "v1"); !errors.Is(err, ErrTagWritingNotSupported) {
+		t.Errorf("Expected ErrTagWritingNotSupported, got %v", err)
+	}
+	if content, _ := os.ReadFile(path); string(content) != "OggS" {
+		t.Errorf("Expected the file to stay unchanged, got %q", content)
+	}
+}
+
+func TestRunWritesMarkerIntoDestination(t *testing.T) {
+	srcDir := t.TempDir()
+	destDir := filepath.Join(t.TempDir(), "sorted")
+	writeSourceFiles(t, srcDir, map[string][]byte{
+		"one.flac": flacStream("TITLE=One", "ARTIST=Artist", "ALBUM=Album"),
+		"two.mp3":  id3Tag("Two"),
+	})
+
+	mediaSorter, err := New(&Config{DestDir: destDir, WriteMarker: "v1", Output: io.Discard})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	if err := mediaSorter.Run(srcDir); err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+
+	reader := &MetaDataReader{OutputWriter: &OutputWriter{Verbosity: Quiet, Writer: io.Discard}}
+	for _, path := range []string{filepath.Join(destDir, "Artist", "Album", "One.flac"), filepath.Join(destDir, "Unknown Artist", "Unknown Album", "Two.mp3")} {
+		metadata, err := reader.ReadMetadata(MediaFile(path))
+		if err != nil {
+			t.Fatalf("ReadMetadata returned error: %v", err)
+		}
+		if metadata.Marker != "v1" {
+			t.Errorf("Expected marker 'v1' in %s, got '%s'", path, metadata.Marker)
+		}
+	}
+	metadata, err := reader.ReadMetadata(MediaFile(filepath.Join(srcDir, "one.flac")))
+	if err != nil {
+		t.Fatalf("ReadMetadata returned error: %v", err)
+	}
+	if metadata.Marker != "" {
+		t.Errorf("Expected the source to stay without marker, got '%s'", metadata.Marker)
+	}
+
+	// The next run skips the marked files
+	mediaSorter, err = New(&Config{DestDir: t.TempDir(), SkipMarker: "v1", ReportSkipsAsErrors: true, Output: io.Discard})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	if err := mediaSorter.Run(destDir); err == nil || err.Error() != "skipped 2 files (2 already-sorted)" {
+		t.Errorf("Expected the marked files to be skipped, got %v", err)
+	}
+}
+
+func TestWriteTextTagUsesUTF16InID3v23(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "track.mp3")
+	if err := os.WriteFile(path, id3Tag("Title"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, marker := range []string{"€1", "€2"} {
+		if err := writeTextTag(path, tag.MP3, "MEDIASORTER", marker); err != nil {
+			t.Fatalf("writeTextTag returned error: %v", err)
+		}
+	}
+	reader := &MetaDataReader{OutputWriter: &OutputWriter{Verbosity: Quiet, Writer: io.Discard}}
+	metadata, err := reader.ReadMetadata(MediaFile(path))
+	if err != nil {
+		t.Fatalf("ReadMetadata returned error: %v", err)
+	}
+	if metadata.Marker != "€2" {
+		t.Errorf("Expected marker '€2', got '%s'", metadata.Marker)
+	}
+}
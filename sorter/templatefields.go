@@ -0,0 +1,207 @@
+package sorter
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+type EmptyFieldError struct {
+	srcPath string
+	fields  []string
+}
+
+func (err *EmptyFieldError) Error() string {
+	return fmt.Sprintf("Template fields %s are empty for file %s, skipping", strings.Join(err.fields, ", "), err.srcPath)
+}
+
+func (err *EmptyFieldError) Is(target error) bool {
+	return target == ErrMissingField
+}
+
+// templateFields returns the names of all top-level fields referenced in a template, in order of appearance
+func templateFields(t *template.Template) []string {
+	var fields []string
+	seen := make(map[string]struct{})
+	for _, tpl := range t.Templates() {
+		if tpl.Tree == nil {
+			continue
+		}
+		collectFields(tpl.Tree.Root, func(name string) {
+			if _, exists := seen[name]; exists {
+				return
+			}
+			seen[name] = struct{}{}
+			fields = append(fields, name)
+		})
+	}
+	return fields
+}
+
+func collectFields(node parse.Node, add func(string)) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			collectFields(child, add)
+		}
+	case *parse.ActionNode:
+		collectFields(n.Pipe, add)
+	case *parse.IfNode:
+		collectBranchFields(&n.BranchNode, add)
+	case *parse.RangeNode:
+		collectBranchFields(&n.BranchNode, add)
+	case *parse.WithNode:
+		collectBranchFields(&n.BranchNode, add)
+	case *parse.TemplateNode:
+		collectFields(n.Pipe, add)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, cmd := range n.Cmds {
+			collectFields(cmd, add)
+		}
+	case *parse.CommandNode:
+		for _, arg := range n.Args {
+			collectFields(arg, add)
+		}
+	case *parse.ChainNode:
+		collectFields(n.Node, add)
+	case *parse.FieldNode:
+		if len(n.Ident) > 0 {
+			add(n.Ident[0])
+		}
+	}
+}
+
+func collectBranchFields(n *parse.BranchNode, add func(string)) {
+	collectFields(n.Pipe, add)
+	collectFields(n.List, add)
+	collectFields(n.ElseList, add)
+}
+
+// unknownFields returns the names of the given fields that Metadata doesn't have, like misspelled fields.
+// Checking the names finds them even in template branches that no example metadata executes.
+func unknownFields(fields []string) []string {
+	var unknown []string
+	metadataType := reflect.TypeFor[*Metadata]()
+	for _, name := range fields {
+		_, isField := metadataType.Elem().FieldByName(name)
+		_, isMethod := metadataType.MethodByName(name)
+		if !isField && !isMethod {
+			unknown = append(unknown, "."+name)
+		}
+	}
+	return unknown
+}
+
+// emptyFields returns the names of the given fields that have a zero value in the metadata
+func emptyFields(metadata *Metadata, fields []string) []string {
+	var empty []string
+	value := reflect.ValueOf(metadata).Elem()
+	for _, name := range fields {
+		field := value.FieldByName(name)
+		if field.IsValid() && field.IsZero() {
+			empty = append(empty, name)
+		}
+	}
+	return empty
+}
+
+// renderedEmptyFields returns the names of the fields that have a zero value in the metadata and reach
+// the rendered path. It only follows the branches of if actions that the metadata takes and ignores
+// the fields of their conditions. The fields of an action only count when they are zero and the action
+// renders them directly or renders an empty text, e.g. not `or .AlbumArtist .Artist` with an artist.
+// Other actions, like with and range, count all their fields.
+func renderedEmptyFields(pathTemplate *template.Template, metadata *Metadata, origName string) ([]string, error) {
+	probe, metadata, err := preparePathTemplate(pathTemplate, metadata, origName)
+	if err != nil {
+		return nil, err
+	}
+	checker := &renderedFieldChecker{probe: probe, metadata: metadata, seen: make(map[string]struct{})}
+	if probe.Tree != nil {
+		checker.walk(probe.Tree.Root)
+	}
+	return emptyFields(metadata, checker.fields), nil
+}
+
+// renderedFieldChecker collects the fields of the actions that reach the rendered path
+type renderedFieldChecker struct {
+	probe    *template.Template
+	metadata *Metadata
+	fields   []string
+	seen     map[string]struct{}
+}
+
+func (c *renderedFieldChecker) add(name string) {
+	if _, exists := c.seen[name]; exists {
+		return
+	}
+	c.seen[name] = struct{}{}
+	c.fields = append(c.fields, name)
+}
+
+func (c *renderedFieldChecker) walk(node parse.Node) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			c.walk(child)
+		}
+	case *parse.TextNode:
+	case *parse.ActionNode:
+		// Assignments don't render anything
+		if len(n.Pipe.Decl) > 0 {
+			return
+		}
+		text, err := c.render("{{ " + n.Pipe.String() + " }}")
+		if err != nil || strings.TrimSpace(text) == "" || isFieldPipe(n.Pipe) {
+			collectFields(n, c.add)
+		}
+	case *parse.IfNode:
+		taken, err := c.render("{{ if " + n.Pipe.String() + " }}1{{ end }}")
+		if err != nil {
+			// Actions that use variables can't be rendered on their own, check both branches
+			c.walk(n.List)
+			c.walk(n.ElseList)
+			return
+		}
+		if taken == "1" {
+			c.walk(n.List)
+		} else {
+			c.walk(n.ElseList)
+		}
+	default:
+		collectFields(n, c.add)
+	}
+}
+
+// render renders a part of the template with the metadata
+func (c *renderedFieldChecker) render(text string) (string, error) {
+	part, err := c.probe.New("part").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var buffer bytes.Buffer
+	if err := part.Execute(&buffer, c.metadata); err != nil {
+		return "", err
+	}
+	return buffer.String(), nil
+}
+
+// isFieldPipe returns true if the pipeline only renders a field, like {{ .Track }}
+func isFieldPipe(pipe *parse.PipeNode) bool {
+	if len(pipe.Cmds) != 1 || len(pipe.Cmds[0].Args) != 1 {
+		return false
+	}
+	_, isField := pipe.Cmds[0].Args[0].(*parse.FieldNode)
+	return isField
+}
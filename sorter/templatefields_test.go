@@ -0,0 +1,151 @@
+package sorter
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"text/template"
+)
+
+func TestTemplateFields(t *testing.T) {
+	tests := []struct {
+		description string
+		template    string
+		expected    []string
+	}{
+		{"no fields", "static", nil},
+		{"single field", "{{ .Title }}", []string{"Title"}},
+		{"fields are unique", "{{ .Title }} {{ .Title }}", []string{"Title"}},
+		{"fields in functions", `{{ or .AlbumArtist .Artist }}`, []string{"AlbumArtist", "Artist"}},
+		{"fields in pipelines", `{{ .Title | printf "%s" }}`, []string{"Title"}},
+		{"fields in conditions and branches", `{{ if .Track }}{{ .Track }}{{ else }}{{ .Disc }}{{ end }}`, []string{"Track", "Disc"}},
+		{"fields in with blocks", `{{ with .Album }}{{ . }}{{ end }}`, []string{"Album"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			tpl := template.Must(template.New("test").Parse(test.template))
+			actual := templateFields(tpl)
+			if !reflect.DeepEqual(actual, test.expected) {
+				t.Errorf("templateFields(%q) = %v; want %v", test.template, actual, test.expected)
+			}
+		})
+	}
+}
+
+func TestEmptyFields(t *testing.T) {
+	metadata := &Metadata{Title: "Title", Track: 0, Year: 1999}
+	actual := emptyFields(metadata, []string{"Title", "Artist", "Track", "Year", "Unknown"})
+	expected := []string{"Artist", "Track"}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("emptyFields() = %v; want %v", actual, expected)
+	}
+}
+
+func TestRenderedEmptyFields(t *testing.T) {
+	tests := []struct {
+		description string
+		template    string
+		metadata    Metadata
+		expected    []string
+	}{
+		{"rendered field", "{{ .Artist }}/{{ .Title }}", Metadata{Title: "Title"}, []string{"Artist"}},
+		{"rendered number", "{{ .Track }}", Metadata{}, []string{"Track"}},
+		{"alternative with value", "{{ or .AlbumArtist .Artist }}", Metadata{Artist: "Artist"}, nil},
+		{"alternatives without value", "{{ or .AlbumArtist .Artist }}", Metadata{}, []string{"AlbumArtist", "Artist"}},
+		{"condition", `{{ if .HasTrack }}{{ printf "%02d" .Track }}{{ end }}{{ .Title }}`, Metadata{Title: "Title"}, nil},
+		{"taken branch", `{{ if .Album }}{{ .Album }}{{ else }}{{ .Genre }}{{ end }}`, Metadata{}, []string{"Genre"}},
+		{"empty function result", "{{ .Album | lower }}", Metadata{}, []string{"Album"}},
+		{"with block", "{{ with .Album }}{{ . }}{{ end }}", Metadata{}, []string{"Album"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			tpl := template.Must(template.New("test").Funcs(template.FuncMap{"lower": strings.ToLower, "origName": func() string { return "" }}).Parse(test.template))
+			actual, err := renderedEmptyFields(tpl, &test.metadata, "track")
+			if err != nil {
+				t.Fatalf("renderedEmptyFields returned error: %v", err)
+			}
+			if !reflect.DeepEqual(actual, test.expected) {
+				t.Errorf("renderedEmptyFields(%q) = %v; want %v", test.template, actual, test.expected)
+			}
+		})
+	}
+}
+
+func TestRunWithStrictTemplateUsesRenderedFieldsOfDefaultTemplate(t *testing.T) {
+	srcDir := t.TempDir()
+	writeSourceFiles(t, srcDir, map[string][]byte{
+		"complete.flac":   flacStream("TITLE=Complete", "ARTIST=Artist", "ALBUM=Album"),
+		"incomplete.flac": flacStream("TITLE=Incomplete", "ARTIST=Artist"),
+	})
+	destDir := filepath.Join(t.TempDir(), "sorted")
+
+	mediaSorter, err := New(&Config{DestDir: destDir, StrictTemplate: true, Output: io.Discard, ErrOutput: io.Discard})
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+	if err := mediaSorter.Run(srcDir); err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(destDir, "Artist", "Album", "Complete.flac")); err != nil {
+		t.Errorf("Expected file without album artist and track number to be sorted: %v", err)
+	}
+	if mediaSorter.skipped[SkipMissingField] != 1 {
+		t.Errorf("Expected 1 skipped file with empty fields, got %d", mediaSorter.skipped[SkipMissingField])
+	}
+}
+
+func TestRunWithStrictTemplateSkipsFilesWithEmptyFields(t *testing.T) {
+	tests := []struct {
+		description   string
+		strict        bool
+		expected      []string
+		notExpected   []string
+		expectedSkips int
+	}{
+		{"strict", true, []string{"Artist/Album/Complete.flac"}, []string{"Artist/Unknown Album/Incomplete.flac"}, 1},
+		{"not strict", false, []string{"Artist/Album/Complete.flac", "Artist/Unknown Album/Incomplete.flac"}, nil, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			srcDir := t.TempDir()
+			writeSourceFiles(t, srcDir, map[string][]byte{
+				"complete.flac":   flacStream("TITLE=Complete", "ARTIST=Artist", "ALBUM=Album"),
+				"incomplete.flac": flacStream("TITLE=Incomplete", "ARTIST=Artist"),
+			})
+			templatePath := filepath.Join(t.TempDir(), "template.txt")
+			if err := os.WriteFile(templatePath, []byte("{{ .Artist }}/{{ .Album }}/{{ .Title }}"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			destDir := filepath.Join(t.TempDir(), "sorted")
+
+			mediaSorter, err := New(&Config{DestDir: destDir, Template: templatePath, StrictTemplate: test.strict, Output: io.Discard, ErrOutput: io.Discard})
+			if err != nil {
+				t.Fatalf("New returned error: %v", err)
+			}
+			if err := mediaSorter.Run(srcDir); err != nil {
+				t.Fatalf("Run returned error: %v", err)
+			}
+
+			for _, expected := range test.expected {
+				if _, err := os.Stat(filepath.Join(destDir, filepath.FromSlash(expected))); err != nil {
+					t.Errorf("Expected file %s: %v", expected, err)
+				}
+			}
+			for _, notExpected := range test.notExpected {
+				if _, err := os.Stat(filepath.Join(destDir, filepath.FromSlash(notExpected))); !os.IsNotExist(err) {
+					t.Errorf("Expected file %s not to exist, got %v", notExpected, err)
+				}
+			}
+			if mediaSorter.skipped[SkipMissingField] != test.expectedSkips {
+				t.Errorf("Expected %d skipped files with empty fields, got %d", test.expectedSkips, mediaSorter.skipped[SkipMissingField])
+			}
+		})
+	}
+}
@@ -0,0 +1,172 @@
+package sorter
+
+import (
+	"fmt"
+	"hash/fnv"
+	"reflect"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/language"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Bucket hashes the value and returns the number of a bucket between 0 and n-1,
+// as a zero-padded hexadecimal string. For 256 buckets, this returns a two-character shard like "a3".
+// The FNV hash is deterministic across runs and platforms.
+func Bucket(n int, value string) (string, error) {
+	if n < 1 {
+		return "", fmt.Errorf("number of buckets must be at least 1, got %d", n)
+	}
+	h := fnv.New32a()
+	h.Write([]byte(value))
+	bucket := h.Sum32() % uint32(n)
+	width := len(fmt.Sprintf("%x", n-1))
+	return fmt.Sprintf("%0*x", width, bucket), nil
+}
+
+// Sep returns the separator and the value, or an empty string if the value is empty or zero.
+// Use it for optional fields, e.g. {{ .Album }}{{ sep " - Disc " .Disc }}
+func Sep(separator string, value any) string {
+	return Wrap(separator, "", value)
+}
+
+// Wrap returns the value between prefix and suffix, or an empty string if the value is empty or zero.
+// Use it for optional fields, e.g. {{ .Title }}{{ wrap " (" ")" .Comment }}
+func Wrap(prefix, suffix string, value any) string {
+	if value == nil || reflect.ValueOf(value).IsZero() {
+		return ""
+	}
+	return fmt.Sprint(prefix, value, suffix)
+}
+
+// Placeholder that Year returns for unknown years
+const UnknownYear = "0000"
+
+// Range of years that Year accepts. Tags sometimes contain garbage like 1 or 20250,
+// the range allows for old recordings and composition years of classical music.
+const (
+	minYear = 1800
+	maxYear = 2999
+)
+
+// Year returns the year as a string, or a placeholder if the year is 0 or outside a sane range.
+// The placeholder defaults to UnknownYear, e.g. {{ year .Year }} or {{ year .Year "Unknown Year" }}
+func Year(year int, placeholder ...string) string {
+	if year >= minYear && year <= maxYear {
+		return fmt.Sprint(year)
+	}
+	if len(placeholder) > 0 {
+		return placeholder[0]
+	}
+	return UnknownYear
+}
+
+// Words that Title keeps in lower case, unless they are the first word
+var titleSmallWords = map[string]struct{}{
+	"a": {}, "an": {}, "and": {}, "as": {}, "at": {}, "but": {}, "by": {}, "for": {}, "from": {},
+	"in": {}, "nor": {}, "of": {}, "on": {}, "or": {}, "the": {}, "to": {}, "vs": {}, "with": {},
+}
+
+// Title capitalizes the first letter of each word and puts the other letters in lower case,
+// following the Unicode rules for word boundaries and special cases like the Greek final sigma.
+// Small words like "of" and "the" stay in lower case, unless they are the first word,
+// e.g. {{ title .Album }} turns "THE wall" and "the Wall" into "The Wall"
+func Title(text string) string {
+	// Casers keep state, so each call needs its own
+	words := strings.Split(cases.Title(language.Und).String(text), " ")
+	first := true
+	for i, word := range words {
+		if word == "" {
+			continue
+		}
+		if _, small := titleSmallWords[strings.ToLower(word)]; small && !first {
+			words[i] = strings.ToLower(word)
+		}
+		first = false
+	}
+	return strings.Join(words, " ")
+}
+
+// Directory that FirstLetter returns for names that don't start with a letter.
+// The sanitizers keep it as it is, when it's the whole path segment.
+const FirstLetterOther = "#"
+
+// FirstLetter returns the first letter of the name in upper case, for an index of directories like "A" to "Z".
+// It skips a leading "The ", so "The Beatles" goes under "B", and returns FirstLetterOther for names that start
+// with a digit or symbol, e.g. {{ firstLetter .Artist }}/{{ .Artist }}
+func FirstLetter(name string) string {
+	// Compose the letter and its accents, decomposed names would go under the letter without accents
+	name = norm.NFC.String(StripArticle(name, "The"))
+	if first, _ := utf8.DecodeRuneInString(name); unicode.IsLetter(first) {
+		return string(unicode.ToUpper(first))
+	}
+	return FirstLetterOther
+}
+
+// Pad puts zeros in front of the number until it has the width, e.g. {{ pad 3 .Track }} turns 7 into "007".
+// It returns 0 unchanged, files without a number hide it with {{ if .HasTrack }} instead.
+func Pad(width int, number int) (string, error) {
+	if width < 1 {
+		return "", fmt.Errorf("width must be at least 1, got %d", width)
+	}
+	if number == 0 {
+		return "0", nil
+	}
+	return fmt.Sprintf("%0*d", width, number), nil
+}
+
+// Truncate shortens the text to at most n characters, without splitting multibyte characters.
+// An optional suffix, like "…", replaces the end of shortened texts, so the result including the suffix has n characters,
+// e.g. {{ truncate 60 .Title }} or {{ truncate 60 .Title "…" }}
+func Truncate(n int, text string, suffix ...string) (string, error) {
+	if n < 1 {
+		return "", fmt.Errorf("maximum length must be at least 1, got %d", n)
+	}
+	runes := []rune(text)
+	if len(runes) <= n {
+		return text, nil
+	}
+	if len(suffix) == 0 || utf8.RuneCountInString(suffix[0]) >= n {
+		return string(runes[:n]), nil
+	}
+	cut := n - utf8.RuneCountInString(suffix[0])
+	return strings.TrimRightFunc(string(runes[:cut]), unicode.IsSpace) + suffix[0], nil
+}
+
+// Articles that StripArticle removes by default
+var defaultArticles = []string{"The", "A", "An"}
+
+// StripArticle removes a leading article and the whitespace after it, ignoring case,
+// e.g. {{ stripArticle .Artist }} turns "The Cure" into "Cure". Articles only match whole words,
+// so "Theatre" stays as it is. Pass articles to use them instead of "The", "A" and "An",
+// e.g. {{ stripArticle .Artist "Die" "Der" "Das" }}
+func StripArticle(text string, articles ...string) string {
+	if len(articles) == 0 {
+		articles = defaultArticles
+	}
+	text = strings.TrimSpace(text)
+	for _, article := range articles {
+		if len(text) <= len(article) || !strings.EqualFold(text[:len(article)], article) {
+			continue
+		}
+		rest := text[len(article):]
+		if r, _ := utf8.DecodeRuneInString(rest); !unicode.IsSpace(r) {
+			continue
+		}
+		return strings.TrimSpace(rest)
+	}
+	return text
+}
+
+// snakeSeparator stands for the underscores of the snake template function until the path is cleaned,
+// because the cleanup replaces underscores with spaces. The character is from the Unicode private use area.
+const snakeSeparator = "\uE05F"
+
+// snakeForPaths is the snake template function. It joins the words with separators, and the cleanup
+// of the path turns them into underscores, e.g. {{ snake .Title }} turns "My  Great Song" into "My_Great_Song"
+func snakeForPaths(text string) string {
+	return strings.Join(strings.Fields(text), snakeSeparator)
+}
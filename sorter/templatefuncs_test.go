@@ -0,0 +1,352 @@
+package sorter
+
+import (
+	"testing"
+)
+
+func TestBucket(t *testing.T) {
+	tests := []struct {
+		description string
+		n           int
+		value       string
+		expected    string
+	}{
+		{"single bucket", 1, "Feelgood", "0"},
+		{"16 buckets use one hex digit", 16, "Title", "9"},
+		{"256 buckets use two hex digits", 256, "Title", "a9"},
+		{"256 buckets pad with zero", 256, "Album", "0c"},
+		{"empty value", 256, "", "c5"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			actual, err := Bucket(test.n, test.value)
+			if err != nil {
+				t.Fatalf("Bucket(%d, %q) returned error: %v", test.n, test.value, err)
+			}
+			if actual != test.expected {
+				t.Errorf("Bucket(%d, %q) = %q; want %q", test.n, test.value, actual, test.expected)
+			}
+		})
+	}
+}
+
+func TestBucketRejectsInvalidNumberOfBuckets(t *testing.T) {
+	if _, err := Bucket(0, "Feelgood"); err == nil {
+		t.Error("Expected error for 0 buckets")
+	}
+}
+
+func TestSepAndWrap(t *testing.T) {
+	tests := []struct {
+		description string
+		actual      string
+		expected    string
+	}{
+		{"sep with text", Sep(" - ", "Album"), " - Album"},
+		{"sep with empty text", Sep(" - ", ""), ""},
+		{"sep with number", Sep(" - Disc ", 2), " - Disc 2"},
+		{"sep with zero", Sep(" - Disc ", 0), ""},
+		{"sep with nil", Sep(" - ", nil), ""},
+		{"wrap with text", Wrap(" (", ")", "Live"), " (Live)"},
+		{"wrap with empty text", Wrap(" (", ")", ""), ""},
+		{"wrap with number", Wrap("[", "]", 1999), "[1999]"},
+		{"wrap with zero", Wrap("[", "]", 0), ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			if test.actual != test.expected {
+				t.Errorf("Expected %q but got %q", test.expected, test.actual)
+			}
+		})
+	}
+}
+
+func TestYear(t *testing.T) {
+	tests := []struct {
+		description string
+		year        int
+		placeholder []string
+		expected    string
+	}{
+		{"missing year", 0, nil, UnknownYear},
+		{"missing year with placeholder", 0, []string{"Unknown Year"}, "Unknown Year"},
+		{"old year", 1850, nil, "1850"},
+		{"recent year", 2025, []string{"Unknown Year"}, "2025"},
+		{"year out of range", 20250, nil, UnknownYear},
+		{"negative year", -1, []string{"Unknown Year"}, "Unknown Year"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			actual := Year(test.year, test.placeholder...)
+			if actual != test.expected {
+				t.Errorf("Year(%d, %q) = %q; want %q", test.year, test.placeholder, actual, test.expected)
+			}
+		})
+	}
+}
+
+func TestTitle(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"THE wall", "The Wall"},
+		{"the Wall", "The Wall"},
+		{"dark side OF the moon", "Dark Side of the Moon"},
+		{"of monsters and men", "Of Monsters and Men"},
+		{"été indien", "Été Indien"},
+		{"live (remastered)", "Live (Remastered)"},
+		{"two  spaces", "Two  Spaces"},
+		{"hello-world", "Hello-World"},
+		{"ΟΔΥΣΣΕΥΣ", "Οδυσσευς"},
+		{"ÆON FLUX", "Æon Flux"},
+		{"", ""},
+	}
+
+	for _, test := range tests {
+		if actual := Title(test.input); actual != test.expected {
+			t.Errorf("Title(%q) = %q; want %q", test.input, actual, test.expected)
+		}
+	}
+}
+
+func TestCaseFunctionsInTemplate(t *testing.T) {
+	pathTemplate, err := parsePathTemplate("test", "{{ upper .Artist }}/{{ title .Album }}/{{ lower .Title }}", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, album := range []string{"THE wall", "The Wall", "the wall"} {
+		metadata := &Metadata{Artist: "Pink Floyd", Album: album, Title: "Hey You"}
+		actual, err := executePathTemplate(pathTemplate, metadata, "track")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if actual != "PINK FLOYD/The Wall/hey you" {
+			t.Errorf("Expected 'PINK FLOYD/The Wall/hey you' for album %q but got '%s'", album, actual)
+		}
+	}
+}
+
+func TestSnake(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"My Great Song", "My_Great_Song"},
+		{"My   Great  Song", "My_Great_Song"},
+		{"  leading and trailing  ", "leading_and_trailing"},
+		{"tab\tseparated\t\tvalues", "tab_separated_values"},
+		{"line\nbreak", "line_break"},
+		{"NoSpaces", "NoSpaces"},
+		{"   ", ""},
+	}
+
+	for _, level := range SanitizeLevelNames() {
+		sanitizer, err := NewSanitizer(SanitizeLevel(level), UTF8Encoding)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, test := range tests {
+			if actual := sanitizer.cleanPath(snakeForPaths(test.input)); actual != test.expected {
+				t.Errorf("snake(%q) with sanitize level %s = %q; want %q", test.input, level, actual, test.expected)
+			}
+		}
+	}
+}
+
+func TestFirstLetter(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"Abba", "A"},
+		{"beck", "B"},
+		{"The Beatles", "B"},
+		{"the cure", "C"},
+		{"THE  Smiths", "S"},
+		{"Theatre of Tragedy", "T"},
+		{"The", "T"},
+		{"Élan", "É"},
+		{"ólafur Arnalds", "Ó"},
+		{"Ωmega", "Ω"},
+		{"E\u0301lan", "É"},
+		{"2Pac", "#"},
+		{"!!!", "#"},
+		{"  Björk", "B"},
+		{"", "#"},
+	}
+
+	for _, test := range tests {
+		if actual := FirstLetter(test.input); actual != test.expected {
+			t.Errorf("FirstLetter(%q) = %q; want %q", test.input, actual, test.expected)
+		}
+	}
+}
+
+func TestPad(t *testing.T) {
+	tests := []struct {
+		width    int
+		number   int
+		expected string
+	}{
+		{1, 7, "7"},
+		{2, 7, "07"},
+		{3, 7, "007"},
+		{3, 42, "042"},
+		{2, 123, "123"},
+		{4, 2024, "2024"},
+		{3, 0, "0"},
+	}
+
+	for _, test := range tests {
+		actual, err := Pad(test.width, test.number)
+		if err != nil {
+			t.Fatalf("Pad(%d, %d) returned error: %v", test.width, test.number, err)
+		}
+		if actual != test.expected {
+			t.Errorf("Pad(%d, %d) = %q; want %q", test.width, test.number, actual, test.expected)
+		}
+	}
+	if _, err := Pad(0, 7); err == nil {
+		t.Error("Expected error for width 0")
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		description string
+		n           int
+		text        string
+		suffix      []string
+		expected    string
+	}{
+		{"shorter text", 10, "Hello", nil, "Hello"},
+		{"text with maximum length", 5, "Hello", nil, "Hello"},
+		{"one character too long", 5, "Hello!", nil, "Hello"},
+		{"multibyte text with maximum length", 4, "Motö", nil, "Motö"},
+		{"multibyte text one character too long", 4, "Motör", nil, "Motö"},
+		{"cut after multibyte character", 3, "日本語の歌", nil, "日本語"},
+		{"short text keeps no suffix", 5, "Hello", []string{"…"}, "Hello"},
+		{"suffix replaces the end", 5, "Hello World", []string{"…"}, "Hell…"},
+		{"suffix after multibyte characters", 4, "日本語の歌", []string{"…"}, "日本語…"},
+		{"spaces before suffix", 7, "Hello World", []string{"…"}, "Hello…"},
+		{"suffix longer than maximum", 2, "Hello", []string{"..."}, "He"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			actual, err := Truncate(test.n, test.text, test.suffix...)
+			if err != nil {
+				t.Fatalf("Truncate returned error: %v", err)
+			}
+			if actual != test.expected {
+				t.Errorf("Truncate(%d, %q, %q) = %q; want %q", test.n, test.text, test.suffix, actual, test.expected)
+			}
+		})
+	}
+}
+
+func TestTruncateRejectsInvalidLength(t *testing.T) {
+	if _, err := Truncate(0, "Hello"); err == nil {
+		t.Error("Expected error for maximum length 0")
+	}
+}
+
+func TestStripArticle(t *testing.T) {
+	tests := []struct {
+		input    string
+		articles []string
+		expected string
+	}{
+		{"The Cure", nil, "Cure"},
+		{"A Tribe Called Quest", nil, "Tribe Called Quest"},
+		{"An Horse", nil, "Horse"},
+		{"the the", nil, "the"},
+		{"THE Smiths", nil, "Smiths"},
+		{"Theatre of Tragedy", nil, "Theatre of Tragedy"},
+		{"Anathema", nil, "Anathema"},
+		{"A-ha", nil, "A-ha"},
+		{"Cure, The", nil, "Cure, The"},
+		{"The", nil, "The"},
+		{"  The   Cure  ", nil, "Cure"},
+		{"The\tCure", nil, "Cure"},
+		{"The ", nil, "The"},
+		{"", nil, ""},
+		{"Die Ärzte", []string{"Die", "Der", "Das"}, "Ärzte"},
+		{"The Cure", []string{"Die", "Der", "Das"}, "The Cure"},
+	}
+
+	for _, test := range tests {
+		if actual := StripArticle(test.input, test.articles...); actual != test.expected {
+			t.Errorf("StripArticle(%q, %q) = %q; want %q", test.input, test.articles, actual, test.expected)
+		}
+	}
+}
+
+func TestStripArticleInTemplate(t *testing.T) {
+	pathTemplate, err := parsePathTemplate("test", `{{ stripArticle .Artist }}/{{ stripArticle .Album "Die" }}`, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	actual, err := executePathTemplate(pathTemplate, &Metadata{Artist: "The Cure", Album: "Die Hits"}, "track")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual != "Cure/Hits" {
+		t.Errorf("Expected 'Cure/Hits' but got '%s'", actual)
+	}
+}
+
+func TestSnakeInTemplateKeepsUnderscores(t *testing.T) {
+	pathTemplate, err := parsePathTemplate("test", "{{ snake .Artist }}/{{ snake .Title }}", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rendered, err := executePathTemplate(pathTemplate, &Metadata{Artist: " My\tBand ", Title: "My  Great Song"}, "track")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for level, expected := range map[SanitizeLevel]string{
+		MinimalSanitizing: "My_Band/My_Great_Song",
+		WindowsSanitizing: "My_Band/My_Great_Song",
+	} {
+		if actual := sanitizers[level].cleanPath(rendered); actual != expected {
+			t.Errorf("Expected '%s' for sanitize level %s but got '%s'", expected, level, actual)
+		}
+	}
+}
+
+func TestASCIIInTemplate(t *testing.T) {
+	pathTemplate, err := parsePathTemplate("test", "{{ ascii .Artist }}/{{ ascii (snake .Album) }}", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		description string
+		artist      string
+		album       string
+		expected    string
+	}{
+		{"accented letters", "Björk", "Homogénic", "Bjork/Homogenic"},
+		{"umlaut and ligature", "Motörhead", "Straße Æon", "Motorhead/Strasse_AEon"},
+		{"characters without ASCII equivalent are dropped", "坂本龍一 Ryuichi Sakamoto", "戦場のメリークリスマス", "Ryuichi Sakamoto"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			rendered, err := executePathTemplate(pathTemplate, &Metadata{Artist: test.artist, Album: test.album}, "track")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if actual := sanitizers[DefaultSanitizeLevel].cleanPath(rendered); actual != test.expected {
+				t.Errorf("Expected '%s' but got '%s'", test.expected, actual)
+			}
+		})
+	}
+}
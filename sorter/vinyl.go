@@ -0,0 +1,57 @@
+package sorter
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Raw tag names for disc and track numbers, for reading the sides of vinyl records
+var (
+	discTags  = []string{"discnumber", "disc", "TPOS", "TPA"}
+	trackTags = []string{"tracknumber", "track", "TRCK", "TRK", "trkn"}
+)
+
+// sidePattern matches side indicators of vinyl records like "B", "Side B" or "B2" (second track on side B)
+var sidePattern = regexp.MustCompile(`(?i)^(?:side\s*)?([a-z])\s*(\d*)(?:\s*/.*)?$`)
+
+// parseSide returns the number of the side (1 for side A) and the track number of a side indicator.
+// The track number is 0 if the indicator has none.
+func parseSide(text string) (side int, track int, ok bool) {
+	match := sidePattern.FindStringSubmatch(strings.TrimSpace(text))
+	if match == nil {
+		return 0, 0, false
+	}
+	side = int(strings.ToUpper(match[1])[0]-'A') + 1
+	if match[2] != "" {
+		track, _ = strconv.Atoi(match[2])
+	}
+	return side, track, true
+}
+
+// fillSides sets disc and track numbers from side indicators in the raw tags, if the numeric tags are missing
+func fillSides(metadata *Metadata, raw map[string]interface{}) {
+	if metadata.Disc == 0 {
+		if side, _, ok := parseSide(rawString(raw, discTags...)); ok {
+			metadata.Disc = side
+		}
+	}
+	if metadata.Track == 0 {
+		if side, track, ok := parseSide(rawString(raw, trackTags...)); ok {
+			metadata.Track = track
+			if metadata.Disc == 0 {
+				metadata.Disc = side
+			}
+		}
+	}
+}
+
+// Side returns the letter of a vinyl record side for a disc number, e.g. "A" for 1 and "B" for 2.
+// It returns an empty string for disc numbers that have no letter.
+// Use it for vinyl records, e.g. {{ with .Disc }}Side {{ side . }}{{ end }}
+func Side(disc int) string {
+	if disc < 1 || disc > 26 {
+		return ""
+	}
+	return string(rune('A' + disc - 1))
+}
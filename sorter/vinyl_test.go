@@ -0,0 +1,80 @@
+package sorter
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseSide(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedSide  int
+		expectedTrack int
+		expectedOk    bool
+	}{
+		{"A", 1, 0, true},
+		{"b", 2, 0, true},
+		{"Side C", 3, 0, true},
+		{"D4", 4, 4, true},
+		{"A2/6", 1, 2, true},
+		{"3", 0, 0, false},
+		{"", 0, 0, false},
+		{"AB", 0, 0, false},
+	}
+	for _, test := range tests {
+		side, track, ok := parseSide(test.input)
+		if side != test.expectedSide || track != test.expectedTrack || ok != test.expectedOk {
+			t.Errorf("parseSide(%q) = %d, %d, %t; want %d, %d, %t", test.input, side, track, ok, test.expectedSide, test.expectedTrack, test.expectedOk)
+		}
+	}
+}
+
+func TestSide(t *testing.T) {
+	tests := []struct {
+		disc     int
+		expected string
+	}{
+		{0, ""},
+		{1, "A"},
+		{4, "D"},
+		{27, ""},
+	}
+	for _, test := range tests {
+		if actual := Side(test.disc); actual != test.expected {
+			t.Errorf("Side(%d) = %q; want %q", test.disc, actual, test.expected)
+		}
+	}
+}
+
+func TestReadMetadataUsesVinylSides(t *testing.T) {
+	tests := []struct {
+		description   string
+		comments      []string
+		expectedDisc  int
+		expectedTrack int
+	}{
+		{"side as disc", []string{"DISCNUMBER=B", "TRACKNUMBER=3"}, 2, 3},
+		{"side in track number", []string{"TRACKNUMBER=C2"}, 3, 2},
+		{"numeric tags", []string{"DISCNUMBER=1", "TRACKNUMBER=5"}, 1, 5},
+		{"no disc", []string{"TRACKNUMBER=5"}, 0, 5},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "track.flac")
+			if err := os.WriteFile(path, flacStream(append([]string{"TITLE=Title"}, test.comments...)...), 0644); err != nil {
+				t.Fatal(err)
+			}
+			reader := &MetaDataReader{OutputWriter: &OutputWriter{Verbosity: Quiet, Writer: io.Discard}}
+			metadata, err := reader.ReadMetadata(MediaFile(path))
+			if err != nil {
+				t.Fatalf("ReadMetadata returned error: %v", err)
+			}
+			if metadata.Disc != test.expectedDisc || metadata.Track != test.expectedTrack {
+				t.Errorf("Expected disc %d and track %d but got disc %d and track %d", test.expectedDisc, test.expectedTrack, metadata.Disc, metadata.Track)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package sorter
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// WritableChecker checks in dry-run mode if the destination directories are writable,
+// by creating and removing a probe file in each directory. As dry runs don't create directories,
+// it checks the nearest existing parent directory of each destination directory.
+type WritableChecker struct {
+	// Results of the checked directories, nil if the directory is writable
+	checked map[string]error
+	mu      sync.Mutex
+}
+
+func NewWritableChecker() *WritableChecker {
+	return &WritableChecker{checked: make(map[string]error)}
+}
+
+// FileProcessor returns a dry-run FileProcessor that checks the destination directory of each file
+func (w *WritableChecker) FileProcessor(srcPath string, destPath string) error {
+	w.Check(filepath.Dir(destPath))
+	return nil
+}
+
+func (w *WritableChecker) Check(dir string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	existingDir := dir
+	if conflict := findFileInPath(dir); conflict != "" {
+		w.checked[dir] = fmt.Errorf("%s is a file, not a directory", conflict)
+		return
+	}
+	for {
+		if _, err := os.Stat(existingDir); err == nil {
+			break
+		}
+		parent := filepath.Dir(existingDir)
+		if parent == existingDir {
+			break
+		}
+		existingDir = parent
+	}
+
+	if _, done := w.checked[existingDir]; done {
+		return
+	}
+	w.checked[existingDir] = probeDirectory(existingDir)
+}
+
+func probeDirectory(dir string) error {
+	probe, err := os.CreateTemp(dir, ".mediasorter-probe-*")
+	if err != nil {
+		return err
+	}
+	probeName := probe.Name()
+	if err := probe.Close(); err != nil {
+		os.Remove(probeName)
+		return err
+	}
+	return os.Remove(probeName)
+}
+
+// Failures returns a sorted list of directories that are not writable, with the reason
+func (w *WritableChecker) Failures() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var failures []string
+	for dir, err := range w.checked {
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", dir, err))
+		}
+	}
+	sort.Strings(failures)
+	return failures
+}
+
+// Report shows all failures and returns an error if there were any
+func (w *WritableChecker) Report(outputWriter *OutputWriter) error {
+	failures := w.Failures()
+	if len(failures) == 0 {
+		return nil
+	}
+	outputWriter.Warn(fmt.Sprintf("Destination directories that are not writable:\n  %s", strings.Join(failures, "\n  ")))
+	return fmt.Errorf("%d destination directories are not writable", len(failures))
+}
@@ -0,0 +1,47 @@
+package sorter
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWritableCheckerChecksNearestExistingDirectory(t *testing.T) {
+	dir := t.TempDir()
+	checker := NewWritableChecker()
+	if err := checker.FileProcessor("src.mp3", filepath.Join(dir, "Artist", "Album", "01 Title.mp3")); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if _, checked := checker.checked[dir]; !checked {
+		t.Errorf("Expected %s to be checked, got %v", dir, checker.checked)
+	}
+	if failures := checker.Failures(); len(failures) > 0 {
+		t.Errorf("Expected no failures, got %v", failures)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) > 0 {
+		t.Errorf("Expected probe file to be removed, got %v", entries)
+	}
+}
+
+func TestWritableCheckerReportsFailures(t *testing.T) {
+	dir := t.TempDir()
+	conflict := filepath.Join(dir, "Artist")
+	if err := os.WriteFile(conflict, []byte{}, 0644); err != nil {
+		t.Fatal(err)
+	}
+	checker := NewWritableChecker()
+	checker.Check(filepath.Join(dir, "Artist", "Album"))
+	checker.Check(filepath.Join(dir, "Missing", "Parent", "Album"))
+
+	failures := checker.Failures()
+	if len(failures) != 1 || !strings.Contains(failures[0], "is a file, not a directory") {
+		t.Errorf("Expected one failure for conflicting file, got %v", failures)
+	}
+	if err := checker.Report(&OutputWriter{Verbosity: Quiet, Writer: io.Discard}); err == nil {
+		t.Error("Expected error from report")
+	}
+}